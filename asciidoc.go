@@ -0,0 +1,690 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterNamedGenerator("asciidoc", 0, asciidocGenerator{})
+}
+
+// asciidocGenerator generates the posts written in AsciiDoc. The header
+// gives the title, the author and revision lines, and the attributes,
+// in which ":revdate:" is the date and ":tags:" the comma separated
+// tags, the optional attributes are given as well, like ":draft: true".
+type asciidocGenerator struct{}
+
+func (asciidocGenerator) Match(filename string) bool {
+	return strings.HasSuffix(filename, ".adoc") || strings.HasSuffix(filename, ".asciidoc")
+}
+
+// the limit of the nested includes, against the cycles
+const maxIncludeDepth = 8
+
+var (
+	adocAttr       = regexp.MustCompile(`^:(!?[\w-]+!?):\s*(.*?)\s*$`)
+	adocSection    = regexp.MustCompile(`^(={1,6})\s+(.*?)\s*$`)
+	adocInclude    = regexp.MustCompile(`^include::([^\[]+)\[(.*)\]\s*$`)
+	adocImage      = regexp.MustCompile(`^image::([^\[]+)\[(.*)\]\s*$`)
+	adocItem       = regexp.MustCompile(`^\s*(\*{1,5}|-|\.{1,5}|\d+\.)\s+(.*)$`)
+	adocAdmonition = regexp.MustCompile(`^(NOTE|TIP|IMPORTANT|WARNING|CAUTION):\s+(.*)$`)
+	adocBlockAttrs = regexp.MustCompile(`^\[([^\[\]]*)\]\s*$`)
+	adocBlockTitle = regexp.MustCompile(`^\.([^\s.].*)$`)
+	adocDelimiter  = regexp.MustCompile(`^(-{4,}|\.{4,}|={4,}|_{4,}|\*{4,}|\+{4,}|/{4,})\s*$`)
+
+	adocInlineImage = regexp.MustCompile(`^image:([^\s\[:][^\s\[]*)\[([^\]]*)\]`)
+	adocLinkMacro   = regexp.MustCompile(`^link:([^\s\[]+)\[([^\]]*)\]`)
+	adocURL         = regexp.MustCompile(`^(?:https?|ftp)://[^\s\[<]+`)
+	adocAttrRef     = regexp.MustCompile(`^\{([\w-]+)\}`)
+)
+
+// Sniff recognizes the document title like "= title" at the first line
+// which isn't a comment
+func (asciidocGenerator) Sniff(head []byte) bool {
+	for _, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		sm := adocSection.FindStringSubmatch(line)
+		return sm != nil && sm[1] == "="
+	}
+	return false
+}
+
+func (asciidocGenerator) Generate(input io.Reader, s Staticer) (Poster, error) {
+	c, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.Replace(string(c), "\r\n", "\n", -1), "\n")
+
+	a := &asciidocParser{attrs: make(map[string]string)}
+	var m meta
+	body, err := a.header(lines, &m)
+	if err != nil {
+		return nil, err
+	}
+	m.key = generateKey(m.title, m.slug, s)
+	a.key, a.s = m.key, s
+
+	nums := make([]int, len(lines)-body)
+	for i := range nums {
+		nums[i] = body + i + 1
+	}
+	if a.lines, a.nums, err = expandIncludes(lines[body:], nums, s, 0); err != nil {
+		return nil, err
+	}
+	if err = a.parse(); err != nil {
+		return nil, err
+	}
+	a.fill(&m)
+	return newPost(m), nil
+}
+
+// asciidocParser parses the body of an AsciiDoc document line by line
+type asciidocParser struct {
+	markup
+	lines   []string
+	nums    []int // the line numbers in the source
+	i       int   // the current line
+	attrs   map[string]string
+	markers []string // of the lists being written
+	// for the next block
+	blockAttrs []string
+	blockTitle string
+}
+
+// header parses the document header into m, and gives the index of the
+// first line of the body
+func (a *asciidocParser) header(lines []string, m *meta) (int, error) {
+	i := 0
+	for i < len(lines) && (strings.TrimSpace(lines[i]) == "" || strings.HasPrefix(lines[i], "//")) {
+		i++
+	}
+	if i == len(lines) || !strings.HasPrefix(lines[i], "= ") {
+		return 0, &LineError{i + 1, errors.New("asciidoc: can't find the document title\n")}
+	}
+	m.title = strings.TrimSpace(lines[i][2:])
+	i++
+
+	hasDate := false
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "//") {
+			continue
+		}
+		sm := adocAttr.FindStringSubmatch(line)
+		if sm == nil {
+			// the author line, or the revision line with a date
+			if strings.Contains(line, "@") || !datePattern.MatchString(line) {
+				a.attrs["author"] = strings.TrimSpace(line)
+				continue
+			}
+			d, err := parseDate(line)
+			if err != nil {
+				return 0, &LineError{i + 1, err}
+			}
+			if !hasDate {
+				m.date, hasDate = d, true
+			}
+			continue
+		}
+		name, value := strings.ToLower(sm[1]), sm[2]
+		a.attrs[name] = value
+		switch {
+		case name == "revdate":
+			d, err := parseDate(value)
+			if err != nil {
+				return 0, &LineError{i + 1, err}
+			}
+			m.date, hasDate = d, true
+		case name == "tags":
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					m.tags = append(m.tags, tag)
+				}
+			}
+		case knownAttrs[name]:
+			if err := m.applyAttr(name, value); err != nil {
+				return 0, &LineError{i + 1, err}
+			}
+		}
+	}
+	if !hasDate {
+		return 0, &LineError{1, errors.New("asciidoc: can't find the revdate\n")}
+	}
+	return i, nil
+}
+
+// expandIncludes replaces the include directives with the lines of the
+// files got from s, the included lines have the number of the directive
+func expandIncludes(lines []string, nums []int, s Staticer, depth int) ([]string, []int, error) {
+	var (
+		outLines []string
+		outNums  []int
+	)
+	for i, line := range lines {
+		sm := adocInclude.FindStringSubmatch(line)
+		if sm == nil {
+			outLines = append(outLines, line)
+			outNums = append(outNums, nums[i])
+			continue
+		}
+		if depth == maxIncludeDepth {
+			return nil, nil, &LineError{nums[i], fmt.Errorf("asciidoc: include %s: too many nested includes\n", sm[1])}
+		}
+		if s == nil {
+			return nil, nil, &LineError{nums[i], fmt.Errorf("asciidoc: include %s: no static resources\n", sm[1])}
+		}
+		r := s.Static(sm[1])
+		c, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, nil, &LineError{nums[i], fmt.Errorf("asciidoc: include %s: %s\n", sm[1], strings.TrimSpace(err.Error()))}
+		}
+		included := strings.Split(strings.TrimSuffix(strings.Replace(string(c), "\r\n", "\n", -1), "\n"), "\n")
+		includedNums := make([]int, len(included))
+		for j := range includedNums {
+			includedNums[j] = nums[i]
+		}
+		included, includedNums, err = expandIncludes(included, includedNums, s, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		outLines = append(outLines, included...)
+		outNums = append(outNums, includedNums...)
+	}
+	return outLines, outNums, nil
+}
+
+func (a *asciidocParser) parse() error {
+	for a.i < len(a.lines) {
+		line := a.lines[a.i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			a.i++
+		case strings.HasPrefix(line, "//") && !adocDelimiter.MatchString(line):
+			a.i++
+		case adocAttr.MatchString(line):
+			sm := adocAttr.FindStringSubmatch(line)
+			a.attrs[strings.ToLower(sm[1])] = sm[2]
+			a.i++
+		case adocBlockAttrs.MatchString(line):
+			a.blockAttrs = splitAttrs(adocBlockAttrs.FindStringSubmatch(line)[1])
+			a.i++
+			continue
+		case adocBlockTitle.MatchString(line):
+			a.blockTitle = adocBlockTitle.FindStringSubmatch(line)[1]
+			a.i++
+			continue
+		case adocSection.MatchString(line):
+			sm := adocSection.FindStringSubmatch(line)
+			a.heading(len(sm[1]), a.inline(sm[2]))
+			a.i++
+		case adocDelimiter.MatchString(line):
+			if err := a.block(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(trimmed, "|==="):
+			if err := a.table(); err != nil {
+				return err
+			}
+		case adocImage.MatchString(line):
+			sm := adocImage.FindStringSubmatch(line)
+			a.writeTitle()
+			fmt.Fprintf(&a.out, "<div class=\"image\">\n%s\n</div>\n", a.img(sm[1], firstAttr(sm[2])))
+			a.i++
+		case adocItem.MatchString(line):
+			a.writeTitle()
+			a.list()
+		case line[0] == ' ' || line[0] == '\t':
+			// a literal paragraph
+			var text []string
+			for ; a.i < len(a.lines) && strings.TrimSpace(a.lines[a.i]) != ""; a.i++ {
+				text = append(text, a.lines[a.i])
+			}
+			a.writeTitle()
+			a.code("", strings.Join(unindent(text), "\n"))
+		default:
+			a.paragraph()
+		}
+		a.blockAttrs, a.blockTitle = nil, ""
+	}
+	return nil
+}
+
+// splitAttrs splits the block attributes like `source,go` or
+// `options="header"`
+func splitAttrs(s string) []string {
+	var attrs []string
+	for _, attr := range strings.Split(s, ",") {
+		attrs = append(attrs, strings.Trim(strings.TrimSpace(attr), `"`))
+	}
+	return attrs
+}
+
+func firstAttr(s string) string {
+	return strings.TrimSpace(strings.Split(s, ",")[0])
+}
+
+// style gives the style of the block, the first positional attribute
+func (a *asciidocParser) style() string {
+	if len(a.blockAttrs) == 0 || strings.Contains(a.blockAttrs[0], "=") {
+		return ""
+	}
+	return a.blockAttrs[0]
+}
+
+// hasOption reports whether the block has the option, given like
+// `%header` or `options="header"`
+func (a *asciidocParser) hasOption(option string) bool {
+	for _, attr := range a.blockAttrs {
+		if strings.HasPrefix(attr, "options=") || strings.HasPrefix(attr, "opts=") {
+			attr = "%" + attr[strings.Index(attr, "=")+1:]
+		}
+		for _, o := range strings.Split(attr, "%")[1:] {
+			if strings.TrimSpace(o) == option {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *asciidocParser) writeTitle() {
+	if a.blockTitle != "" {
+		fmt.Fprintf(&a.out, "<div class=\"title\">%s</div>\n", a.inline(a.blockTitle))
+	}
+}
+
+// block writes a delimited block
+func (a *asciidocParser) block() error {
+	delimiter := strings.TrimSpace(a.lines[a.i])
+	begin := a.nums[a.i]
+	var body []string
+	for a.i++; a.i < len(a.lines); a.i++ {
+		if strings.TrimSpace(a.lines[a.i]) == delimiter {
+			break
+		}
+		body = append(body, a.lines[a.i])
+	}
+	if a.i == len(a.lines) {
+		return &LineError{begin, fmt.Errorf("asciidoc: unterminated block %s\n", delimiter)}
+	}
+	a.i++
+
+	style := a.style()
+	if delimiter[0] != '/' {
+		a.writeTitle()
+	}
+	switch delimiter[0] {
+	case '-':
+		var lang string
+		if style == "source" && len(a.blockAttrs) > 1 {
+			lang = a.blockAttrs[1]
+		} else if style != "" && style != "source" && style != "listing" {
+			lang = style
+		}
+		a.code(lang, strings.Join(body, "\n"))
+	case '.':
+		a.code("", strings.Join(body, "\n"))
+	case '+':
+		a.out.WriteString(strings.Join(body, "\n") + "\n")
+	case '_':
+		a.out.WriteString("<blockquote>\n")
+		a.nested(body)
+		a.out.WriteString("</blockquote>\n")
+	case '*':
+		a.out.WriteString("<div class=\"sidebar\">\n")
+		a.nested(body)
+		a.out.WriteString("</div>\n")
+	case '=':
+		if kind := strings.ToLower(style); admonitionTitles[kind] != "" {
+			fmt.Fprintf(&a.out, "<div class=\"admonition %s\">\n<p class=\"title\">%s</p>\n", kind, admonitionTitles[kind])
+		} else {
+			a.out.WriteString("<div class=\"example\">\n")
+		}
+		a.nested(body)
+		a.out.WriteString("</div>\n")
+	}
+	return nil
+}
+
+var admonitionTitles = map[string]string{
+	"note":      "Note",
+	"tip":       "Tip",
+	"important": "Important",
+	"warning":   "Warning",
+	"caution":   "Caution",
+}
+
+// nested parses the lines in a block, the delimited blocks in them are
+// closed already
+func (a *asciidocParser) nested(lines []string) {
+	savedLines, savedNums, i := a.lines, a.nums, a.i
+	nums := make([]int, len(lines))
+	for j := range nums {
+		nums[j] = a.nums[i-1]
+	}
+	a.lines, a.nums, a.i = lines, nums, 0
+	a.blockAttrs, a.blockTitle = nil, ""
+	a.parse()
+	a.lines, a.nums, a.i = savedLines, savedNums, i
+}
+
+// table writes a table delimited by "|===", the first row is the header
+// if it has the header option or is followed by a blank line
+func (a *asciidocParser) table() error {
+	begin := a.nums[a.i]
+	header := a.hasOption("header")
+	var (
+		cells []string
+		cols  int // the cells in the first line
+		lines int // the lines with cells
+	)
+	for a.i++; a.i < len(a.lines); a.i++ {
+		line := strings.TrimSpace(a.lines[a.i])
+		if strings.HasPrefix(line, "|===") {
+			break
+		}
+		if line == "" {
+			// the first line followed by a blank line is the header
+			if lines == 1 && !a.hasOption("noheader") {
+				header = true
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "|") {
+			// continues the last cell
+			if len(cells) != 0 {
+				cells[len(cells)-1] += "\n" + a.inline(line)
+			}
+			continue
+		}
+		row := strings.Split(line[1:], "|")
+		if lines == 0 {
+			cols = len(row)
+		}
+		lines++
+		for _, cell := range row {
+			cells = append(cells, a.inline(strings.TrimSpace(cell)))
+		}
+	}
+	if a.i == len(a.lines) {
+		return &LineError{begin, errors.New("asciidoc: unterminated table\n")}
+	}
+	a.i++
+	if cols == 0 {
+		cols = 1
+	}
+
+	var rows [][]string
+	for len(cells) > 0 {
+		n := cols
+		if n > len(cells) {
+			n = len(cells)
+		}
+		rows = append(rows, cells[:n])
+		cells = cells[n:]
+	}
+	a.writeTitle()
+	a.out.WriteString("<table>\n")
+	if header && len(rows) != 0 {
+		a.out.WriteString("<thead>\n")
+		writeRows(&a.out, rows[:1], "th")
+		a.out.WriteString("</thead>\n")
+		rows = rows[1:]
+	}
+	a.out.WriteString("<tbody>\n")
+	writeRows(&a.out, rows, "td")
+	a.out.WriteString("</tbody>\n</table>\n")
+	return nil
+}
+
+// listMarker gives the marker of the list item, the numbers are the
+// same marker
+func listMarker(marker string) string {
+	if marker[0] >= '0' && marker[0] <= '9' {
+		return "1."
+	}
+	return marker
+}
+
+// list writes the items with the marker of the current line, the items
+// with the other markers not in the parent lists are nested
+func (a *asciidocParser) list() {
+	first := adocItem.FindStringSubmatch(a.lines[a.i])
+	marker := listMarker(first[1])
+	tag := "ul"
+	if marker[0] == '.' || marker == "1." {
+		tag = "ol"
+	}
+	a.markers = append(a.markers, marker)
+	defer func() { a.markers = a.markers[:len(a.markers)-1] }()
+
+	fmt.Fprintf(&a.out, "<%s>\n", tag)
+	for a.i < len(a.lines) {
+		sm := adocItem.FindStringSubmatch(a.lines[a.i])
+		if sm == nil || listMarker(sm[1]) != marker {
+			break
+		}
+		a.i++
+		text := []string{sm[2]}
+		open := false // whether the text is written
+		writeText := func() {
+			if !open {
+				fmt.Fprintf(&a.out, "<li>%s", a.inline(strings.Join(text, "\n")))
+				open = true
+			}
+		}
+		for a.i < len(a.lines) {
+			line := a.lines[a.i]
+			if strings.TrimSpace(line) == "" {
+				// a blank line ends the list unless an item follows
+				next := a.i + 1
+				for next < len(a.lines) && strings.TrimSpace(a.lines[next]) == "" {
+					next++
+				}
+				if next == len(a.lines) || !adocItem.MatchString(a.lines[next]) {
+					break
+				}
+				a.i = next
+				continue
+			}
+			if sm := adocItem.FindStringSubmatch(line); sm != nil {
+				if a.isOpenMarker(listMarker(sm[1])) {
+					break
+				}
+				writeText()
+				a.out.WriteByte('\n')
+				a.list()
+				continue
+			}
+			if a.startsBlock(line) {
+				break
+			}
+			if open {
+				a.out.WriteString(a.inline(strings.TrimSpace(line)) + "\n")
+			} else {
+				text = append(text, strings.TrimSpace(line))
+			}
+			a.i++
+		}
+		writeText()
+		a.out.WriteString("</li>\n")
+		if a.i < len(a.lines) && strings.TrimSpace(a.lines[a.i]) == "" {
+			break
+		}
+	}
+	fmt.Fprintf(&a.out, "</%s>\n", tag)
+}
+
+func (a *asciidocParser) isOpenMarker(marker string) bool {
+	for _, m := range a.markers {
+		if m == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// startsBlock reports whether the line starts another block rather than
+// continues a paragraph
+func (a *asciidocParser) startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || adocSection.MatchString(line) || adocDelimiter.MatchString(line) ||
+		strings.HasPrefix(trimmed, "|===") || adocImage.MatchString(line) ||
+		adocBlockAttrs.MatchString(line) || adocAttr.MatchString(line) ||
+		adocItem.MatchString(line) || strings.HasPrefix(line, "//")
+}
+
+// paragraph writes the lines until a blank line or another block, an
+// admonition if it starts with a label like "NOTE:"
+func (a *asciidocParser) paragraph() {
+	text := []string{strings.TrimSpace(a.lines[a.i])}
+	for a.i++; a.i < len(a.lines) && !a.startsBlock(a.lines[a.i]); a.i++ {
+		text = append(text, strings.TrimSpace(a.lines[a.i]))
+	}
+	kind := strings.ToLower(a.style())
+	if sm := adocAdmonition.FindStringSubmatch(text[0]); sm != nil {
+		kind, text[0] = strings.ToLower(sm[1]), sm[2]
+	}
+	a.writeTitle()
+	content := a.inline(strings.Join(text, "\n"))
+	switch {
+	case admonitionTitles[kind] != "":
+		fmt.Fprintf(&a.out, "<div class=\"admonition %s\">\n<p class=\"title\">%s</p>\n<p>%s</p>\n</div>\n",
+			kind, admonitionTitles[kind], content)
+	case kind == "source" || kind == "listing" || kind == "literal":
+		var lang string
+		if kind == "source" && len(a.blockAttrs) > 1 {
+			lang = a.blockAttrs[1]
+		}
+		a.code(lang, strings.Join(text, "\n"))
+	default:
+		fmt.Fprintf(&a.out, "<p>%s</p>\n", content)
+	}
+}
+
+// inline gives the html of the text with the inline markup, macros and
+// attribute references
+func (a *asciidocParser) inline(s string) string {
+	var b strings.Builder
+	plain := 0 // the start of the plain text not written yet
+	flush := func(i int) {
+		b.WriteString(html.EscapeString(s[plain:i]))
+	}
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		wordStart := i == 0 || !isIdentByte(s[i-1])
+		if sm := adocInlineImage.FindStringSubmatch(rest); sm != nil && wordStart {
+			flush(i)
+			b.WriteString(a.img(sm[1], firstAttr(sm[2])))
+			i += len(sm[0])
+			plain = i
+			continue
+		}
+		if sm := adocLinkMacro.FindStringSubmatch(rest); sm != nil && wordStart {
+			flush(i)
+			b.WriteString(a.anchor(sm[1], sm[2]))
+			i += len(sm[0])
+			plain = i
+			continue
+		}
+		if url := adocURL.FindString(rest); url != "" && wordStart {
+			flush(i)
+			i += len(url)
+			if strings.HasPrefix(s[i:], "[") {
+				if end := strings.IndexByte(s[i:], ']'); end > 0 {
+					b.WriteString(a.anchor(url, s[i+1:i+end]))
+					i += end + 1
+					plain = i
+					continue
+				}
+			}
+			// the trailing punctuation isn't a part of the url
+			trimmed := strings.TrimRight(url, ".,;:!?)")
+			i -= len(url) - len(trimmed)
+			b.WriteString(a.anchor(trimmed, ""))
+			plain = i
+			continue
+		}
+		if sm := adocAttrRef.FindStringSubmatch(rest); sm != nil {
+			if v, ok := a.attrs[strings.ToLower(sm[1])]; ok {
+				flush(i)
+				b.WriteString(html.EscapeString(v))
+				i += len(sm[0])
+				plain = i
+				continue
+			}
+		}
+		switch c := s[i]; c {
+		case '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				flush(i)
+				fmt.Fprintf(&b, "<code>%s</code>", html.EscapeString(s[i+1:i+1+end]))
+				i += end + 2
+				plain = i
+				continue
+			}
+		case '*', '_':
+			tag := "strong"
+			if c == '_' {
+				tag = "em"
+			}
+			pair := string([]byte{c, c})
+			if strings.HasPrefix(rest, pair) {
+				if end := strings.Index(s[i+2:], pair); end > 0 {
+					flush(i)
+					fmt.Fprintf(&b, "<%s>%s</%s>", tag, a.inline(s[i+2:i+2+end]), tag)
+					i += end + 4
+					plain = i
+					continue
+				}
+			}
+			if j := closeConstrained(s, i); wordStart && j > 0 {
+				flush(i)
+				fmt.Fprintf(&b, "<%s>%s</%s>", tag, a.inline(s[i+1:j]), tag)
+				i = j + 1
+				plain = i
+				continue
+			}
+		}
+		i++
+	}
+	flush(len(s))
+	return b.String()
+}
+
+// closeConstrained gives the index of the constrained mark closing the
+// one at i, which is followed by a non word character, or -1
+func closeConstrained(s string, i int) int {
+	m := s[i]
+	if i+1 >= len(s) || isSpace(s[i+1]) {
+		return -1
+	}
+	for j := i + 2; j < len(s); j++ {
+		if s[j] == m && !isSpace(s[j-1]) && (j+1 == len(s) || !isIdentByte(s[j+1])) {
+			return j
+		}
+	}
+	return -1
+}
+
+// anchor gives the html of a link, the target is shown without a text
+func (a *asciidocParser) anchor(target, text string) string {
+	if text = strings.TrimSpace(text); text == "" {
+		text = html.EscapeString(target)
+	} else {
+		text = a.inline(text)
+	}
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(a.href(target)), text)
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAsciidocMatch(t *testing.T) {
+	for name, c := range map[string]struct {
+		path   string
+		expect bool
+	}{
+		"adoc": {
+			path:   "a/b/c.adoc",
+			expect: true,
+		},
+		"asciidoc": {
+			path:   "a/b/c.asciidoc",
+			expect: true,
+		},
+		"unmatch": {
+			path:   "a/b/c.doc",
+			expect: false,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := (asciidocGenerator{}).Match(c.path); got != c.expect {
+				t.Errorf("got %v, but want %v\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestAsciidocGenerate(t *testing.T) {
+	files := StaticFunc(func(path string) io.ReadCloser {
+		content, found := map[string]string{
+			"part.adoc":  "included *text*\ninclude::inner.adoc[]\n",
+			"inner.adoc": "inner\n",
+			"code.go":    "x := 1\n",
+			"cycle.adoc": "include::cycle.adoc[]\n",
+		}[path]
+		if !found {
+			return staticError{&os.PathError{Op: "static", Path: path, Err: os.ErrNotExist}}
+		}
+		return ioutil.NopCloser(strings.NewReader(content))
+	})
+
+	for name, c := range map[string]struct {
+		input        string
+		expectErr    error
+		expectResult Poster
+	}{
+		"normal": {
+			input: "= hello world\nJane Doe <jane@example.com>\nv1.0, 2012-12-01: first\n:tags: tag1, tag2\n\n== Title *hello*\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				tags:    []string{"tag1", "tag2"},
+				content: "<h2 id=\"title-hello\">Title <strong>hello</strong></h2>\n",
+				toc: []*Heading{
+					{Level: 2, Title: "Title hello", Anchor: "title-hello"},
+				},
+			}),
+		},
+		"attributes": {
+			input: "= hello world\n:revdate: 2012-12-01\n:draft: true\n:slug: Hello Go\n:updated: 2013-01-02\n",
+			expectResult: newPost(meta{
+				key:     "Hello_Go",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				updated: parseTime("2013-01-02"),
+				draft:   true,
+			}),
+		},
+		"inline": {
+			input: "= t\n:revdate: 2012-12-01\n:name: Go\n\n// a comment\n*bold*, _em_, `a<b`, **un**con, a*b*c, {name} and {unknown}\nlink:/a[A] https://go.dev[Go], https://x.org.\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<p><strong>bold</strong>, <em>em</em>, <code>a&lt;b</code>, <strong>un</strong>con, a*b*c, Go and {unknown}\n" +
+					"<a href=\"/a\">A</a> <a href=\"https://go.dev\">Go</a>, <a href=\"https://x.org\">https://x.org</a>.</p>\n",
+			}),
+		},
+		"lists": {
+			input: "= t\n:revdate: 2012-12-01\n\n* one\n** a\n** b\n* two\nmore\n\n//\n. first\n. second\n",
+			expectResult: newPost(meta{
+				key:     "t",
+				title:   "t",
+				date:    parseTime("2012-12-01"),
+				content: "<ul>\n<li>one\n<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n</li>\n<li>two\nmore</li>\n</ul>\n<ol>\n<li>first</li>\n<li>second</li>\n</ol>\n",
+			}),
+		},
+		"admonitions": {
+			input: "= t\n:revdate: 2012-12-01\n\nNOTE: be _careful_\n\n[WARNING]\n====\ndon't\n====\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<div class=\"admonition note\">\n<p class=\"title\">Note</p>\n<p>be <em>careful</em></p>\n</div>\n" +
+					"<div class=\"admonition warning\">\n<p class=\"title\">Warning</p>\n<p>don&#39;t</p>\n</div>\n",
+			}),
+		},
+		"blocks": {
+			input: "= t\n:revdate: 2012-12-01\n\n.Code\n[source,go]\n----\nx := 1\n----\n\n....\n<a>\n....\n\n____\nquoted\n____\n\n////\nhidden\n////\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<div class=\"title\">Code</div>\n" +
+					"<div class=\"code\">\n<pre class=\"numbers\"><code class=\"language-go\"><span num=\"1\">x := <span class=\"num\">1</span></span>\n</code></pre>\n</div>\n" +
+					"<div class=\"code\">\n<pre><code>&lt;a&gt;\n</code></pre>\n</div>\n" +
+					"<blockquote>\n<p>quoted</p>\n</blockquote>\n",
+			}),
+		},
+		"tables": {
+			input: "= t\n:revdate: 2012-12-01\n\n|===\n| a | *b*\n\n| 1 | 2\n|===\n\n|===\n| 3\n| 4\n|===\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<table>\n<thead>\n<tr><th>a</th><th><strong>b</strong></th></tr>\n</thead>\n<tbody>\n<tr><td>1</td><td>2</td></tr>\n</tbody>\n</table>\n" +
+					"<table>\n<tbody>\n<tr><td>3</td></tr>\n<tr><td>4</td></tr>\n</tbody>\n</table>\n",
+			}),
+		},
+		"images": {
+			input: "= t\n:revdate: 2012-12-01\n\nimage::1.png[One,300]\n\nsee image:2.png[] and image:http://x/3.png[3]\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<div class=\"image\">\n<img src=\"/images/t/1.png\" alt=\"One\" />\n</div>\n" +
+					"<p>see <img src=\"/images/t/2.png\" alt=\"\" /> and <img src=\"http://x/3.png\" alt=\"3\" /></p>\n",
+				staticList: []string{"/images/t/1.png", "/images/t/2.png"},
+			}),
+		},
+		"include": {
+			input: "= t\n:revdate: 2012-12-01\n\ninclude::part.adoc[]\n\n[source,go]\n----\ninclude::code.go[]\n----\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<p>included <strong>text</strong>\ninner</p>\n" +
+					"<div class=\"code\">\n<pre class=\"numbers\"><code class=\"language-go\"><span num=\"1\">x := <span class=\"num\">1</span></span>\n</code></pre>\n</div>\n",
+			}),
+		},
+		"includeNotExist": {
+			input:     "= t\n:revdate: 2012-12-01\n\ninclude::noexist.txt[]\n",
+			expectErr: errors.New("line 4: asciidoc: include noexist.txt: static noexist.txt: file does not exist"),
+		},
+		"includeCycle": {
+			input:     "= t\n:revdate: 2012-12-01\n\ninclude::cycle.adoc[]\n",
+			expectErr: errors.New("line 4: asciidoc: include cycle.adoc: too many nested includes"),
+		},
+		"noTitle": {
+			input:     "hello\n",
+			expectErr: errors.New("line 1: asciidoc: can't find the document title"),
+		},
+		"noDate": {
+			input:     "= t\n:tags: a\n",
+			expectErr: errors.New("line 1: asciidoc: can't find the revdate"),
+		},
+		"invalidDate": {
+			input:     "= t\n:revdate: someday\n",
+			expectErr: errors.New("line 2: invalid date \"someday\""),
+		},
+		"unterminated": {
+			input:     "= t\n:revdate: 2012-12-01\n\n----\nx\n",
+			expectErr: errors.New("line 4: asciidoc: unterminated block ----"),
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, err := asciidocGenerator{}.Generate(strings.NewReader(c.input), files)
+			if err = matchError(c.expectErr, err); err != nil {
+				t.Error(err)
+			}
+			if c.expectResult != nil && !isPosterEqual(got, c.expectResult) {
+				t.Errorf("\n\tgot result: %#v,\n\tbut want %#v\n", got, c.expectResult)
+			}
+		})
+	}
+}
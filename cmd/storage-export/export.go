@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tw4452852/storage"
+	"github.com/tw4452852/storage/feed"
+	"github.com/tw4452852/storage/handler"
+	"github.com/tw4452852/storage/sitemap"
+)
+
+// The feeds in the output directory
+const (
+	rssFile  = "feed.xml"
+	atomFile = "atom.xml"
+	jsonFile = "feed.json"
+)
+
+// redirectTmpl is the page left at a previous key of a post
+var redirectTmpl = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html><head>
+<meta charset="utf-8">
+<link rel="canonical" href="{{.}}">
+<meta http-equiv="refresh" content="0; url={{.}}">
+</head><body><a href="{{.}}">{{.}}</a></body></html>
+`))
+
+// exporter writes the pages of a storage into a directory
+type exporter struct {
+	s    storage.Storager
+	h    *handler.Handler
+	out  string
+	feed feed.Config
+	// incremental only writes the changed files and removes the stale
+	// ones, instead of writing all the files
+	incremental bool
+
+	written map[string]bool // the files of this export
+	changed int             // number of the files written
+}
+
+func newExporter(s storage.Storager, tmpl *template.Template, out string, fc feed.Config) *exporter {
+	return &exporter{
+		s:       s,
+		h:       handler.New(s, tmpl),
+		out:     filepath.Clean(out),
+		feed:    fc,
+		written: make(map[string]bool),
+	}
+}
+
+// export writes all the pages, feeds and static resources
+func (e *exporter) export(sm *sitemap.Sitemap) error {
+	result, err := e.s.Get()
+	if err != nil {
+		return err
+	}
+	sort.Sort(result)
+	posts := result.Content
+
+	pages := []string{"/", handler.TagPrefix, handler.ArchivePrefix}
+	tags := make(map[string]bool)
+	months := make(map[string]bool)
+	for _, p := range posts {
+		pages = append(pages, handler.PostPrefix+p.Key())
+		for _, tag := range p.Tags() {
+			if !tags[tag] {
+				tags[tag] = true
+				pages = append(pages, handler.TagPrefix+tag)
+			}
+		}
+		d := p.Date()
+		year := strconv.Itoa(d.Year())
+		if !months[year] {
+			months[year] = true
+			pages = append(pages, handler.ArchivePrefix+year)
+		}
+		if month := fmt.Sprintf("%s/%02d", year, d.Month()); !months[month] {
+			months[month] = true
+			pages = append(pages, handler.ArchivePrefix+month)
+		}
+	}
+	for _, page := range pages {
+		b, err := e.get(page)
+		if err != nil {
+			return err
+		}
+		if err = e.write(path.Join(page, "index.html"), b); err != nil {
+			return err
+		}
+	}
+
+	staticPrefix := storage.ImagePrefix
+	if e.h.StaticPrefix != "" {
+		staticPrefix = "/" + strings.Trim(e.h.StaticPrefix, "/") + "/"
+	}
+	for _, p := range posts {
+		for _, s := range p.StaticList() {
+			// the links may be absolute ones of a CDN
+			u, err := url.Parse(s)
+			if err != nil || !strings.HasPrefix(u.Path, staticPrefix) {
+				continue
+			}
+			b, err := e.get(u.Path)
+			if err != nil {
+				return err
+			}
+			if err = e.write(u.Path, b); err != nil {
+				return err
+			}
+		}
+		for _, alias := range storage.Aliases(p) {
+			page := path.Join(handler.PostPrefix, alias, "index.html")
+			if !strings.HasPrefix(page, handler.PostPrefix) {
+				log.Printf("export: skip the invalid alias %q of %s\n", alias, p.Key())
+				continue
+			}
+			b := new(bytes.Buffer)
+			if err := redirectTmpl.Execute(b, handler.PostURL(p.Key())); err != nil {
+				return err
+			}
+			if err := e.write(page, b.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := e.feeds(); err != nil {
+		return err
+	}
+	for name, write := range map[string]func(*bytes.Buffer) error{
+		sitemap.Path:       func(b *bytes.Buffer) error { _, err := sm.WriteTo(b); return err },
+		sitemap.RobotsPath: func(b *bytes.Buffer) error { return sm.WriteRobots(b) },
+	} {
+		b := new(bytes.Buffer)
+		if err := write(b); err != nil {
+			return err
+		}
+		if err := e.write(name, b.Bytes()); err != nil {
+			return err
+		}
+	}
+	if sm.IsIndex() {
+		for i := 1; ; i++ {
+			b := new(bytes.Buffer)
+			if _, err := sm.WritePart(b, i); err != nil {
+				break
+			}
+			if err := e.write("/sitemap-"+strconv.Itoa(i)+".xml", b.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.incremental {
+		return e.removeStale()
+	}
+	return nil
+}
+
+// feeds writes the feeds of the latest posts
+func (e *exporter) feeds() error {
+	for name, write := range map[string]func(*feed.Feed, *bytes.Buffer) error{
+		rssFile:  func(f *feed.Feed, b *bytes.Buffer) error { return f.WriteRSS(b) },
+		atomFile: func(f *feed.Feed, b *bytes.Buffer) error { return f.WriteAtom(b) },
+		jsonFile: func(f *feed.Feed, b *bytes.Buffer) error { return f.WriteJSON(b) },
+	} {
+		c := e.feed
+		c.URL = "/" + name
+		f, err := feed.New(e.s, storage.Query{}, c)
+		if err != nil {
+			return err
+		}
+		b := new(bytes.Buffer)
+		if err = write(f, b); err != nil {
+			return err
+		}
+		if err = e.write(name, b.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get gives the page of the url path served by the handler
+func (e *exporter) get(p string) ([]byte, error) {
+	w := httptest.NewRecorder()
+	e.h.ServeHTTP(w, httptest.NewRequest("GET", (&url.URL{Path: p}).RequestURI(), nil))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("get %s: %d %s", p, w.Code, strings.TrimSpace(w.Body.String()))
+	}
+	return w.Body.Bytes(), nil
+}
+
+var errOutside = errors.New("outside of the output directory")
+
+// file gives the file path of the url path in the output directory
+func (e *exporter) file(p string) (string, error) {
+	name := filepath.Join(e.out, filepath.FromSlash(path.Clean("/"+p)))
+	rel, err := filepath.Rel(e.out, name)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &os.PathError{Op: "export", Path: p, Err: errOutside}
+	}
+	return name, nil
+}
+
+// write writes the file of the url path, in the incremental mode only
+// if it's changed
+func (e *exporter) write(p string, b []byte) error {
+	name, err := e.file(p)
+	if err != nil {
+		return err
+	}
+	if e.written[name] {
+		return nil
+	}
+	e.written[name] = true
+
+	if e.incremental {
+		if old, err := ioutil.ReadFile(name); err == nil && bytes.Equal(old, b) {
+			return nil
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(name, b, 0644); err != nil {
+		return err
+	}
+	e.changed++
+	return nil
+}
+
+// removeStale removes the files not written by this export, and the
+// directories becoming empty
+func (e *exporter) removeStale() error {
+	var dirs []string
+	err := filepath.Walk(e.out, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if name != e.out {
+				dirs = append(dirs, name)
+			}
+			return nil
+		}
+		if !e.written[name] {
+			e.changed++
+			return os.Remove(name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the deepest ones first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if files, err := ioutil.ReadDir(dirs[i]); err == nil && len(files) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tw4452852/storage"
+	"github.com/tw4452852/storage/feed"
+	"github.com/tw4452852/storage/sitemap"
+)
+
+var testTemplates = template.Must(template.New("index").Parse(`{{range .Posts}}{{.Title}};{{end}}`))
+
+func init() {
+	template.Must(testTemplates.New("post").Parse(`<h1>{{.Post.Title}}</h1>`))
+	template.Must(testTemplates.New("tags").Parse(`{{range .Tags}}{{.Name}};{{end}}`))
+	template.Must(testTemplates.New("tag").Parse(`{{.Tag}}:{{range .Posts}}{{.Title}};{{end}}`))
+	template.Must(testTemplates.New("archive").Parse(`{{range .Archive}}{{.Year}}-{{.Month}};{{end}}`))
+}
+
+// files gives all the files in the directory, relative to it
+func files(t *testing.T, dir string) []string {
+	var l []string
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, name)
+			l = append(l, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(l)
+	return l
+}
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repo, out := filepath.Join(dir, "repo"), filepath.Join(dir, "out")
+	writeFile := func(name, content string) {
+		name = filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("first.md", "First | 2020-01-02 | go, web\naliases: old_first\n![a](a.png)\n")
+	writeFile("a.png", "png")
+	writeFile("second.md", "Second | 2020-02-03 | go\nhello\n")
+	config := filepath.Join(dir, "repos.json")
+	if err = ioutil.WriteFile(config, []byte(`[{"type": "local", "root": "`+repo+`"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := storage.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	<-s.Ready()
+	sm, err := sitemap.New("https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Watch(sm.Update)
+
+	export := func(incremental bool) *exporter {
+		e := newExporter(s, testTemplates, out, feed.Config{Title: "Blog", BaseURL: "https://example.com/"})
+		e.incremental = incremental
+		if err := e.export(sm); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	e := export(false)
+	expect := []string{
+		"archive/2020/01/index.html",
+		"archive/2020/02/index.html",
+		"archive/2020/index.html",
+		"archive/index.html",
+		"atom.xml",
+		"feed.json",
+		"feed.xml",
+		"images/First/a.png",
+		"index.html",
+		"posts/First/index.html",
+		"posts/Second/index.html",
+		"posts/old_first/index.html",
+		"robots.txt",
+		"sitemap.xml",
+		"tags/go/index.html",
+		"tags/index.html",
+		"tags/web/index.html",
+	}
+	if got := files(t, out); strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Fatalf("expect files:\n%s\ngot:\n%s\n", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+	}
+	if e.changed != len(expect) {
+		t.Errorf("expect %d changed files, got %d\n", len(expect), e.changed)
+	}
+	for name, content := range map[string]string{
+		"index.html":              "Second;First;",
+		"posts/First/index.html":  "<h1>First</h1>",
+		"tags/go/index.html":      "go:Second;First;",
+		"archive/2020/index.html": "2020-February;2020-January;",
+		"images/First/a.png":      "png",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("expect %s %q, got %q\n", name, content, b)
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(out, "posts", "old_first", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `url=/posts/First`) {
+		t.Errorf("expect a redirect to the post, got %q\n", b)
+	}
+
+	// nothing changed
+	if e = export(true); e.changed != 0 {
+		t.Errorf("expect no changed files, got %d\n", e.changed)
+	}
+
+	// remove a post and a stale file
+	if err = os.Remove(filepath.Join(repo, "second.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Remove(storage.StringKey("Second")); err != nil {
+		t.Fatal(err)
+	}
+	e = export(true)
+	for _, name := range []string{"posts/Second/index.html", "archive/2020/02/index.html"} {
+		if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("expect %s removed, got %v\n", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "posts", "Second")); !os.IsNotExist(err) {
+		t.Errorf("expect the empty directory removed, got %v\n", err)
+	}
+	if e.changed == 0 {
+		t.Error("expect some changed files\n")
+	}
+}
+
+func TestExporterFile(t *testing.T) {
+	e := newExporter(nil, nil, "out/", feed.Config{})
+	for p, expect := range map[string]string{
+		"/posts/a/index.html":   filepath.Join("out", "posts", "a", "index.html"),
+		"/posts/../../a":        filepath.Join("out", "a"),
+		"feed.xml":              filepath.Join("out", "feed.xml"),
+		"/":                     "",
+		"/images/../../../etc/": filepath.Join("out", "etc"),
+	} {
+		got, err := e.file(p)
+		if expect == "" {
+			if err == nil {
+				t.Errorf("expect an error for %q, got %q\n", p, got)
+			}
+			continue
+		}
+		if err != nil || got != expect {
+			t.Errorf("expect %q for %q, got %q, %v\n", expect, p, got, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Command storage-export exports the posts in a storage as a static
+// site, which can be published to any static host.
+//
+// Usage:
+//
+//	storage-export -config repos.json -templates 'templates/*.html' \
+//		-base https://example.com/ -out public [-clean | -incremental]
+//
+// The templates are the ones of the handler package, named "index",
+// "post", "tags", "tag" and "archive", which may use the functions in
+// handler.FuncMap. Every page is written as an "index.html" in the
+// directory of its url path, besides the static resources, the feeds
+// ("feed.xml", "atom.xml" and "feed.json"), the sitemap and robots.txt.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tw4452852/storage"
+	"github.com/tw4452852/storage/feed"
+	"github.com/tw4452852/storage/handler"
+	"github.com/tw4452852/storage/sitemap"
+)
+
+var (
+	configPath  = flag.String("config", "repos.json", "the config of the repositories")
+	templates   = flag.String("templates", "", "the glob of the page templates")
+	out         = flag.String("out", "public", "the output directory")
+	baseURL     = flag.String("base", "", "the absolute url of the site, e.g. https://example.com/")
+	title       = flag.String("title", "", "the title of the feeds")
+	description = flag.String("description", "", "the description of the feeds")
+	author      = flag.String("author", "", "the author of the posts")
+	clean       = flag.Bool("clean", false, "remove the output directory before exporting")
+	incremental = flag.Bool("incremental", false, "only write the changed files and remove the stale ones")
+	static      = flag.String("static", "", "the path serving the static resources, like the prefix of the repositories' staticURL")
+	timeout     = flag.Duration("timeout", time.Minute, "the time to wait for loading the repositories")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "storage-export: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *templates == "" || *baseURL == "" {
+		return errors.New("-templates and -base are required")
+	}
+	if *clean && *incremental {
+		return errors.New("-clean and -incremental can't be used together")
+	}
+	tmpl, err := template.New("").Funcs(handler.FuncMap).ParseGlob(*templates)
+	if err != nil {
+		return err
+	}
+	sm, err := sitemap.New(*baseURL)
+	if err != nil {
+		return err
+	}
+
+	s, err := storage.New(*configPath)
+	if err != nil {
+		return err
+	}
+	defer s.Destroy()
+	select {
+	case <-s.Ready():
+	case <-time.After(*timeout):
+		return errors.New("timeout waiting for the repositories")
+	}
+	s.Watch(sm.Update)
+
+	if *clean {
+		if err = os.RemoveAll(*out); err != nil {
+			return err
+		}
+	}
+	e := newExporter(s, tmpl, *out, feed.Config{
+		Title:       *title,
+		Description: *description,
+		Author:      *author,
+		BaseURL:     *baseURL,
+	})
+	e.incremental = *incremental
+	e.h.StaticPrefix = *static
+	if err = e.export(sm); err != nil {
+		return err
+	}
+	log.Printf("exported %d files, %d changed\n", len(e.written), e.changed)
+	return nil
+}
@@ -0,0 +1,322 @@
+// Command storage checks the content repositories of the storage.
+//
+// Usage:
+//
+//	storage validate [dir]     check every post in dir (default ".")
+//	storage render <file>      print a post's metadata and html
+//	storage list [-config f]   list all the posts of the config
+//	storage preview [dir]      serve the posts in dir with live reload
+//
+// validate reports the errors of the generators, with the file and
+// line if known, the missing static resources, the links to the posts
+// not in dir and the key collisions, and exits with status 1 if there
+// is any. The files excluded by the .storageignore in dir are skipped,
+// as the repositories do.
+//
+// preview serves the posts in dir, including the drafts, on -addr with
+// the templates of -templates, or simple builtin ones. An open page is
+// reloaded when its post changes, and the generator errors are shown on
+// the pages, instead of the stale post if it's the one broken.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tw4452852/storage"
+)
+
+const usage = `usage:
+	storage validate [dir]
+	storage render [-root dir] <file>
+	storage list [-config file] [-timeout d]
+	storage preview [-addr host:port] [-templates glob] [-interval d] [dir]
+`
+
+// errInvalid tells the command has reported the problems itself
+var errInvalid = errors.New("invalid posts")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "validate":
+		err = runValidate(args)
+	case "render":
+		err = runRender(args)
+	case "list":
+		err = runList(args)
+	case "preview":
+		err = runPreview(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err == errInvalid {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "storage: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	n, err := validate(os.Stdout, dir)
+	if err != nil {
+		return err
+	}
+	if n != 0 {
+		return errInvalid
+	}
+	return nil
+}
+
+// problem is a problem of a post
+type problem struct {
+	path string
+	line int // 0 if unknown
+	msg  string
+}
+
+// newProblem gives the problem of the generator's error
+func newProblem(path string, err error) problem {
+	pb := problem{path: path, msg: strings.TrimSpace(err.Error())}
+	var le *storage.LineError
+	if errors.As(err, &le) {
+		pb.line, pb.msg = le.Line, strings.TrimSpace(le.Err.Error())
+	}
+	return pb
+}
+
+func (p problem) String() string {
+	if p.line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.path, p.line, p.msg)
+	}
+	return fmt.Sprintf("%s: %s", p.path, p.msg)
+}
+
+// validate generates every post in dir, reports the problems to w and
+// gives the number of them
+func validate(w io.Writer, dir string) (int, error) {
+	var problems []problem
+	keys := make(map[string][]string)  // the files of each key
+	links := make(map[string][]string) // the linked keys of each file
+	aliases := make(map[string]bool)
+	filter, err := storage.LoadPathFilter(dir, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if excluded(filter, dir, path, info) {
+			return skipDir(info)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		p, err := storage.GenerateFile(dir, path)
+		if err != nil {
+			problems = append(problems, newProblem(path, err))
+			return nil
+		}
+		if p == nil {
+			return nil
+		}
+		keys[p.Key()] = append(keys[p.Key()], path)
+		for _, alias := range storage.Aliases(p) {
+			aliases[alias] = true
+		}
+		if l, ok := p.(storage.Linker); ok {
+			links[path] = l.Links()
+		}
+
+		// the missing static resources and the other problems
+		if w, ok := p.(storage.Warner); ok {
+			for _, msg := range w.Warnings() {
+				problems = append(problems, problem{path: path, msg: msg})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for key, paths := range keys {
+		if len(paths) < 2 {
+			continue
+		}
+		for _, path := range paths {
+			problems = append(problems, problem{
+				path: path,
+				msg:  fmt.Sprintf("key %q collides with %s", key, strings.Join(others(paths, path), ", ")),
+			})
+		}
+	}
+
+	for path, targets := range links {
+		for _, target := range targets {
+			if _, found := keys[target]; !found && !aliases[target] {
+				problems = append(problems, problem{path: path, msg: fmt.Sprintf("broken link to post %q", target)})
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].path != problems[j].path {
+			return problems[i].path < problems[j].path
+		}
+		return problems[i].line < problems[j].line
+	})
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	return len(problems), nil
+}
+
+// excluded reports whether the file or directory in the repository at
+// root is excluded by the filter
+func excluded(filter *storage.PathFilter, root, path string, info os.FileInfo) bool {
+	rel, _ := filepath.Rel(root, path)
+	rel = filepath.ToSlash(rel)
+	if info.IsDir() {
+		return rel != "." && filter.SkipDir(rel)
+	}
+	return !filter.Match(rel)
+}
+
+// skipDir gives the result of filepath.WalkFunc to skip the file
+func skipDir(info os.FileInfo) error {
+	if info.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+func others(l []string, s string) []string {
+	var o []string
+	for _, v := range l {
+		if v != s {
+			o = append(o, v)
+		}
+	}
+	return o
+}
+
+func runRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	root := fs.String("root", "", "the repository's root, the file's directory if empty")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	return render(os.Stdout, *root, fs.Arg(0))
+}
+
+// render writes the metadata and html of the post in the file
+func render(w io.Writer, root, path string) error {
+	if root == "" {
+		root = filepath.Dir(path)
+	}
+	p, err := storage.GenerateFile(root, path)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("%s: no generator for the file", path)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(tw, "Title:\t%s\n", p.Title())
+	fmt.Fprintf(tw, "Date:\t%s\n", p.Date().Format("2006-01-02"))
+	if !storage.Updated(p).Equal(p.Date()) {
+		fmt.Fprintf(tw, "Updated:\t%s\n", storage.Updated(p).Format("2006-01-02"))
+	}
+	fmt.Fprintf(tw, "Tags:\t%s\n", strings.Join(p.Tags(), ", "))
+	fmt.Fprintf(tw, "Key:\t%s\n", p.Key())
+	if aliases := storage.Aliases(p); len(aliases) != 0 {
+		fmt.Fprintf(tw, "Aliases:\t%s\n", strings.Join(aliases, ", "))
+	}
+	fmt.Fprintf(tw, "Status:\t%s\n", status(p, time.Now()))
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\n%s\n", p.Content())
+	return err
+}
+
+// status tells whether the post is published
+func status(p storage.Poster, now time.Time) string {
+	switch {
+	case storage.IsDraft(p):
+		return "draft"
+	case p.Date().After(now):
+		return "scheduled"
+	}
+	return "published"
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	config := fs.String("config", "repos.json", "the config of the repositories")
+	timeout := fs.Duration("timeout", time.Minute, "the time to wait for loading the repositories")
+	fs.Parse(args)
+
+	s, err := storage.New(*config)
+	if err != nil {
+		return err
+	}
+	defer s.Destroy()
+	select {
+	case <-s.Ready():
+	case <-time.After(*timeout):
+		return errors.New("timeout waiting for the repositories")
+	}
+	return list(os.Stdout, s)
+}
+
+// list writes a table of all the posts, including the drafts
+func list(w io.Writer, s storage.Storager) error {
+	result, err := s.Query(storage.Query{IncludeDrafts: true})
+	if err != nil {
+		return err
+	}
+	sort.Sort(result)
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tKEY\tTITLE\tTAGS\tSTATUS\tSOURCE")
+	for _, p := range result.Content {
+		var source string
+		if sr, ok := p.(storage.Sourcer); ok {
+			source = sr.Source()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Date().Format("2006-01-02"), p.Key(), p.Title(),
+			strings.Join(p.Tags(), ","), status(p, now), source)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tw4452852/storage"
+)
+
+// writeRepo writes the files into a temporary repository
+func writeRepo(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestValidate(t *testing.T) {
+	dir := writeRepo(t, map[string]string{
+		"good.md":        "Good | 2020-01-02 | go\n![a](a.png)\n",
+		"a.png":          "png",
+		"badDate.md":     "Bad | someday | go\n",
+		"badAttr.md":     "Bad attr | 2020-01-02 | \nslug: x\ndraft: maybe\n",
+		"noImage.md":     "No image | 2020-01-02 | \n![b](b.png)\n",
+		"same.md":        "Same | 2020-01-02 | \n",
+		"dir/same.md":    "Same | 2020-01-03 | \n",
+		"notes.txt":      "not a post",
+		"fragment.html":  "<div>included by the others</div>\n",
+		"badLines.md":    "Bad lines | 2020-01-02 | \n```go {5-3}\nx := 1\n```\n",
+		"bad.article":    "Title\n\n* Section\n\n.unknown x\n",
+		"dir/ok.article": "Title 2\n\n* Section\n",
+		".storageignore": "ignored/\n*.bak.md\n",
+		"ignored/bad.md": "Bad | someday | go\n",
+		"good.bak.md":    "Bad | someday | go\n",
+		"links.md":       "Links | 2020-01-02 | \n[[Good]] [[Nowhere]]\n",
+	})
+	defer os.RemoveAll(dir)
+
+	b := new(bytes.Buffer)
+	n, err := validate(b, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Replace(b.String(), dir+string(filepath.Separator), "", -1)
+	got = filepath.ToSlash(got)
+	expect := []string{
+		"bad.article:5: unknown command \".unknown x\"",
+		"badAttr.md:3: invalid draft attribute \"maybe\": strconv.ParseBool: parsing \"maybe\": invalid syntax",
+		"badDate.md:1: parsing time \"someday\" as \"2006-01-02\": cannot parse \"someday\" as \"2006\"",
+		"badLines.md: invalid line ranges \"{5-3}\": 5 is after 3",
+		"dir/same.md: key \"Same\" collides with same.md",
+		"links.md: broken link to post \"Nowhere\"",
+		"noImage.md: static resource: lstat b.png: no such file or directory",
+		"same.md: key \"Same\" collides with dir/same.md",
+	}
+	if got != strings.Join(expect, "\n")+"\n" {
+		t.Errorf("expect:\n%s\ngot:\n%s\n", strings.Join(expect, "\n"), got)
+	}
+	if n != len(expect) {
+		t.Errorf("expect %d problems, got %d\n", len(expect), n)
+	}
+}
+
+func TestRender(t *testing.T) {
+	dir := writeRepo(t, map[string]string{
+		"post.md": "Hello world | 2020-01-02 | go, web\nupdated: 2020-02-03\naliases: old\n*hi*\n",
+	})
+	defer os.RemoveAll(dir)
+
+	b := new(bytes.Buffer)
+	if err := render(b, "", filepath.Join(dir, "post.md")); err != nil {
+		t.Fatal(err)
+	}
+	expect := `Title:   Hello world
+Date:    2020-01-02
+Updated: 2020-02-03
+Tags:    go, web
+Key:     Hello_world
+Aliases: old
+Status:  published
+
+<p><em>hi</em></p>
+
+`
+	if b.String() != expect {
+		t.Errorf("expect:\n%q\ngot:\n%q\n", expect, b.String())
+	}
+
+	if err := render(b, "", filepath.Join(dir, "none.txt")); err == nil {
+		t.Error("expect an error for an unknown file\n")
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := writeRepo(t, map[string]string{
+		"a.md": "A | 2020-01-02 | go, web\n",
+		"b.md": "B | 2020-02-03 | \ndraft: true\n",
+		"c.md": "C | 2999-01-01 | \n",
+	})
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "repos.json")
+	if err := ioutil.WriteFile(config, []byte(`[{"type": "local", "root": "`+dir+`"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := storage.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	select {
+	case <-s.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("storage isn't ready in time\n")
+	}
+
+	b := new(bytes.Buffer)
+	if err = list(b, s); err != nil {
+		t.Fatal(err)
+	}
+	expect := "DATE        KEY  TITLE  TAGS    STATUS     SOURCE\n" +
+		"2999-01-01  C    C              scheduled  local:" + filepath.Join(dir, "c.md") + "\n" +
+		"2020-02-03  B    B              draft      local:" + filepath.Join(dir, "b.md") + "\n" +
+		"2020-01-02  A    A      go,web  published  local:" + filepath.Join(dir, "a.md") + "\n"
+	if b.String() != expect {
+		t.Errorf("expect:\n%s\ngot:\n%s\n", expect, b.String())
+	}
+}
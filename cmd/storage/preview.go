@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tw4452852/storage"
+	"github.com/tw4452852/storage/handler"
+)
+
+// EventsPath is where the preview pages listen for the reloads
+const EventsPath = "/_preview/events"
+
+// defaultTemplates are the page templates used without -templates
+const defaultTemplates = `
+{{define "head"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.}}</title></head><body>
+<p><a href="/">Posts</a> <a href="/tags/">Tags</a> <a href="/archive/">Archive</a></p>{{end}}
+{{define "list"}}<ul>{{range .}}
+<li>{{.Date.Format "2006-01-02"}} <a href="/posts/{{.Key}}">{{.Title}}</a>{{if isDraft .}} (draft){{end}}</li>{{end}}
+</ul>{{end}}
+{{define "index"}}{{template "head" "Posts"}}{{template "list" .Posts}}</body></html>{{end}}
+{{define "post"}}{{with .Post}}{{template "head" .Title}}
+<h1>{{.Title}}</h1>
+<p>{{.Date.Format "2006-01-02"}}{{range .Tags}} <a href="/tags/{{.}}">{{.}}</a>{{end}}{{if isDraft .}} (draft){{end}}</p>
+{{.Content | safeHTML}}{{end}}</body></html>{{end}}
+{{define "tags"}}{{template "head" "Tags"}}<ul>{{range .Tags}}
+<li><a href="/tags/{{.Name}}">{{.Name}}</a> ({{.Count}})</li>{{end}}
+</ul></body></html>{{end}}
+{{define "tag"}}{{template "head" .Tag}}<h1>{{.Tag}}</h1>{{template "list" .Posts}}</body></html>{{end}}
+{{define "archive"}}{{template "head" "Archive"}}{{range .Archive}}
+<h2>{{.Year}} {{.Month}}</h2>{{template "list" .Posts}}{{end}}</body></html>{{end}}
+`
+
+// reloadScript reloads the page when the server tells
+const reloadScript = `<script>
+new EventSource("` + EventsPath + `?page=" + encodeURIComponent(location.pathname))
+	.addEventListener("reload", function() { location.reload(); });
+</script>
+`
+
+var problemsTmpl = template.Must(template.New("problems").Parse(
+	`<pre style="color: #fff; background: #c00; padding: 1em; white-space: pre-wrap">{{range .}}{{.}}
+{{end}}</pre>
+`))
+
+// preview serves a local repository with the drafts, and reloads the
+// pages when their posts change
+type preview struct {
+	root string
+	s    *storage.Storage
+	h    *handler.Handler
+
+	mu       sync.Mutex
+	clients  map[chan struct{}]string // to the viewed keys, "" for the listings
+	problems map[string]problem       // the generator errors by the files
+	mtimes   map[string]time.Time     // of the files last checked
+}
+
+func newPreview(root string, tmpl *template.Template) *preview {
+	s := storage.NewWithConfigs(storage.Configs{{Type: "local", Root: root}})
+	p := &preview{
+		root:     root,
+		s:        s,
+		h:        handler.New(s, tmpl),
+		clients:  make(map[chan struct{}]string),
+		problems: make(map[string]problem),
+		mtimes:   make(map[string]time.Time),
+	}
+	p.h.IncludeDrafts = true
+	s.Watch(p.changed)
+	return p
+}
+
+// changed is called by the storage when a post changes, the pages of
+// the post and the listings are reloaded
+func (p *preview) changed(c storage.Change) {
+	p.reload(func(key string) bool { return key == "" || key == c.Key })
+}
+
+// reload tells the clients whose viewed key is chosen to reload
+func (p *preview) reload(choose func(key string) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ch, key := range p.clients {
+		if !choose(key) {
+			continue
+		}
+		select {
+		case ch <- struct{}{}:
+		default:
+			// a reload is pending already
+		}
+	}
+}
+
+// check generates the changed files in the repository to find out the
+// generator errors, which the storage only logs
+func (p *preview) check() {
+	seen := make(map[string]bool)
+	changed := false
+	filter, err := storage.LoadPathFilter(p.root, nil, nil)
+	if err != nil {
+		log.Printf("load the filter: %s\n", err)
+	}
+	filepath.Walk(p.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if excluded(filter, p.root, path, info) {
+			return skipDir(info)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		seen[path] = true
+		p.mu.Lock()
+		mtime, found := p.mtimes[path]
+		p.mu.Unlock()
+		if found && !info.ModTime().After(mtime) {
+			return nil
+		}
+
+		_, err = storage.GenerateFile(p.root, path)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.mtimes[path] = info.ModTime()
+		_, had := p.problems[path]
+		if err != nil {
+			rel, _ := filepath.Rel(p.root, path)
+			p.problems[path] = newProblem(rel, err)
+			changed = true
+		} else if had {
+			delete(p.problems, path)
+			changed = true
+		}
+		return nil
+	})
+
+	p.mu.Lock()
+	for path := range p.mtimes {
+		if !seen[path] {
+			delete(p.mtimes, path)
+			if _, had := p.problems[path]; had {
+				delete(p.problems, path)
+				changed = true
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if changed {
+		p.reload(func(string) bool { return true })
+	}
+}
+
+// watch checks the repository every interval
+func (p *preview) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		p.check()
+	}
+}
+
+// sortedProblems gives all the problems, the one of path first, and
+// tells whether path has one
+func (p *preview) sortedProblems(path string) ([]problem, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l := make([]problem, 0, len(p.problems))
+	for name, pb := range p.problems {
+		if name != path {
+			l = append(l, pb)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].path < l[j].path })
+	pb, found := p.problems[path]
+	if found {
+		l = append([]problem{pb}, l...)
+	}
+	return l, found
+}
+
+// sourcePath gives the file of the post with the key
+func (p *preview) sourcePath(key string) string {
+	result, err := p.s.Query(storage.Query{Keys: []storage.Keyer{storage.StringKey(key)}, IncludeDrafts: true})
+	if err != nil {
+		return ""
+	}
+	if sr, ok := result.Content[0].(storage.Sourcer); ok {
+		return strings.TrimPrefix(sr.Source(), "local:")
+	}
+	return ""
+}
+
+// viewedKey gives the key of the post in the page, "" if not a post
+func viewedKey(page string) string {
+	if !strings.HasPrefix(page, handler.PostPrefix) {
+		return ""
+	}
+	key, err := url.PathUnescape(strings.TrimPrefix(page, handler.PostPrefix))
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+func (p *preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == EventsPath {
+		p.serveEvents(w, r)
+		return
+	}
+
+	// always the latest version
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+	w.Header().Set("Cache-Control", "no-store")
+
+	var path string
+	key := viewedKey(r.URL.Path)
+	if key != "" {
+		path = p.sourcePath(key)
+	}
+	problems, broken := p.sortedProblems(path)
+	banner := new(bytes.Buffer)
+	if len(problems) != 0 {
+		if err := problemsTmpl.Execute(banner, problems); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// show the error instead of the stale post
+	if broken {
+		servePage(w, http.StatusInternalServerError, banner.String())
+		return
+	}
+
+	rec := httptest.NewRecorder()
+	p.h.ServeHTTP(rec, r)
+	// the post may not be generated yet, e.g. a new one whose first
+	// version is broken, the page waits for it
+	if rec.Code == http.StatusNotFound && key != "" {
+		body := banner.String()
+		if body == "" {
+			body = "<p>" + template.HTMLEscapeString(key) + " isn't found.</p>\n"
+		}
+		servePage(w, http.StatusNotFound, body)
+		return
+	}
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	body := rec.Body.Bytes()
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		body = inject(body, banner.String(), reloadScript)
+		w.Header().Del("Content-Length")
+		w.Header().Del("ETag")
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(body)
+}
+
+// servePage writes a page of the body, which is reloaded like the
+// others
+func servePage(w http.ResponseWriter, code int, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"></head><body>\n%s%s</body></html>\n", body, reloadScript)
+}
+
+// inject adds the banner at the beginning of the body and the script at
+// the end of the page
+func inject(page []byte, banner, script string) []byte {
+	s := string(page)
+	if i := strings.Index(strings.ToLower(s), "<body>"); i >= 0 {
+		i += len("<body>")
+		s = s[:i] + "\n" + banner + s[i:]
+	} else {
+		s = banner + s
+	}
+	if i := strings.LastIndex(strings.ToLower(s), "</body>"); i >= 0 {
+		s = s[:i] + script + s[i:]
+	} else {
+		s += script
+	}
+	return []byte(s)
+}
+
+// serveEvents pushes a "reload" event once the page should be reloaded
+func (p *preview) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan struct{}, 1)
+	p.mu.Lock()
+	p.clients[ch] = viewedKey(r.URL.Query().Get("page"))
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.clients, ch)
+		p.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-ch:
+			fmt.Fprint(w, "event: reload\ndata: reload\n\n")
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func runPreview(args []string) error {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "the address to listen on")
+	templates := fs.String("templates", "", "the glob of the page templates, the builtin ones if empty")
+	interval := fs.Duration("interval", 500*time.Millisecond, "the interval of checking the files")
+	fs.Parse(args)
+	root := "."
+	if fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+	if fi, err := os.Stat(root); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return errors.New("the repository must be a directory")
+	}
+
+	tmpl := template.New("").Funcs(handler.FuncMap)
+	var err error
+	if *templates != "" {
+		tmpl, err = tmpl.ParseGlob(*templates)
+	} else {
+		tmpl, err = tmpl.Parse(defaultTemplates)
+	}
+	if err != nil {
+		return err
+	}
+
+	p := newPreview(root, tmpl)
+	defer p.s.Destroy()
+	p.check()
+	go p.watch(*interval)
+
+	log.Printf("previewing %s on http://%s/\n", root, *addr)
+	return http.ListenAndServe(*addr, p)
+}
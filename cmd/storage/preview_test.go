@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tw4452852/storage"
+	"github.com/tw4452852/storage/handler"
+)
+
+func newTestPreview(t *testing.T, dir string) *preview {
+	tmpl := template.Must(template.New("").Funcs(handler.FuncMap).Parse(defaultTemplates))
+	p := newPreview(dir, tmpl)
+	select {
+	case <-p.s.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("storage isn't ready in time\n")
+	}
+	p.check()
+	return p
+}
+
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestPreviewPages(t *testing.T) {
+	dir := writeRepo(t, map[string]string{
+		"post.md":  "Hello | 2020-01-02 | go\n*hi*\n",
+		"draft.md": "Draft | 2020-01-03 | \ndraft: true\nwip\n",
+	})
+	defer os.RemoveAll(dir)
+	p := newTestPreview(t, dir)
+	defer p.s.Destroy()
+
+	code, body := get(t, p, "/posts/Hello")
+	if code != http.StatusOK || !strings.Contains(body, "<em>hi</em>") || !strings.Contains(body, reloadScript+"</body>") {
+		t.Errorf("unexpected post page %d:\n%s\n", code, body)
+	}
+	if code, body = get(t, p, "/posts/Draft"); code != http.StatusOK || !strings.Contains(body, "wip") {
+		t.Errorf("unexpected draft page %d:\n%s\n", code, body)
+	}
+
+	// break the post, the storage keeps the stale version
+	path := filepath.Join(dir, "post.md")
+	if err := ioutil.WriteFile(path, []byte("Hello | someday | go\n*hi*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	p.check()
+
+	code, body = get(t, p, "/posts/Hello")
+	if code != http.StatusInternalServerError || strings.Contains(body, "<em>hi</em>") ||
+		!strings.Contains(body, "post.md:1: parsing time") || !strings.Contains(body, reloadScript) {
+		t.Errorf("unexpected broken post page %d:\n%s\n", code, body)
+	}
+	code, body = get(t, p, "/")
+	if code != http.StatusOK || !strings.Contains(body, "post.md:1: parsing time") || !strings.Contains(body, "Draft") {
+		t.Errorf("unexpected index page %d:\n%s\n", code, body)
+	}
+
+	// fix it again
+	if err := ioutil.WriteFile(path, []byte("Hello | 2020-01-02 | go\n*hi*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	p.check()
+	if code, body = get(t, p, "/"); strings.Contains(body, "parsing time") {
+		t.Errorf("unexpected fixed index page %d:\n%s\n", code, body)
+	}
+}
+
+func TestPreviewNotFound(t *testing.T) {
+	dir := writeRepo(t, map[string]string{
+		"new.md": "New | someday | go\n",
+	})
+	defer os.RemoveAll(dir)
+	p := newTestPreview(t, dir)
+	defer p.s.Destroy()
+
+	// the first version of the new post is broken
+	code, body := get(t, p, "/posts/New")
+	if code != http.StatusNotFound || !strings.Contains(body, "new.md:1: parsing time") ||
+		!strings.Contains(body, reloadScript) {
+		t.Errorf("unexpected page of the broken new post %d:\n%s\n", code, body)
+	}
+	code, body = get(t, p, "/posts/None")
+	if code != http.StatusNotFound || !strings.Contains(body, reloadScript) {
+		t.Errorf("unexpected page of the unknown post %d:\n%s\n", code, body)
+	}
+}
+
+func TestPreviewReload(t *testing.T) {
+	p := &preview{clients: make(map[chan struct{}]string)}
+	post, other, listing := make(chan struct{}, 1), make(chan struct{}, 1), make(chan struct{}, 1)
+	p.clients[post] = "A"
+	p.clients[other] = "B"
+	p.clients[listing] = ""
+
+	p.changed(storage.Change{Key: "A"})
+	p.changed(storage.Change{Key: "A"}) // doesn't block
+	for name, c := range map[string]struct {
+		ch     chan struct{}
+		expect bool
+	}{
+		"post":    {post, true},
+		"other":   {other, false},
+		"listing": {listing, true},
+	} {
+		select {
+		case <-c.ch:
+			if !c.expect {
+				t.Errorf("%s: unexpected reload\n", name)
+			}
+		default:
+			if c.expect {
+				t.Errorf("%s: expect a reload\n", name)
+			}
+		}
+	}
+}
+
+func TestPreviewEvents(t *testing.T) {
+	p := &preview{clients: make(map[chan struct{}]string)}
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + EventsPath + "?page=/posts/a%20b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q\n", ct)
+	}
+	p.mu.Lock()
+	var key string
+	for _, key = range p.clients {
+	}
+	p.mu.Unlock()
+	if key != "a b" {
+		t.Fatalf("unexpected viewed key %q\n", key)
+	}
+
+	p.changed(storage.Change{Key: "a b"})
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "event: reload\n" {
+		t.Errorf("unexpected event %q\n", line)
+	}
+}
+
+func TestInject(t *testing.T) {
+	for name, c := range map[string]struct {
+		page, expect string
+	}{
+		"body":   {"<html><BODY>x</BODY></html>", "<html><BODY>\n[b]x[s]</BODY></html>"},
+		"noBody": {"x", "[b]x[s]"},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := string(inject([]byte(c.page), "[b]", "[s]")); got != c.expect {
+				t.Errorf("expect %q, got %q\n", c.expect, got)
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ var (
 func (nopStorage) Add(...Poster) error           { return nil }
 func (nopStorage) Destroy()                      {}
 func (nopStorage) Get(...Keyer) (*Result, error) { return nil, nil }
+func (nopStorage) Query(Query) (*Result, error)  { return nil, nil }
 func (nopStorage) Remove(...Keyer) error         { return nil }
 
 func matchError(expect, real error) error {
@@ -66,6 +67,24 @@ func isPosterEqual(a, b Poster) bool {
 	if !reflect.DeepEqual(a.StaticList(), b.StaticList()) {
 		return false
 	}
+	if IsDraft(a) != IsDraft(b) {
+		return false
+	}
+	if Summary(a) != Summary(b) {
+		return false
+	}
+	if WordCount(a) != WordCount(b) {
+		return false
+	}
+	if !reflect.DeepEqual(TOC(a), TOC(b)) {
+		return false
+	}
+	if !reflect.DeepEqual(Aliases(a), Aliases(b)) {
+		return false
+	}
+	if !Updated(a).Equal(Updated(b)) {
+		return false
+	}
 
 	return true
 }
@@ -11,6 +11,27 @@ type Config struct {
 	Root     string `json:"root"`
 	User     string `json:"username"`
 	Password string `json:"password"`
+	// Trust is the trust level of the posts' html, TrustFull if empty
+	Trust string `json:"trust"`
+	// Strict only serves the static resources in the posts' StaticList
+	Strict bool `json:"strict"`
+	// Namespace prefixes the keys of the repository's posts
+	Namespace string `json:"namespace"`
+	// Include and Exclude are the patterns of PathFilter to choose the
+	// repository's files, besides the ones in its IgnoreFile
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Generators maps the extensions to the names of the generators,
+	// like {".txt": "markdown"}, and Sniff sniffs the content of the
+	// files without an extension, see GeneratorMap
+	Generators map[string]string `json:"generators"`
+	Sniff      bool              `json:"sniff"`
+	// Markdown and Present are the options of the generators for the
+	// repository, the defaults are used if nil
+	Markdown *MarkdownOptions `json:"markdown"`
+	Present  *PresentOptions  `json:"present"`
+	// StaticURL is the scheme of the links of the static resources
+	StaticURL StaticURL `json:"staticURL"`
 }
 
 type Configs []*Config
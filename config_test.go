@@ -15,10 +15,10 @@ func TestConfig(t *testing.T) {
 			"./testdata/config.json",
 			nil,
 			Configs{
-				{"git", "http://github.com/1/1", "tw", "123"},
-				{"local", "/tmp/1/1", "", ""},
-				{"local", "tmp/1/1", "", ""},
-				{"github", "http://github.com/2/2", "", "321"},
+				{Type: "git", Root: "http://github.com/1/1", User: "tw", Password: "123"},
+				{Type: "local", Root: "/tmp/1/1"},
+				{Type: "local", Root: "tmp/1/1", Trust: "full"},
+				{Type: "github", Root: "http://github.com/2/2", Password: "321"},
 			},
 		},
 
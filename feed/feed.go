@@ -0,0 +1,336 @@
+// Package feed generates the RSS 2.0, Atom 1.0 and JSON Feed 1.1
+// documents of the posts in a storage.
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tw4452852/storage"
+	"github.com/tw4452852/storage/handler"
+)
+
+// The content types of the documents
+const (
+	RSSType  = "application/rss+xml; charset=utf-8"
+	AtomType = "application/atom+xml; charset=utf-8"
+	JSONType = "application/feed+json; charset=utf-8"
+)
+
+// DefaultLimit is the number of posts in a feed if not specified
+const DefaultLimit = 20
+
+// Config describes a feed
+type Config struct {
+	// Title of the feed
+	Title string
+	// Description of the feed
+	Description string
+	// Author of the posts
+	Author string
+	// BaseURL is the absolute url of the site, e.g. "https://example.com/",
+	// all the links in the feed are relative to it
+	BaseURL string
+	// URL is the url of the feed itself, which may be relative to BaseURL
+	URL string
+}
+
+// Feed is a feed of some posts
+type Feed struct {
+	config  Config
+	base    *url.URL
+	self    string
+	updated time.Time
+	posts   []storage.Poster
+}
+
+// New creates a feed of the posts given by the query, which are the
+// latest DefaultLimit posts if the query has no limit.
+func New(s storage.Storager, q storage.Query, c Config) (*Feed, error) {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !base.IsAbs() {
+		return nil, errors.New("feed: base url must be absolute\n")
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	result, err := s.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Feed{
+		config: c,
+		base:   base,
+		posts:  result.Content,
+	}
+	if c.URL != "" {
+		f.self = f.abs(c.URL)
+	}
+	for _, p := range f.posts {
+		if d := storage.Updated(p); d.After(f.updated) {
+			f.updated = d
+		}
+	}
+	return f, nil
+}
+
+// abs resolves the url against the base url
+func (f *Feed) abs(u string) string {
+	ref, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	// a root relative url keeps the path of the base url
+	if strings.HasPrefix(ref.Path, "/") && ref.Host == "" && ref.Scheme == "" {
+		ref.Path = strings.TrimSuffix(f.base.Path, "/") + ref.Path
+		ref.RawPath = ""
+	}
+	return f.base.ResolveReference(ref).String()
+}
+
+func (f *Feed) link(p storage.Poster) string {
+	return f.abs(handler.PostURL(p.Key()))
+}
+
+// content gives the html of a post with absolute urls, the relative
+// ones are resolved against the post's link
+func (f *Feed) content(p storage.Poster, html string) string {
+	link, _ := url.Parse(f.link(p))
+	return storage.RewriteURLs(html, func(u string) string {
+		ref, err := url.Parse(u)
+		if err != nil || ref.IsAbs() || ref.Host != "" {
+			return u
+		}
+		if strings.HasPrefix(ref.Path, "/") {
+			return f.abs(u)
+		}
+		return link.ResolveReference(ref).String()
+	})
+}
+
+func (f *Feed) author() string {
+	if f.config.Author != "" {
+		return f.config.Author
+	}
+	return f.config.Title
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr,omitempty"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	AtomLink      *atomLink  `xml:"atom:link,omitempty"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// WriteRSS writes the feed in RSS 2.0
+func (f *Feed) WriteRSS(w io.Writer) error {
+	doc := &rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.config.Title,
+			Link:        f.base.String(),
+			Description: f.config.Description,
+		},
+	}
+	if f.self != "" {
+		doc.Atom = atomNS
+		doc.Channel.AtomLink = &atomLink{Href: f.self, Rel: "self", Type: strings.Split(RSSType, ";")[0]}
+	}
+	if !f.updated.IsZero() {
+		doc.Channel.LastBuildDate = f.updated.Format(time.RFC1123Z)
+	}
+	for _, p := range f.posts {
+		link := f.link(p)
+		doc.Channel.Items = append(doc.Channel.Items, &rssItem{
+			Title:       p.Title(),
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     p.Date().Format(time.RFC1123Z),
+			Categories:  p.Tags(),
+			Description: f.content(p, p.Content()),
+		})
+	}
+	return writeXML(w, doc)
+}
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+type atom struct {
+	XMLName  xml.Name     `xml:"feed"`
+	NS       string       `xml:"xmlns,attr"`
+	Title    string       `xml:"title"`
+	Subtitle string       `xml:"subtitle,omitempty"`
+	ID       string       `xml:"id"`
+	Updated  string       `xml:"updated"`
+	Links    []atomLink   `xml:"link"`
+	Author   atomAuthor   `xml:"author"`
+	Entries  []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    atomText       `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteAtom writes the feed in Atom 1.0
+func (f *Feed) WriteAtom(w io.Writer) error {
+	doc := &atom{
+		NS:       atomNS,
+		Title:    f.config.Title,
+		Subtitle: f.config.Description,
+		ID:       f.base.String(),
+		Updated:  f.updated.Format(time.RFC3339),
+		Links:    []atomLink{{Href: f.base.String(), Rel: "alternate"}},
+		Author:   atomAuthor{f.author()},
+	}
+	if f.self != "" {
+		doc.ID = f.self
+		doc.Links = append(doc.Links, atomLink{Href: f.self, Rel: "self", Type: strings.Split(AtomType, ";")[0]})
+	}
+	for _, p := range f.posts {
+		link := f.link(p)
+		e := &atomEntry{
+			Title:     p.Title(),
+			ID:        link,
+			Link:      atomLink{Href: link, Rel: "alternate"},
+			Published: p.Date().Format(time.RFC3339),
+			Updated:   storage.Updated(p).Format(time.RFC3339),
+			Content:   atomText{"html", f.content(p, p.Content())},
+		}
+		for _, tag := range p.Tags() {
+			e.Categories = append(e.Categories, atomCategory{tag})
+		}
+		if s := storage.Summary(p); s != p.Content() {
+			e.Summary = &atomText{"html", f.content(p, s)}
+		}
+		doc.Entries = append(doc.Entries, e)
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type jsonFeed struct {
+	Version     string          `json:"version"`
+	Title       string          `json:"title"`
+	HomePageURL string          `json:"home_page_url"`
+	FeedURL     string          `json:"feed_url,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Authors     []jsonAuthor    `json:"authors,omitempty"`
+	Items       []*jsonFeedItem `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentHTML   string   `json:"content_html"`
+	DatePublished string   `json:"date_published"`
+	DateModified  string   `json:"date_modified"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// WriteJSON writes the feed in JSON Feed 1.1
+func (f *Feed) WriteJSON(w io.Writer) error {
+	doc := &jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.config.Title,
+		HomePageURL: f.base.String(),
+		FeedURL:     f.self,
+		Description: f.config.Description,
+		Items:       make([]*jsonFeedItem, 0, len(f.posts)),
+	}
+	if f.config.Author != "" {
+		doc.Authors = []jsonAuthor{{f.config.Author}}
+	}
+	for _, p := range f.posts {
+		link := f.link(p)
+		item := &jsonFeedItem{
+			ID:            link,
+			URL:           link,
+			Title:         p.Title(),
+			ContentHTML:   f.content(p, p.Content()),
+			DatePublished: p.Date().Format(time.RFC3339),
+			DateModified:  storage.Updated(p).Format(time.RFC3339),
+			Tags:          p.Tags(),
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(doc)
+}
@@ -0,0 +1,346 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tw4452852/storage"
+)
+
+type post struct {
+	key     string
+	title   string
+	date    time.Time
+	tags    []string
+	content string
+	summary string
+}
+
+func (p *post) Key() string                 { return p.key }
+func (p *post) Title() string               { return p.title }
+func (p *post) Date() time.Time             { return p.date }
+func (p *post) Tags() []string              { return p.tags }
+func (p *post) Content() string             { return p.content }
+func (p *post) IsSlide() bool               { return false }
+func (p *post) IsDraft() bool               { return false }
+func (p *post) WordCount() int              { return 0 }
+func (p *post) ReadingTime() time.Duration  { return 0 }
+func (p *post) TOC() []*storage.Heading     { return nil }
+func (p *post) Aliases() []string           { return nil }
+func (p *post) Updated() time.Time          { return p.date }
+func (p *post) StaticList() []string        { return nil }
+func (p *post) Static(string) io.ReadCloser { return nil }
+func (p *post) Summary() string {
+	if p.summary == "" {
+		return p.content
+	}
+	return p.summary
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func newTestFeed(t *testing.T, q storage.Query) *Feed {
+	s, err := storage.New("../testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add(
+		&post{
+			key:     "first",
+			title:   "First",
+			date:    parseTime("2020-01-02"),
+			tags:    []string{"go"},
+			content: `<p><img src="/images/first/a.png"> <a href="b.html">b</a> <a href="#top">top</a></p>`,
+		},
+		&post{
+			key:     "second",
+			title:   "Second & more",
+			date:    parseTime("2020-02-03"),
+			tags:    []string{"go", "web"},
+			content: `<p>intro</p><p><a href="https://other.com/x">x</a></p>`,
+			summary: `<p>intro</p>`,
+		},
+		&post{
+			key:     "third",
+			title:   "Third",
+			date:    parseTime("2019-03-04"),
+			content: `<p>third</p>`,
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(s, q, Config{
+		Title:       "Blog",
+		Description: "a blog",
+		Author:      "tw",
+		BaseURL:     "https://example.com/blog/",
+		URL:         "/feed.xml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestNewError(t *testing.T) {
+	s, err := storage.New("../testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(s, storage.Query{}, Config{BaseURL: "/relative"}); err == nil {
+		t.Error("expect an error for a relative base url\n")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	for name, c := range map[string]struct {
+		query  storage.Query
+		expect []string
+	}{
+		"latest": {
+			expect: []string{"second", "first", "third"},
+		},
+		"limit": {
+			query:  storage.Query{Limit: 1},
+			expect: []string{"second"},
+		},
+		"tag": {
+			query:  storage.Query{Tag: "go"},
+			expect: []string{"second", "first"},
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			f := newTestFeed(t, c.query)
+			var keys []string
+			for _, p := range f.posts {
+				keys = append(keys, p.Key())
+			}
+			if !reflect.DeepEqual(keys, c.expect) {
+				t.Errorf("expect %v, got %v\n", c.expect, keys)
+			}
+		})
+	}
+}
+
+const firstContent = `<p><img src="https://example.com/blog/images/first/a.png"> ` +
+	`<a href="https://example.com/blog/posts/b.html">b</a> ` +
+	`<a href="https://example.com/blog/posts/first#top">top</a></p>`
+
+func TestRSS(t *testing.T) {
+	f := newTestFeed(t, storage.Query{Tag: "go"})
+	b := new(bytes.Buffer)
+	if err := f.WriteRSS(b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), xml.Header) {
+		t.Errorf("expect the xml header, got %q\n", b.String())
+	}
+
+	var doc struct {
+		XMLName xml.Name
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+			// the link and the atom:link
+			Links []struct {
+				XMLName xml.Name
+				Href    string `xml:"href,attr"`
+				Rel     string `xml:"rel,attr"`
+				Value   string `xml:",chardata"`
+			} `xml:"link"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title string `xml:"title"`
+				Link  string `xml:"link"`
+				GUID  struct {
+					IsPermaLink string `xml:"isPermaLink,attr"`
+					Value       string `xml:",chardata"`
+				} `xml:"guid"`
+				PubDate     string   `xml:"pubDate"`
+				Categories  []string `xml:"category"`
+				Description string   `xml:"description"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	ch := doc.Channel
+	if len(ch.Links) != 2 {
+		t.Fatalf("expect 2 links, got %d\n", len(ch.Links))
+	}
+	for _, c := range [][2]string{
+		{doc.XMLName.Local, "rss"},
+		{doc.Version, "2.0"},
+		{ch.Title, "Blog"},
+		{ch.Links[0].Value, "https://example.com/blog/"},
+		{ch.Description, "a blog"},
+		{ch.LastBuildDate, "Mon, 03 Feb 2020 00:00:00 +0000"},
+		{ch.Links[1].XMLName.Space, "http://www.w3.org/2005/Atom"},
+		{ch.Links[1].Href, "https://example.com/blog/feed.xml"},
+		{ch.Links[1].Rel, "self"},
+	} {
+		if c[0] != c[1] {
+			t.Errorf("expect %q, got %q\n", c[1], c[0])
+		}
+	}
+	if len(ch.Items) != 2 {
+		t.Fatalf("expect 2 items, got %d\n", len(ch.Items))
+	}
+	second, first := ch.Items[0], ch.Items[1]
+	for _, c := range [][2]string{
+		{second.Title, "Second & more"},
+		{second.Link, "https://example.com/blog/posts/second"},
+		{second.GUID.Value, "https://example.com/blog/posts/second"},
+		{second.GUID.IsPermaLink, "true"},
+		{second.PubDate, "Mon, 03 Feb 2020 00:00:00 +0000"},
+		{strings.Join(second.Categories, ","), "go,web"},
+		{first.Description, firstContent},
+	} {
+		if c[0] != c[1] {
+			t.Errorf("expect %q, got %q\n", c[1], c[0])
+		}
+	}
+}
+
+func TestAtom(t *testing.T) {
+	f := newTestFeed(t, storage.Query{Tag: "go"})
+	b := new(bytes.Buffer)
+	if err := f.WriteAtom(b); err != nil {
+		t.Fatal(err)
+	}
+
+	type link struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	}
+	type text struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	}
+	var doc struct {
+		XMLName xml.Name
+		Title   string `xml:"title"`
+		ID      string `xml:"id"`
+		Updated string `xml:"updated"`
+		Links   []link `xml:"link"`
+		Author  struct {
+			Name string `xml:"name"`
+		} `xml:"author"`
+		Entries []struct {
+			Title      string `xml:"title"`
+			ID         string `xml:"id"`
+			Link       link   `xml:"link"`
+			Published  string `xml:"published"`
+			Updated    string `xml:"updated"`
+			Categories []struct {
+				Term string `xml:"term,attr"`
+			} `xml:"category"`
+			Summary *text `xml:"summary"`
+			Content text  `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.XMLName.Space != "http://www.w3.org/2005/Atom" || doc.XMLName.Local != "feed" {
+		t.Errorf("expect an atom feed, got %v\n", doc.XMLName)
+	}
+	expectLinks := []link{
+		{"https://example.com/blog/", "alternate"},
+		{"https://example.com/blog/feed.xml", "self"},
+	}
+	if !reflect.DeepEqual(doc.Links, expectLinks) {
+		t.Errorf("expect links %v, got %v\n", expectLinks, doc.Links)
+	}
+	for _, c := range [][2]string{
+		{doc.Title, "Blog"},
+		{doc.ID, "https://example.com/blog/feed.xml"},
+		{doc.Updated, "2020-02-03T00:00:00Z"},
+		{doc.Author.Name, "tw"},
+	} {
+		if c[0] != c[1] {
+			t.Errorf("expect %q, got %q\n", c[1], c[0])
+		}
+	}
+	if len(doc.Entries) != 2 {
+		t.Fatalf("expect 2 entries, got %d\n", len(doc.Entries))
+	}
+	second, first := doc.Entries[0], doc.Entries[1]
+	if second.Summary == nil || second.Summary.Value != "<p>intro</p>" {
+		t.Errorf("expect the summary of the second entry, got %v\n", second.Summary)
+	}
+	if first.Summary != nil {
+		t.Errorf("expect no summary of the first entry, got %v\n", first.Summary)
+	}
+	for _, c := range [][2]string{
+		{second.ID, "https://example.com/blog/posts/second"},
+		{second.Link.Href, "https://example.com/blog/posts/second"},
+		{second.Published, "2020-02-03T00:00:00Z"},
+		{second.Updated, "2020-02-03T00:00:00Z"},
+		{second.Categories[1].Term, "web"},
+		{first.Content.Type, "html"},
+		{first.Content.Value, firstContent},
+	} {
+		if c[0] != c[1] {
+			t.Errorf("expect %q, got %q\n", c[1], c[0])
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	f := newTestFeed(t, storage.Query{Limit: 2})
+	b := new(bytes.Buffer)
+	if err := f.WriteJSON(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for key, expect := range map[string]interface{}{
+		"version":       "https://jsonfeed.org/version/1.1",
+		"title":         "Blog",
+		"home_page_url": "https://example.com/blog/",
+		"feed_url":      "https://example.com/blog/feed.xml",
+		"description":   "a blog",
+		"authors":       []interface{}{map[string]interface{}{"name": "tw"}},
+	} {
+		if !reflect.DeepEqual(doc[key], expect) {
+			t.Errorf("expect %s %v, got %v\n", key, expect, doc[key])
+		}
+	}
+
+	items, _ := doc["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("expect 2 items, got %v\n", doc["items"])
+	}
+	first := items[1].(map[string]interface{})
+	for key, expect := range map[string]interface{}{
+		"id":             "https://example.com/blog/posts/first",
+		"url":            "https://example.com/blog/posts/first",
+		"title":          "First",
+		"content_html":   firstContent,
+		"date_published": "2020-01-02T00:00:00Z",
+		"tags":           []interface{}{"go"},
+	} {
+		if !reflect.DeepEqual(first[key], expect) {
+			t.Errorf("expect %s %v, got %v\n", key, expect, first[key])
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the file in a repository's root with the patterns of
+// the files to exclude, one per line, blank lines and the ones starting
+// with '#' are skipped
+const IgnoreFile = ".storageignore"
+
+// defaultExclude is always excluded
+var defaultExclude = []string{".git/"}
+
+// PathFilter chooses the files of a repository by the glob patterns of
+// their slash separated paths relative to the root. A pattern is the
+// one of path.Match, besides "**" which matches any directories. A
+// pattern with a slash, except a trailing one, is relative to the root,
+// otherwise it matches a file or directory in any directory. A trailing
+// slash only matches directories.
+type PathFilter struct {
+	Include []string // the files to include, all if empty
+	Exclude []string // the files and directories to exclude
+}
+
+// LoadPathFilter gives the filter of the patterns and the ones in the
+// IgnoreFile of the local repository at root if any
+func LoadPathFilter(root string, include, exclude []string) (*PathFilter, error) {
+	f := &PathFilter{
+		Include: include,
+		Exclude: append(append([]string(nil), defaultExclude...), exclude...),
+	}
+	file, err := os.Open(filepath.Join(root, IgnoreFile))
+	if os.IsNotExist(err) {
+		return f, f.check()
+	}
+	if err != nil {
+		return f, err
+	}
+	defer file.Close()
+	return f, f.ReadIgnore(file)
+}
+
+// ReadIgnore adds the patterns in the content of an IgnoreFile to the
+// excluded ones
+func (f *PathFilter) ReadIgnore(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f.Exclude = append(f.Exclude, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return f.check()
+}
+
+// check checks the syntax of the patterns
+func (f *PathFilter) check() error {
+	for _, l := range [][]string{f.Include, f.Exclude} {
+		for _, p := range l {
+			for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+				if _, err := path.Match(part, ""); err != nil {
+					return fmt.Errorf("invalid pattern %q: %s\n", p, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SkipDir reports whether the directory and everything in it are
+// excluded
+func (f *PathFilter) SkipDir(name string) bool {
+	return f.excluded(name, true)
+}
+
+// Match reports whether the file is chosen, the directories of it
+// are checked as well
+func (f *PathFilter) Match(name string) bool {
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if f.excluded(strings.Join(parts[:i], "/"), true) {
+			return false
+		}
+	}
+	if f.excluded(name, false) {
+		return false
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, p := range f.Include {
+		if matchPattern(p, name, false) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *PathFilter) excluded(name string, dir bool) bool {
+	for _, p := range f.Exclude {
+		if matchPattern(p, name, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports whether the pattern of PathFilter matches the
+// file or directory
+func matchPattern(pattern, name string, dir bool) bool {
+	if strings.HasSuffix(pattern, "/") {
+		if !dir {
+			return false
+		}
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if strings.HasPrefix(pattern, "/") {
+		pattern = pattern[1:]
+	} else if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return matchGlob(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchGlob matches the elements of a path with the ones of a pattern,
+// "**" matches any number of elements
+func matchGlob(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlob(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
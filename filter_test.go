@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPathFilter(t *testing.T) {
+	for name, c := range map[string]struct {
+		include, exclude []string
+		ignore           string
+		match, skip      []string // the chosen files and the skipped dirs
+		noMatch, noSkip  []string
+	}{
+		"default": {
+			match:   []string{"a.md", "a/b/c.md", "git/a.md"},
+			skip:    []string{".git", "a/.git"},
+			noMatch: []string{".git/a.md", "a/.git/b.md"},
+			noSkip:  []string{"a", "git"},
+		},
+		"exclude": {
+			exclude: []string{"*~", "node_modules/", "/drafts/**", "a/*/c.md"},
+			match:   []string{"a.md", "b/drafts/a.md", "a/b/d.md", "a/b/x/c.md", "node_modules"},
+			skip:    []string{"node_modules", "x/node_modules", "drafts", "drafts/x"},
+			noMatch: []string{"a.md~", "x/a.md~", "node_modules/a.md", "x/node_modules/y/a.md", "drafts/a.md", "a/b/c.md"},
+			noSkip:  []string{"b/drafts", "a/b"},
+		},
+		"include": {
+			include: []string{"posts/**/*.md", "*.article"},
+			exclude: []string{"posts/old/"},
+			match:   []string{"posts/a.md", "posts/x/y/a.md", "a.article", "x/a.article"},
+			skip:    []string{"posts/old"},
+			noMatch: []string{"a.md", "x/posts/a.md", "posts/a.slide", "posts/old/a.md"},
+			noSkip:  []string{"x", "posts"},
+		},
+		"ignoreFile": {
+			ignore:  "# comment\n\n  *.bak  \ntmp/\n",
+			match:   []string{"a.md", "tmp"},
+			skip:    []string{"tmp", "a/tmp"},
+			noMatch: []string{"a.md.bak", "a/tmp/a.md"},
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			f := &PathFilter{Include: c.include, Exclude: append(defaultExclude, c.exclude...)}
+			if err := f.ReadIgnore(strings.NewReader(c.ignore)); err != nil {
+				t.Fatal(err)
+			}
+			for _, l := range []struct {
+				names  []string
+				f      func(string) bool
+				expect bool
+				what   string
+			}{
+				{c.match, f.Match, true, "match"},
+				{c.noMatch, f.Match, false, "match"},
+				{c.skip, f.SkipDir, true, "skip"},
+				{c.noSkip, f.SkipDir, false, "skip"},
+			} {
+				for _, name := range l.names {
+					if got := l.f(name); got != l.expect {
+						t.Errorf("%s %q: got %v, but want %v\n", l.what, name, got, l.expect)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPathFilterInvalid(t *testing.T) {
+	f := &PathFilter{}
+	err := f.ReadIgnore(strings.NewReader("a/[b\n"))
+	if e := matchError(errors.New(`invalid pattern "a/[b"`), err); e != nil {
+		t.Error(e)
+	}
+}
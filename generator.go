@@ -1,7 +1,11 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 )
 
 type Generator interface {
@@ -11,18 +15,222 @@ type Generator interface {
 	Generate(io.Reader, Staticer) (Poster, error)
 }
 
-var generators []Generator
+// LineError is an error at a line of a post's source, which may be
+// given by Generator.Generate
+type LineError struct {
+	Line int // from 1
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
 
+// registered is a registered generator
+type registered struct {
+	name     string
+	priority int
+	gen      Generator
+}
+
+var generators []registered
+
+// RegisterGenerator registers an anonymous generator with the priority 0
 func RegisterGenerator(gen Generator) {
-	generators = append(generators, gen)
+	RegisterNamedGenerator("", 0, gen)
+}
+
+// RegisterNamedGenerator registers a generator with a name, which
+// replaces the one with the same name if any. When several generators
+// match a file, the one with the highest priority is chosen, and the
+// earlier registered one if they have the same priority.
+func RegisterNamedGenerator(name string, priority int, gen Generator) {
+	if name != "" {
+		for i := range generators {
+			if generators[i].name == name {
+				generators[i].priority, generators[i].gen = priority, gen
+				return
+			}
+		}
+	}
+	generators = append(generators, registered{name, priority, gen})
 }
 
-// FindGenerator find the first match Generator
+// UnregisterGenerator unregisters the generator with the name
+func UnregisterGenerator(name string) {
+	for i := range generators {
+		if generators[i].name == name {
+			generators = append(generators[:i], generators[i+1:]...)
+			return
+		}
+	}
+}
+
+// LookupGenerator gives the generator registered with the name, or nil
+func LookupGenerator(name string) Generator {
+	for _, r := range generators {
+		if r.name == name && name != "" {
+			return r.gen
+		}
+	}
+	return nil
+}
+
+// FindGenerator finds the matched generator with the highest priority
 func FindGenerator(filename string) Generator {
-	for _, gen := range generators {
-		if gen.Match(filename) {
-			return gen
+	return (*GeneratorMap)(nil).resolve(findGenerator(matchFile(filename)))
+}
+
+func matchFile(filename string) func(Generator) bool {
+	return func(gen Generator) bool {
+		return gen.Match(filename)
+	}
+}
+
+// Sniffer is optionally implemented by the generators to recognize
+// their sources by the leading content, which is used for the files
+// without an extension
+type Sniffer interface {
+	// Sniff reports whether the content is a source of the generator,
+	// head is at most SniffLen bytes
+	Sniff(head []byte) bool
+}
+
+// SniffLen is the max length of the leading content given to Sniff
+const SniffLen = 512
+
+// errNotPost is given when no generator recognizes a sniffed source
+var errNotPost = errors.New("not a post")
+
+// SniffGenerator finds the generator with the highest priority which
+// recognizes the leading content of a source
+func SniffGenerator(head []byte) Generator {
+	return (*GeneratorMap)(nil).SniffGenerator(head)
+}
+
+func sniffContent(head []byte) func(Generator) bool {
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+	return func(gen Generator) bool {
+		s, ok := gen.(Sniffer)
+		return ok && s.Sniff(head)
+	}
+}
+
+// findGenerator finds the registered generator with the highest
+// priority which matches
+func findGenerator(match func(Generator) bool) *registered {
+	var found *registered
+	for i, r := range generators {
+		if (found == nil || r.priority > found.priority) && match(r.gen) {
+			found = &generators[i]
+		}
+	}
+	return found
+}
+
+// GeneratorMap chooses the generators of a repository's files. The
+// extensions, like ".txt", are mapped to the names of the generators,
+// an empty name means the files aren't posts. The others are left to
+// FindGenerator, and the files without an extension are sniffed if
+// Sniff is set. Generators replaces the registered generators with the
+// same names for the repository, like the ones with some options.
+type GeneratorMap struct {
+	Extensions map[string]string
+	Sniff      bool
+	Generators map[string]Generator
+}
+
+// newGeneratorMap gives the GeneratorMap of a repository's config
+func newGeneratorMap(c *Config) (*GeneratorMap, error) {
+	gm := &GeneratorMap{
+		Extensions: c.Generators,
+		Sniff:      c.Sniff,
+		Generators: make(map[string]Generator),
+	}
+	if c.Markdown != nil {
+		gen, err := NewMarkdownGenerator(*c.Markdown)
+		if err != nil {
+			return nil, err
+		}
+		gm.Generators["markdown"] = gen
+	}
+	if c.Present != nil {
+		article, slide, err := NewPresentGenerators(*c.Present)
+		if err != nil {
+			return nil, err
+		}
+		gm.Generators["article"], gm.Generators["slide"] = article, slide
+	}
+	return gm, gm.check()
+}
+
+// check checks whether the mapped generators are registered
+func (gm *GeneratorMap) check() error {
+	for ext, name := range gm.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("invalid extension %q\n", ext)
+		}
+		if name != "" && gm.lookup(name) == nil {
+			return fmt.Errorf("unknown generator %q for %q\n", name, ext)
 		}
 	}
 	return nil
 }
+
+// Find gives the generator of the file, sniff reports whether its
+// content needs sniffing as there isn't an extension
+func (gm *GeneratorMap) Find(filename string) (gen Generator, sniff bool) {
+	if gm != nil {
+		// the longest extension wins, like ".tar.gz" over ".gz"
+		mapped, found := "", ""
+		for ext, name := range gm.Extensions {
+			if strings.HasSuffix(filename, ext) && len(ext) > len(found) {
+				mapped, found = name, ext
+			}
+		}
+		if found != "" {
+			if mapped == "" {
+				return nil, false
+			}
+			return gm.lookup(mapped), false
+		}
+	}
+	if gen = gm.resolve(findGenerator(matchFile(filename))); gen != nil {
+		return gen, false
+	}
+	return nil, gm != nil && gm.Sniff && filepath.Ext(filename) == ""
+}
+
+// SniffGenerator is the SniffGenerator of the repository
+func (gm *GeneratorMap) SniffGenerator(head []byte) Generator {
+	return gm.resolve(findGenerator(sniffContent(head)))
+}
+
+// lookup gives the generator with the name, the repository's one first
+func (gm *GeneratorMap) lookup(name string) Generator {
+	if gm != nil {
+		if gen, ok := gm.Generators[name]; ok {
+			return gen
+		}
+	}
+	return LookupGenerator(name)
+}
+
+// resolve gives the repository's generator replacing the registered one
+func (gm *GeneratorMap) resolve(r *registered) Generator {
+	if r == nil {
+		return nil
+	}
+	if gm != nil && r.name != "" {
+		if gen, ok := gm.Generators[r.name]; ok {
+			return gen
+		}
+	}
+	return r.gen
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testGenerator matches the files with the suffix
+type testGenerator string
+
+func (g testGenerator) Match(filename string) bool {
+	return strings.HasSuffix(filename, string(g))
+}
+
+func (testGenerator) Generate(io.Reader, Staticer) (Poster, error) {
+	return nil, nil
+}
+
+func TestRegisterGenerator(t *testing.T) {
+	saved := append([]registered(nil), generators...)
+	defer func() { generators = saved }()
+
+	check := func(filename string, expect Generator) {
+		t.Helper()
+		if got := FindGenerator(filename); fmt.Sprint(got) != fmt.Sprint(expect) {
+			t.Errorf("%s: got %#v, but want %#v\n", filename, got, expect)
+		}
+	}
+	check("a.md", markdownGenerator{})
+
+	// a lower priority doesn't override
+	RegisterGenerator(testGenerator("a.md"))
+	check("a.md", markdownGenerator{})
+
+	// a higher priority does
+	RegisterNamedGenerator("mine", 1, testGenerator(".md"))
+	check("a.md", testGenerator(".md"))
+	check("a.org", orgGenerator{})
+
+	// replace a built-in
+	RegisterNamedGenerator("markdown", 2, testGenerator("md"))
+	check("a.md", testGenerator("md"))
+	if got := LookupGenerator("markdown"); got != testGenerator("md") {
+		t.Errorf("got %#v, but want the replaced one\n", got)
+	}
+
+	UnregisterGenerator("markdown")
+	check("a.md", testGenerator(".md"))
+	UnregisterGenerator("mine")
+	check("a.md", testGenerator("a.md"))
+	if got := LookupGenerator("mine"); got != nil {
+		t.Errorf("got %#v, but want nil\n", got)
+	}
+}
+
+func TestSniffGenerator(t *testing.T) {
+	for name, c := range map[string]struct {
+		head   string
+		expect string // the type of the generator
+	}{
+		"markdown": {
+			head:   "hello | 2012-12-01 | go\ncontent\n",
+			expect: "storage.markdownGenerator",
+		},
+		"present": {
+			head:   "hello\nsub title\n2 Jan 2012\nTags: go\n\n* section\n",
+			expect: "storage.presentGenerator",
+		},
+		"org": {
+			head:   "# comment\n#+TITLE: hello\n",
+			expect: "storage.orgGenerator",
+		},
+		"asciidoc": {
+			head:   "// comment\n= hello\n:revdate: 2012-12-01\n",
+			expect: "storage.asciidocGenerator",
+		},
+		"rst": {
+			head:   "hello\n=====\n\n:date: 2012-12-01\n",
+			expect: "storage.rstGenerator",
+		},
+		"html": {
+			head:   "\n<!DOCTYPE html>\n<html><title>hello</title>",
+			expect: "storage.htmlGenerator",
+		},
+		"notebook": {
+			head:   `{"cells": [], "metadata": {}}`,
+			expect: "storage.notebookGenerator",
+		},
+		"unknown": {
+			head:   "Copyright (c) 2012\n\nPermission is hereby granted\n",
+			expect: "<nil>",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := fmt.Sprintf("%T", SniffGenerator([]byte(c.head))); got != c.expect {
+				t.Errorf("got %s, but want %s\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestGeneratorMap(t *testing.T) {
+	gm := &GeneratorMap{
+		Extensions: map[string]string{
+			".txt":      "markdown",
+			".html":     "",
+			".slide.md": "slide",
+		},
+		Sniff: true,
+	}
+	if err := gm.check(); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]struct {
+		gm          *GeneratorMap
+		path        string
+		expect      string // the type of the generator
+		expectSniff bool
+	}{
+		"mapped": {
+			gm:     gm,
+			path:   "a/b.txt",
+			expect: "storage.markdownGenerator",
+		},
+		"disabled": {
+			gm:     gm,
+			path:   "a/b.html",
+			expect: "<nil>",
+		},
+		"longest": {
+			gm:     gm,
+			path:   "a/b.slide.md",
+			expect: "storage.presentGenerator",
+		},
+		"default": {
+			gm:     gm,
+			path:   "a/b.org",
+			expect: "storage.orgGenerator",
+		},
+		"sniff": {
+			gm:          gm,
+			path:        "a.b/c",
+			expect:      "<nil>",
+			expectSniff: true,
+		},
+		"unknown": {
+			gm:     gm,
+			path:   "a/b.go",
+			expect: "<nil>",
+		},
+		"nil": {
+			path:   "a/b",
+			expect: "<nil>",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			gen, sniff := c.gm.Find(c.path)
+			if got := fmt.Sprintf("%T", gen); got != c.expect || sniff != c.expectSniff {
+				t.Errorf("got %s, %v, but want %s, %v\n", got, sniff, c.expect, c.expectSniff)
+			}
+		})
+	}
+
+	for name, gm := range map[string]*GeneratorMap{
+		"unknownGenerator": {Extensions: map[string]string{".txt": "noexist"}},
+		"invalidExtension": {Extensions: map[string]string{"txt": "markdown"}},
+	} {
+		if err := gm.check(); err == nil {
+			t.Errorf("%s: expect an error\n", name)
+		}
+	}
+}
+
+func TestNewGeneratorMap(t *testing.T) {
+	gm, err := newGeneratorMap(&Config{
+		Generators: map[string]string{".txt": "markdown"},
+		Markdown:   &MarkdownOptions{ImagePrefix: "/img"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"a/b.txt", "a/b.md"} {
+		gen, _ := gm.Find(path)
+		if g, ok := gen.(markdownGenerator); !ok || g.imagePrefix != "/img" {
+			t.Errorf("%s: got %#v, but want the generator with the options\n", path, gen)
+		}
+	}
+	if gen, _ := FindGenerator("a/b.md").(markdownGenerator); gen.imagePrefix != "" {
+		t.Errorf("the registered generator is changed: %#v\n", gen)
+	}
+
+	_, err = newGeneratorMap(&Config{
+		Markdown: &MarkdownOptions{Extensions: []string{"noexist"}},
+	})
+	if err = matchError(errors.New("extension \"noexist\" is unknown"), err); err != nil {
+		t.Error(err)
+	}
+}
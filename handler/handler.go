@@ -0,0 +1,430 @@
+// Package handler serves the posts in a storage over http.
+//
+// The routes are:
+//
+//	/                      all the posts
+//	/posts/<key>           a post
+//	/tags/                 all the tags
+//	/tags/<tag>            the posts with the tag
+//	/archive/              the posts grouped by month
+//	/archive/<year>[/<mm>] the posts in a year or month
+//	/images/<key>/<path>   a static resource of a post
+//
+// The pages are rendered with the user supplied templates, or given in
+// json if there isn't a template for the page or the request has the
+// query "format=json".
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tw4452852/storage"
+)
+
+// The url prefixes of the pages
+const (
+	PostPrefix    = "/posts/"
+	TagPrefix     = "/tags/"
+	ArchivePrefix = "/archive/"
+)
+
+// The names of the templates for each kind of page
+const (
+	IndexTemplate   = "index"
+	PostTemplate    = "post"
+	TagsTemplate    = "tags"
+	TagTemplate     = "tag"
+	ArchiveTemplate = "archive"
+)
+
+// Handler serves the posts in a storage
+type Handler struct {
+	// IncludeDrafts also serves the drafts and the scheduled posts,
+	// e.g. for previewing
+	IncludeDrafts bool
+	// StaticPrefix is the path serving the posts' static resources,
+	// storage.ImagePrefix if empty. It should be the prefix of the
+	// repositories' storage.StaticURL.
+	StaticPrefix string
+
+	storage storage.Storager
+	tmpl    *template.Template
+}
+
+// FuncMap are the functions for the templates, which should be added
+// before parsing them
+var FuncMap = template.FuncMap{
+	// safeHTML keeps the html, e.g. the content of a post, unescaped
+	"safeHTML": func(s string) template.HTML { return template.HTML(s) },
+	// isDraft reports whether the post is a draft, see storage.IsDraft
+	"isDraft": storage.IsDraft,
+}
+
+var _ http.Handler = &Handler{}
+
+// New creates a Handler serving the posts in s, the pages are rendered
+// with the templates in tmpl, which may be nil.
+func New(s storage.Storager, tmpl *template.Template) *Handler {
+	return &Handler{
+		storage: s,
+		tmpl:    tmpl,
+	}
+}
+
+// Page is the data given to the templates
+type Page struct {
+	Post      storage.Poster   // for the post page
+	Backlinks []storage.Poster // linking to the Post, if the storage is a storage.Backlinker
+	Posts     []storage.Poster // the posts in a listing, latest first
+	Tag       string           // for the tag page
+	Tags      []*Tag           // for the tags page
+	Archive   []*Month         // for the archive page
+}
+
+// Tag is a tag in the tags page
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Month is a month in the archive page
+type Month struct {
+	Year  int              `json:"year"`
+	Month time.Month       `json:"month"`
+	Posts []storage.Poster `json:"-"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := r.URL.Path
+	switch {
+	case p == "/":
+		h.serveIndex(w, r)
+	case strings.HasPrefix(p, PostPrefix):
+		h.servePost(w, r, strings.TrimPrefix(p, PostPrefix))
+	case p == TagPrefix:
+		h.serveTags(w, r)
+	case strings.HasPrefix(p, TagPrefix):
+		h.serveTag(w, r, strings.TrimPrefix(p, TagPrefix))
+	case strings.HasPrefix(p, ArchivePrefix):
+		h.serveArchive(w, r, strings.TrimPrefix(p, ArchivePrefix))
+	case strings.HasPrefix(p, h.staticPrefix()):
+		h.serveStatic(w, r, strings.TrimPrefix(p, h.staticPrefix()))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// get gets the posts of the keys, all if none
+func (h *Handler) get(keys ...storage.Keyer) (*storage.Result, error) {
+	return h.storage.Query(storage.Query{Keys: keys, IncludeDrafts: h.IncludeDrafts})
+}
+
+// all gives all the posts, latest first
+func (h *Handler) all() ([]storage.Poster, error) {
+	result, err := h.get()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(result)
+	return result.Content, nil
+}
+
+func (h *Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	posts, err := h.all()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	h.render(w, r, IndexTemplate, &Page{Posts: posts}, listJSON(posts), latest(posts))
+}
+
+func (h *Handler) servePost(w http.ResponseWriter, r *http.Request, key string) {
+	result, err := h.get(storage.StringKey(key))
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if current, moved := result.Moved[key]; moved {
+		http.Redirect(w, r, PostURL(current), http.StatusMovedPermanently)
+		return
+	}
+	post := result.Content[0]
+	page := &Page{Post: post}
+	if b, ok := h.storage.(storage.Backlinker); ok {
+		// a post without backlinks is still served
+		page.Backlinks, _ = b.Backlinks(post.Key())
+	}
+	h.render(w, r, PostTemplate, page, newPostJSON(post, true), storage.Updated(post))
+}
+
+func (h *Handler) serveTags(w http.ResponseWriter, r *http.Request) {
+	posts, err := h.all()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	counts := make(map[string]int)
+	for _, p := range posts {
+		for _, tag := range p.Tags() {
+			counts[tag]++
+		}
+	}
+	tags := make([]*Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, &Tag{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	h.render(w, r, TagsTemplate, &Page{Tags: tags, Posts: posts}, tags, latest(posts))
+}
+
+func (h *Handler) serveTag(w http.ResponseWriter, r *http.Request, tag string) {
+	all, err := h.all()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	var posts []storage.Poster
+	for _, p := range all {
+		for _, t := range p.Tags() {
+			if t == tag {
+				posts = append(posts, p)
+				break
+			}
+		}
+	}
+	if len(posts) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	h.render(w, r, TagTemplate, &Page{Tag: tag, Posts: posts}, listJSON(posts), latest(posts))
+}
+
+// serveArchive serves the posts grouped by month, which are filtered by
+// the year and month in the path if any
+func (h *Handler) serveArchive(w http.ResponseWriter, r *http.Request, p string) {
+	var year, month int
+	if p = strings.Trim(p, "/"); p != "" {
+		parts := strings.Split(p, "/")
+		var err error
+		if year, err = strconv.Atoi(parts[0]); err != nil || len(parts) > 2 {
+			http.NotFound(w, r)
+			return
+		}
+		if len(parts) == 2 {
+			if month, err = strconv.Atoi(parts[1]); err != nil || month < 1 || month > 12 {
+				http.NotFound(w, r)
+				return
+			}
+		}
+	}
+
+	all, err := h.all()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	var (
+		posts   []storage.Poster
+		archive []*Month
+	)
+	for _, post := range all {
+		d := post.Date()
+		if year != 0 && d.Year() != year || month != 0 && int(d.Month()) != month {
+			continue
+		}
+		posts = append(posts, post)
+		if n := len(archive); n == 0 || archive[n-1].Year != d.Year() || archive[n-1].Month != d.Month() {
+			archive = append(archive, &Month{Year: d.Year(), Month: d.Month()})
+		}
+		m := archive[len(archive)-1]
+		m.Posts = append(m.Posts, post)
+	}
+	if len(posts) == 0 && year != 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	type monthJSON struct {
+		*Month
+		Posts []*postJSON `json:"posts"`
+	}
+	months := make([]monthJSON, len(archive))
+	for i, m := range archive {
+		months[i] = monthJSON{m, listJSON(m.Posts)}
+	}
+	h.render(w, r, ArchiveTemplate, &Page{Posts: posts, Archive: archive}, months, latest(posts))
+}
+
+// serveStatic serves the static resource "<key>/<path>" of a post. As a
+// key may contain '/', the shortest key found wins.
+func (h *Handler) serveStatic(w http.ResponseWriter, r *http.Request, p string) {
+	moved := "" // the current path of the first previous key found
+	for i := strings.IndexByte(p, '/'); i > 0; i = nextSlash(p, i) {
+		key, name := p[:i], p[i+1:]
+		result, err := h.get(storage.StringKey(key))
+		if err != nil {
+			continue
+		}
+		// a longer key may be a current one
+		if current, found := result.Moved[key]; found {
+			if moved == "" {
+				moved = h.staticPrefix() + current + "/" + name
+			}
+			continue
+		}
+		post := result.Content[0]
+
+		b, err := storage.ReadStatic(post, name)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+		serveContent(w, r, b, storage.Updated(post))
+		return
+	}
+	if moved != "" {
+		http.Redirect(w, r, (&url.URL{Path: moved}).EscapedPath(), http.StatusMovedPermanently)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// staticPrefix gives the path serving the static resources
+func (h *Handler) staticPrefix() string {
+	if h.StaticPrefix == "" {
+		return storage.ImagePrefix
+	}
+	return "/" + strings.Trim(h.StaticPrefix, "/") + "/"
+}
+
+func nextSlash(s string, i int) int {
+	if j := strings.IndexByte(s[i+1:], '/'); j >= 0 {
+		return i + 1 + j
+	}
+	return -1
+}
+
+// render renders a page with the template, or gives v in json
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, name string, page *Page, v interface{}, modtime time.Time) {
+	b := new(bytes.Buffer)
+	if h.tmpl == nil || h.tmpl.Lookup(name) == nil || r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(b).Encode(v); err != nil {
+			serveError(w, err)
+			return
+		}
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := h.tmpl.ExecuteTemplate(b, name, page); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+	serveContent(w, r, b.Bytes(), modtime)
+}
+
+// serveContent serves b with the ETag and Last-Modified headers, which
+// also handles the conditional and range requests
+func serveContent(w http.ResponseWriter, r *http.Request, b []byte, modtime time.Time) {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00", modtime.UnixNano())
+	h.Write(b)
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, h.Sum64()))
+	http.ServeContent(w, r, "", modtime, bytes.NewReader(b))
+}
+
+func serveError(w http.ResponseWriter, err error) {
+	switch {
+	case err == storage.ErrNotFound, errors.Is(err, os.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrOutsideRepo), errors.Is(err, storage.ErrNotListed):
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+	default:
+		log.Printf("serve error: %s\n", err)
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+	}
+}
+
+// latest gives the time of the latest update of the posts
+func latest(posts []storage.Poster) time.Time {
+	var t time.Time
+	for _, p := range posts {
+		if d := storage.Updated(p); d.After(t) {
+			t = d
+		}
+	}
+	return t
+}
+
+// PostURL gives the url path of the post with the key
+func PostURL(key string) string {
+	return (&url.URL{Path: PostPrefix + key}).EscapedPath()
+}
+
+// postJSON is the json form of a post
+type postJSON struct {
+	Key         string             `json:"key"`
+	URL         string             `json:"url"`
+	Title       string             `json:"title"`
+	Date        time.Time          `json:"date"`
+	Updated     time.Time          `json:"updated"`
+	Tags        []string           `json:"tags"`
+	IsSlide     bool               `json:"isSlide"`
+	Summary     string             `json:"summary"`
+	WordCount   int                `json:"wordCount"`
+	ReadingTime int                `json:"readingTime"` // in minutes
+	Content     string             `json:"content,omitempty"`
+	TOC         []*storage.Heading `json:"toc,omitempty"`
+}
+
+func newPostJSON(p storage.Poster, full bool) *postJSON {
+	pj := &postJSON{
+		Key:         p.Key(),
+		URL:         PostURL(p.Key()),
+		Title:       p.Title(),
+		Date:        p.Date(),
+		Updated:     storage.Updated(p),
+		Tags:        p.Tags(),
+		IsSlide:     p.IsSlide(),
+		Summary:     storage.Summary(p),
+		WordCount:   storage.WordCount(p),
+		ReadingTime: int(storage.ReadingTime(p) / time.Minute),
+	}
+	if full {
+		pj.Content = p.Content()
+		pj.TOC = storage.TOC(p)
+	}
+	return pj
+}
+
+func listJSON(posts []storage.Poster) []*postJSON {
+	l := make([]*postJSON, len(posts))
+	for i, p := range posts {
+		l[i] = newPostJSON(p, false)
+	}
+	return l
+}
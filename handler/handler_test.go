@@ -0,0 +1,433 @@
+package handler
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tw4452852/storage"
+)
+
+type post struct {
+	key     string
+	title   string
+	date    time.Time
+	tags    []string
+	content string
+	statics map[string]string
+	aliases []string
+	draft   bool
+}
+
+func (p *post) Key() string                { return p.key }
+func (p *post) Title() string              { return p.title }
+func (p *post) Date() time.Time            { return p.date }
+func (p *post) Tags() []string             { return p.tags }
+func (p *post) Content() string            { return p.content }
+func (p *post) IsSlide() bool              { return false }
+func (p *post) IsDraft() bool              { return p.draft }
+func (p *post) Summary() string            { return p.content }
+func (p *post) WordCount() int             { return len(strings.Fields(p.content)) }
+func (p *post) ReadingTime() time.Duration { return time.Minute }
+func (p *post) TOC() []*storage.Heading    { return nil }
+func (p *post) Aliases() []string          { return p.aliases }
+func (p *post) Updated() time.Time         { return p.date }
+
+func (p *post) StaticList() []string {
+	var l []string
+	for name := range p.statics {
+		l = append(l, name)
+	}
+	return l
+}
+
+func (p *post) Static(name string) io.ReadCloser {
+	s, ok := p.statics[name]
+	if !ok {
+		return ioutil.NopCloser(errReader{&os.PathError{Op: "static", Path: name, Err: os.ErrNotExist}})
+	}
+	return ioutil.NopCloser(strings.NewReader(s))
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// fakeStorage is a read only storage for the tests
+type fakeStorage struct {
+	storage.Storager
+	posts []storage.Poster
+}
+
+func (s *fakeStorage) Query(q storage.Query) (*storage.Result, error) {
+	var posts []storage.Poster
+	for _, p := range s.posts {
+		if q.IncludeDrafts || !storage.IsDraft(p) {
+			posts = append(posts, p)
+		}
+	}
+	keys := q.Keys
+	if len(keys) == 0 {
+		return &storage.Result{Content: posts}, nil
+	}
+	result := &storage.Result{}
+	for _, k := range keys {
+		found := false
+		for _, p := range posts {
+			if p.Key() == k.Key() {
+				result.Content = append(result.Content, p)
+				found = true
+				break
+			}
+			for _, alias := range storage.Aliases(p) {
+				if alias == k.Key() {
+					result.Content = append(result.Content, p)
+					result.Moved = map[string]string{alias: p.Key()}
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, storage.ErrNotFound
+		}
+	}
+	return result, nil
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func newTestHandler(tmpl *template.Template) *Handler {
+	return New(&fakeStorage{posts: []storage.Poster{
+		&post{
+			key:     "first",
+			title:   "First",
+			date:    parseTime("2020-01-02"),
+			tags:    []string{"go", "web"},
+			content: "<p>first post</p>",
+			statics: map[string]string{"a.png": "png data", "b.txt": "0123456789"},
+		},
+		&post{
+			key:     "second",
+			title:   "Second",
+			date:    parseTime("2020-02-03"),
+			tags:    []string{"go"},
+			content: "<p>second post</p>",
+			aliases: []string{"old_second"},
+		},
+		&post{
+			key:     "ns/third",
+			title:   "Third",
+			date:    parseTime("2021-03-04"),
+			content: "<p>third post</p>",
+			statics: map[string]string{"img/c.css": "body{}"},
+		},
+	}}, tmpl)
+}
+
+func serve(h http.Handler, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerJSON(t *testing.T) {
+	h := newTestHandler(nil)
+	for name, c := range map[string]struct {
+		target string
+		keys   []string
+	}{
+		"index": {
+			target: "/",
+			keys:   []string{"ns/third", "second", "first"},
+		},
+		"tag": {
+			target: "/tags/go",
+			keys:   []string{"second", "first"},
+		},
+		"archiveYear": {
+			target: "/archive/2020",
+			keys:   []string{"second", "first"},
+		},
+		"archiveMonth": {
+			target: "/archive/2020/01",
+			keys:   []string{"first"},
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			w := serve(h, "GET", c.target, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expect status 200, got %d\n", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("expect json content type, got %q\n", ct)
+			}
+			var got []struct {
+				Key   string            `json:"key"`
+				Posts []json.RawMessage `json:"posts"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, p := range got {
+				if p.Posts != nil {
+					// an archive, count the posts of each month
+					for _, raw := range p.Posts {
+						var pj postJSON
+						if err := json.Unmarshal(raw, &pj); err != nil {
+							t.Fatal(err)
+						}
+						keys = append(keys, pj.Key)
+					}
+					continue
+				}
+				keys = append(keys, p.Key)
+			}
+			if strings.Join(keys, ",") != strings.Join(c.keys, ",") {
+				t.Errorf("expect keys %v, got %v\n", c.keys, keys)
+			}
+		})
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	h := newTestHandler(nil)
+	for name, c := range map[string]struct {
+		method   string
+		target   string
+		status   int
+		location string
+	}{
+		"post":          {"GET", "/posts/first", http.StatusOK, ""},
+		"nestedKey":     {"GET", "/posts/ns/third", http.StatusOK, ""},
+		"noPost":        {"GET", "/posts/none", http.StatusNotFound, ""},
+		"moved":         {"GET", "/posts/old_second", http.StatusMovedPermanently, "/posts/second"},
+		"tags":          {"GET", "/tags/", http.StatusOK, ""},
+		"noTag":         {"GET", "/tags/none", http.StatusNotFound, ""},
+		"archive":       {"GET", "/archive/", http.StatusOK, ""},
+		"badMonth":      {"GET", "/archive/2020/13", http.StatusNotFound, ""},
+		"emptyYear":     {"GET", "/archive/1999", http.StatusNotFound, ""},
+		"unknown":       {"GET", "/unknown", http.StatusNotFound, ""},
+		"post method":   {"POST", "/", http.StatusMethodNotAllowed, ""},
+		"head":          {"HEAD", "/posts/first", http.StatusOK, ""},
+		"static":        {"GET", "/images/first/a.png", http.StatusOK, ""},
+		"nestedStatic":  {"GET", "/images/ns/third/img/c.css", http.StatusOK, ""},
+		"noStatic":      {"GET", "/images/first/none.png", http.StatusNotFound, ""},
+		"noStaticOwner": {"GET", "/images/none/a.png", http.StatusNotFound, ""},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			w := serve(h, c.method, c.target, nil)
+			if w.Code != c.status {
+				t.Fatalf("expect status %d, got %d\n", c.status, w.Code)
+			}
+			if loc := w.Header().Get("Location"); loc != c.location {
+				t.Errorf("expect location %q, got %q\n", c.location, loc)
+			}
+		})
+	}
+}
+
+func TestHandlerDrafts(t *testing.T) {
+	h := New(&fakeStorage{posts: []storage.Poster{
+		&post{key: "draft", title: "Draft", date: parseTime("2020-01-02"), draft: true},
+	}}, nil)
+	if w := serve(h, "GET", "/posts/draft", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expect status 404 for a draft, got %d\n", w.Code)
+	}
+	h.IncludeDrafts = true
+	if w := serve(h, "GET", "/posts/draft", nil); w.Code != http.StatusOK {
+		t.Errorf("expect status 200 for a draft in preview, got %d\n", w.Code)
+	}
+}
+
+func TestHandlerTemplate(t *testing.T) {
+	tmpl := template.Must(template.New(PostTemplate).Funcs(FuncMap).Parse(`<h1>{{.Post.Title}}</h1>{{.Post.Content}}{{.Post.Content | safeHTML}}`))
+	template.Must(tmpl.New(TagsTemplate).Parse(`{{range .Tags}}{{.Name}}:{{.Count}} {{end}}`))
+	h := newTestHandler(tmpl)
+
+	for name, c := range map[string]struct {
+		target string
+		ctype  string
+		body   string
+	}{
+		"post": {
+			target: "/posts/first",
+			ctype:  "text/html; charset=utf-8",
+			body:   "<h1>First</h1>&lt;p&gt;first post&lt;/p&gt;<p>first post</p>",
+		},
+		"tags": {
+			target: "/tags/",
+			ctype:  "text/html; charset=utf-8",
+			body:   "go:2 web:1 ",
+		},
+		"forceJSON": {
+			target: "/tags/?format=json",
+			ctype:  "application/json; charset=utf-8",
+			body:   `[{"name":"go","count":2},{"name":"web","count":1}]` + "\n",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			w := serve(h, "GET", c.target, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expect status 200, got %d\n", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != c.ctype {
+				t.Errorf("expect content type %q, got %q\n", c.ctype, ct)
+			}
+			if got := w.Body.String(); got != c.body {
+				t.Errorf("expect body %q, got %q\n", c.body, got)
+			}
+		})
+	}
+}
+
+// backlinkStorage tells every post is linked by the first one
+type backlinkStorage struct {
+	*fakeStorage
+}
+
+func (s backlinkStorage) Backlinks(key string) ([]storage.Poster, error) {
+	return s.posts[:1], nil
+}
+
+func TestHandlerBacklinks(t *testing.T) {
+	tmpl := template.Must(template.New(PostTemplate).Parse(`{{.Post.Title}}:{{range .Backlinks}} {{.Title}}{{end}}`))
+	h := newTestHandler(tmpl)
+	h.storage = backlinkStorage{h.storage.(*fakeStorage)}
+
+	w := serve(h, "GET", "/posts/second", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect status 200, got %d\n", w.Code)
+	}
+	if got, expect := w.Body.String(), "Second: First"; got != expect {
+		t.Errorf("expect body %q, got %q\n", expect, got)
+	}
+}
+
+func TestHandlerStatic(t *testing.T) {
+	h := newTestHandler(nil)
+
+	w := serve(h, "GET", "/images/first/a.png", nil)
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expect content type image/png, got %q\n", ct)
+	}
+	if got := w.Body.String(); got != "png data" {
+		t.Errorf("expect body %q, got %q\n", "png data", got)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expect an etag\n")
+	}
+
+	for name, c := range map[string]struct {
+		header map[string]string
+		status int
+		body   string
+	}{
+		"ifNoneMatch": {
+			header: map[string]string{"If-None-Match": etag},
+			status: http.StatusNotModified,
+		},
+		"ifModifiedSince": {
+			header: map[string]string{"If-Modified-Since": parseTime("2020-01-03").UTC().Format(http.TimeFormat)},
+			status: http.StatusNotModified,
+		},
+		"modified": {
+			header: map[string]string{"If-Modified-Since": parseTime("2020-01-01").UTC().Format(http.TimeFormat)},
+			status: http.StatusOK,
+			body:   "0123456789",
+		},
+		"range": {
+			header: map[string]string{"Range": "bytes=2-4"},
+			status: http.StatusPartialContent,
+			body:   "234",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			w := serve(h, "GET", "/images/first/b.txt", c.header)
+			if c.header["If-None-Match"] != "" {
+				w = serve(h, "GET", "/images/first/a.png", c.header)
+			}
+			if w.Code != c.status {
+				t.Fatalf("expect status %d, got %d\n", c.status, w.Code)
+			}
+			if got := w.Body.String(); got != c.body {
+				t.Errorf("expect body %q, got %q\n", c.body, got)
+			}
+		})
+	}
+}
+
+func TestHandlerStaticMoved(t *testing.T) {
+	h := newTestHandler(nil)
+	// a post with the previous key of the second one
+	h.storage.(*fakeStorage).posts = append(h.storage.(*fakeStorage).posts, &post{
+		key:     "old_second/x",
+		title:   "X",
+		date:    parseTime("2020-01-01"),
+		statics: map[string]string{"a.png": "x"},
+	})
+	h.storage.(*fakeStorage).posts[1].(*post).statics = map[string]string{"a.png": "second"}
+
+	w := serve(h, "GET", "/images/old_second/a.png", nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/images/second/a.png" {
+		t.Errorf("expect a redirect to the current key, got %d %q\n", w.Code, w.Header().Get("Location"))
+	}
+	if w = serve(h, "GET", "/images/old_second/x/a.png", nil); w.Body.String() != "x" {
+		t.Errorf("expect the static resource of the longer key, got %d %q\n", w.Code, w.Body.String())
+	}
+}
+
+func TestHandlerStaticPrefix(t *testing.T) {
+	h := newTestHandler(nil)
+	h.StaticPrefix = "static"
+	for name, c := range map[string]struct {
+		path   string
+		status int
+		body   string
+	}{
+		"prefix":    {"/static/first/a.png", http.StatusOK, "png data"},
+		"hashed":    {"/static/first/a.0123abcd.png", http.StatusOK, "png data"},
+		"oldPrefix": {"/images/first/a.png", http.StatusNotFound, "404 page not found\n"},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			w := serve(h, "GET", c.path, nil)
+			if w.Code != c.status {
+				t.Fatalf("expect status %d, got %d\n", c.status, w.Code)
+			}
+			if got := w.Body.String(); got != c.body {
+				t.Errorf("expect body %q, got %q\n", c.body, got)
+			}
+		})
+	}
+}
+
+func TestPostLink(t *testing.T) {
+	for _, key := range []string{"a", "ns/a b"} {
+		if got, expect := storage.PostLink(key), PostURL(key); got != expect {
+			t.Errorf("got %q, but want %q\n", got, expect)
+		}
+	}
+}
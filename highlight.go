@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The classes of the highlighted tokens
+const (
+	classKeyword  = "kw"
+	classBuiltin  = "bi"
+	classLiteral  = "lit"
+	classString   = "str"
+	classNumber   = "num"
+	classComment  = "com"
+	classKey      = "key"
+	classVariable = "var"
+	classPreproc  = "pre"
+	// classHighlight marks a highlighted line
+	classHighlight = "hl"
+)
+
+// lexer splits source code into classed tokens, it's configured for
+// each language.
+type lexer struct {
+	keywords     map[string]bool
+	builtins     map[string]bool
+	literals     map[string]bool
+	lineComments []string
+	blockComment [2]string
+	quotes       string // string delimiters
+	rawQuotes    string // string delimiters without escapes
+	multiQuotes  string // string delimiters may span multiple lines
+	tripleQuotes bool   // python's """ and '''
+	stringKeys   bool   // a string followed by ':' is a key
+	yamlKeys     bool   // "key:" at the beginning of a line
+	variables    bool   // shell's $var
+	preprocessor bool   // c's #include
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	goLexer = &lexer{
+		keywords: words(`break case chan const continue default defer else
+			fallthrough for func go goto if import interface map package
+			range return select struct switch type var`),
+		builtins: words(`bool byte complex64 complex128 error float32 float64
+			int int8 int16 int32 int64 rune string uint uint8 uint16 uint32
+			uint64 uintptr append cap close complex copy delete imag len
+			make new panic print println real recover`),
+		literals:     words(`true false nil iota`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+		rawQuotes:    "`",
+		multiQuotes:  "`",
+	}
+	shellLexer = &lexer{
+		keywords: words(`if then else elif fi for while until do done case
+			esac in function return select time`),
+		builtins: words(`echo cd export local read set unset source exit
+			test printf shift trap eval exec alias`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		rawQuotes:    `'`,
+		multiQuotes:  `"'`,
+		variables:    true,
+	}
+	jsonLexer = &lexer{
+		literals:   words(`true false null`),
+		quotes:     `"`,
+		stringKeys: true,
+	}
+	yamlLexer = &lexer{
+		literals:     words(`true false null yes no on off ~`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		yamlKeys:     true,
+	}
+	pythonLexer = &lexer{
+		keywords: words(`and as assert async await break class continue def
+			del elif else except finally for from global if import in is
+			lambda nonlocal not or pass raise return try while with yield`),
+		builtins: words(`abs all any bool bytes dict enumerate filter float
+			int isinstance len list map max min object open print range
+			repr set sorted str sum super tuple type zip self`),
+		literals:     words(`True False None`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		tripleQuotes: true,
+	}
+	jsLexer = &lexer{
+		keywords: words(`async await break case catch class const continue
+			debugger default delete do else export extends finally for from
+			function if import in instanceof let new of return static super
+			switch this throw try typeof var void while with yield`),
+		builtins: words(`Array Boolean Date Error JSON Map Math Number Object
+			Promise RegExp Set String Symbol console document window`),
+		literals:     words(`true false null undefined NaN Infinity`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+		multiQuotes:  "`",
+	}
+	cLexer = &lexer{
+		keywords: words(`auto break case char const continue default do
+			double else enum extern float for goto if inline int long
+			register restrict return short signed sizeof static struct
+			switch typedef union unsigned void volatile while`),
+		builtins: words(`size_t ssize_t uint8_t uint16_t uint32_t uint64_t
+			int8_t int16_t int32_t int64_t bool FILE printf malloc free`),
+		literals:     words(`NULL true false`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		preprocessor: true,
+	}
+
+	// lexers are indexed by the language names and file extensions
+	lexers = map[string]*lexer{
+		"go":         goLexer,
+		"golang":     goLexer,
+		"sh":         shellLexer,
+		"bash":       shellLexer,
+		"shell":      shellLexer,
+		"zsh":        shellLexer,
+		"json":       jsonLexer,
+		"yaml":       yamlLexer,
+		"yml":        yamlLexer,
+		"python":     pythonLexer,
+		"py":         pythonLexer,
+		"javascript": jsLexer,
+		"js":         jsLexer,
+		"c":          cLexer,
+		"h":          cLexer,
+	}
+)
+
+// findLexer gives the lexer of a language or file extension, nil if
+// the language isn't supported
+func findLexer(lang string) *lexer {
+	return lexers[strings.ToLower(strings.TrimPrefix(lang, "."))]
+}
+
+// codeToken is a piece of code, its class is empty for plain text
+type codeToken struct {
+	class string
+	text  string
+}
+
+var yamlKeyRE = regexp.MustCompile(`^(\s*(?:-\s+)?)([^\s#:'"-][^:#]*?|-[^\s:#][^:#]*?):(?:\s|$)`)
+
+// lex splits the code into tokens
+func (l *lexer) lex(code string) []codeToken {
+	var tokens []codeToken
+	emit := func(class, text string) {
+		if n := len(tokens); n != 0 && class == "" && tokens[n-1].class == "" {
+			tokens[n-1].text += text
+			return
+		}
+		tokens = append(tokens, codeToken{class, text})
+	}
+	lineStart := true // only spaces since the last newline
+	for i := 0; i < len(code); {
+		c := code[i]
+		rest := code[i:]
+		prevSpace := i == 0 || isSpace(code[i-1]) || code[i-1] == '\n'
+
+		if c == '\n' {
+			emit("", "\n")
+			lineStart = true
+			i++
+			continue
+		}
+		if lineStart && l.yamlKeys {
+			if m := yamlKeyRE.FindStringSubmatch(rest); m != nil {
+				emit("", m[1])
+				emit(classKey, m[2])
+				i += len(m[1]) + len(m[2])
+				lineStart = false
+				continue
+			}
+		}
+		if lineStart && l.preprocessor && c == '#' {
+			n := lineEnd(rest)
+			emit(classPreproc, rest[:n])
+			i += n
+			continue
+		}
+		if isSpace(c) {
+			emit("", string(c))
+			i++
+			continue
+		}
+		lineStart = false
+
+		if n := l.comment(rest, prevSpace); n != 0 {
+			emit(classComment, rest[:n])
+			i += n
+			continue
+		}
+		if n := l.str(rest); n != 0 {
+			class := classString
+			if l.stringKeys && strings.HasPrefix(strings.TrimLeft(rest[n:], " \t"), ":") {
+				class = classKey
+			}
+			emit(class, rest[:n])
+			i += n
+			continue
+		}
+		if l.variables && c == '$' && len(rest) > 1 {
+			n := 1
+			if rest[1] == '{' {
+				if end := strings.IndexByte(rest, '}'); end > 0 {
+					n = end + 1
+				}
+			} else if isIdentByte(rest[1]) {
+				n = 1 + identLen(rest[1:])
+			} else if strings.IndexByte("@*#?$!0123456789", rest[1]) >= 0 {
+				n = 2
+			}
+			if n > 1 {
+				emit(classVariable, rest[:n])
+				i += n
+				continue
+			}
+		}
+		if isDigit(c) && (i == 0 || !isIdentByte(code[i-1])) {
+			n := identLen(rest)
+			// a fraction or exponent
+			for n < len(rest) && (rest[n] == '.' || (rest[n] == '-' || rest[n] == '+') &&
+				(rest[n-1] == 'e' || rest[n-1] == 'E')) {
+				n++
+				n += identLen(rest[n:])
+			}
+			emit(classNumber, rest[:n])
+			i += n
+			continue
+		}
+		if isIdentByte(c) {
+			n := identLen(rest)
+			word := rest[:n]
+			switch {
+			case l.keywords[word]:
+				emit(classKeyword, word)
+			case l.builtins[word]:
+				emit(classBuiltin, word)
+			case l.literals[word]:
+				emit(classLiteral, word)
+			default:
+				emit("", word)
+			}
+			i += n
+			continue
+		}
+		if l.literals[string(c)] {
+			emit(classLiteral, string(c))
+		} else {
+			emit("", string(c))
+		}
+		i++
+	}
+	return tokens
+}
+
+// comment gives the length of the comment at the beginning of s
+func (l *lexer) comment(s string, prevSpace bool) int {
+	for _, lc := range l.lineComments {
+		// a '#' in the middle of a word isn't a comment, e.g. $#
+		if strings.HasPrefix(s, lc) && (lc != "#" || prevSpace) {
+			return lineEnd(s)
+		}
+	}
+	if begin, end := l.blockComment[0], l.blockComment[1]; begin != "" && strings.HasPrefix(s, begin) {
+		if n := strings.Index(s[len(begin):], end); n >= 0 {
+			return len(begin) + n + len(end)
+		}
+		return len(s)
+	}
+	return 0
+}
+
+// str gives the length of the string literal at the beginning of s
+func (l *lexer) str(s string) int {
+	q := s[0]
+	if strings.IndexByte(l.quotes, q) < 0 {
+		return 0
+	}
+	if l.tripleQuotes && len(s) >= 3 && s[1] == q && s[2] == q {
+		delim := s[:3]
+		if n := strings.Index(s[3:], delim); n >= 0 {
+			return 3 + n + 3
+		}
+		return len(s)
+	}
+	escape := strings.IndexByte(l.rawQuotes, q) < 0
+	multi := strings.IndexByte(l.multiQuotes, q) >= 0
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if escape {
+				i++
+			}
+		case '\n':
+			if !multi {
+				return i
+			}
+		case q:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func lineEnd(s string) int {
+	if n := strings.IndexByte(s, '\n'); n >= 0 {
+		return n
+	}
+	return len(s)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return isASCIILetter(c) || isDigit(c) || c == '_' || c >= 0x80
+}
+
+func identLen(s string) int {
+	n := 0
+	for n < len(s) && isIdentByte(s[n]) {
+		n++
+	}
+	return n
+}
+
+// highlightLines highlights the code, and gives the html of each line
+func highlightLines(l *lexer, code string) []string {
+	var lines []string
+	var b strings.Builder
+	for _, t := range l.lex(code) {
+		for i, part := range strings.Split(t.text, "\n") {
+			if i != 0 {
+				lines = append(lines, b.String())
+				b.Reset()
+			}
+			if part == "" {
+				continue
+			}
+			if t.class == "" {
+				b.WriteString(template.HTMLEscapeString(part))
+			} else {
+				fmt.Fprintf(&b, `<span class="%s">%s</span>`,
+					t.class, template.HTMLEscapeString(part))
+			}
+		}
+	}
+	return append(lines, b.String())
+}
+
+// writeLine writes a line of highlighted code, which is numbered with
+// num and marked if hl
+func writeLine(b *strings.Builder, num int, hl bool, line string) {
+	if hl {
+		fmt.Fprintf(b, `<span num="%d" class="%s">%s</span>`, num, classHighlight, line)
+	} else {
+		fmt.Fprintf(b, `<span num="%d">%s</span>`, num, line)
+	}
+	b.WriteByte('\n')
+}
+
+// highlightBlock gives the html of a highlighted code block with line
+// numbers, the lines in hl are marked.
+func highlightBlock(l *lexer, lang, code string, hl lineRanges) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<pre class="numbers"><code class="language-%s">`,
+		template.HTMLEscapeString(lang))
+	for i, line := range highlightLines(l, strings.TrimSuffix(code, "\n")) {
+		writeLine(&b, i+1, hl.has(i+1), line)
+	}
+	b.WriteString("</code></pre>\n")
+	return b.String()
+}
+
+// lineRanges are the ranges of the highlighted lines, both ends included
+type lineRanges [][2]int
+
+// has reports whether the line n is in the ranges
+func (lr lineRanges) has(n int) bool {
+	for _, r := range lr {
+		if r[0] <= n && n <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLineRanges parses the highlighted lines like "{1,3-5}"
+func parseLineRanges(s string) (lineRanges, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid line ranges %q", s)
+	}
+	lines := lineRanges{}
+	for _, r := range strings.Split(s[1:len(s)-1], ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		from, to := r, r
+		if i := strings.IndexByte(r, '-'); i >= 0 {
+			from, to = r[:i], r[i+1:]
+		}
+		begin, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line ranges %q: %s", s, err)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line ranges %q: %s", s, err)
+		}
+		if end < begin {
+			return nil, fmt.Errorf("invalid line ranges %q: %d is after %d", s, begin, end)
+		}
+		lines = append(lines, [2]int{begin, end})
+	}
+	return lines, nil
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHighlightLines(t *testing.T) {
+	for name, c := range map[string]struct {
+		lang   string
+		code   string
+		expect []string
+	}{
+		"go": {
+			lang: "go",
+			code: "func f() int { /* a\nb */ return len(`x`) + 0x1F // c\n}",
+			expect: []string{
+				`<span class="kw">func</span> f() <span class="bi">int</span> { <span class="com">/* a</span>`,
+				`<span class="com">b */</span> <span class="kw">return</span> <span class="bi">len</span>(<span class="str">` + "`x`" + `</span>) + <span class="num">0x1F</span> <span class="com">// c</span>`,
+				`}`,
+			},
+		},
+		"shell": {
+			lang: "sh",
+			code: "if [ $# -eq 0 ]; then echo \"${HOME}\" # hi\nfi",
+			expect: []string{
+				`<span class="kw">if</span> [ <span class="var">$#</span> -eq <span class="num">0</span> ]; <span class="kw">then</span> <span class="bi">echo</span> <span class="str">&#34;${HOME}&#34;</span> <span class="com"># hi</span>`,
+				`<span class="kw">fi</span>`,
+			},
+		},
+		"json": {
+			lang: "json",
+			code: `{"a": [1.5e-3, true, "b"]}`,
+			expect: []string{
+				`{<span class="key">&#34;a&#34;</span>: [<span class="num">1.5e-3</span>, <span class="lit">true</span>, <span class="str">&#34;b&#34;</span>]}`,
+			},
+		},
+		"yaml": {
+			lang: "yml",
+			code: "a: 1 # c\n- b c: no",
+			expect: []string{
+				`<span class="key">a</span>: <span class="num">1</span> <span class="com"># c</span>`,
+				`- <span class="key">b c</span>: <span class="lit">no</span>`,
+			},
+		},
+		"python": {
+			lang: "python",
+			code: "def f():\n    '''doc\n    '''\n    return None",
+			expect: []string{
+				`<span class="kw">def</span> f():`,
+				`    <span class="str">&#39;&#39;&#39;doc</span>`,
+				`<span class="str">    &#39;&#39;&#39;</span>`,
+				`    <span class="kw">return</span> <span class="lit">None</span>`,
+			},
+		},
+		"javascript": {
+			lang: "js",
+			code: "const a = `x<${b}>`; // c",
+			expect: []string{
+				`<span class="kw">const</span> a = <span class="str">` + "`x&lt;${b}&gt;`" + `</span>; <span class="com">// c</span>`,
+			},
+		},
+		"c": {
+			lang: "c",
+			code: "#include <stdio.h>\nint main() { return '\\0'; }",
+			expect: []string{
+				`<span class="pre">#include &lt;stdio.h&gt;</span>`,
+				`<span class="kw">int</span> main() { <span class="kw">return</span> <span class="str">&#39;\0&#39;</span>; }`,
+			},
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			l := findLexer(c.lang)
+			if l == nil {
+				t.Fatalf("can't find lexer for %q\n", c.lang)
+			}
+			got := highlightLines(l, c.code)
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("got:\n%s\nbut want:\n%s\n",
+					strings.Join(got, "\n"), strings.Join(c.expect, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseLineRanges(t *testing.T) {
+	for name, c := range map[string]struct {
+		input     string
+		expectErr bool
+		expect    lineRanges
+	}{
+		"empty": {
+			input:  "{}",
+			expect: lineRanges{},
+		},
+		"normal": {
+			input:  "{1, 3-5}",
+			expect: lineRanges{{1, 1}, {3, 5}},
+		},
+		"huge": {
+			input:  "{1-50000000}",
+			expect: lineRanges{{1, 50000000}},
+		},
+		"reversed": {
+			input:     "{5-3}",
+			expectErr: true,
+		},
+		"noBrace": {
+			input:     "1,3",
+			expectErr: true,
+		},
+		"notNumber": {
+			input:     "{a-b}",
+			expectErr: true,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, err := parseLineRanges(c.input)
+			if (err != nil) != c.expectErr {
+				t.Fatalf("got error %v, but want error: %v\n", err, c.expectErr)
+			}
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("got %v, but want %v\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestLineRangesHas(t *testing.T) {
+	hl := lineRanges{{1, 1}, {3, 50000000}}
+	for n, expect := range map[int]bool{0: false, 1: true, 2: false, 3: true, 50000000: true, 50000001: false} {
+		if got := hl.has(n); got != expect {
+			t.Errorf("line %d: got %v, but want %v\n", n, got, expect)
+		}
+	}
+}
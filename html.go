@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"html"
+	"strings"
+)
+
+// A tiny html tokenizer, enough for post-processing the html given by
+// the generators.
+
+type tokenKind int
+
+const (
+	textToken tokenKind = iota
+	startTagToken
+	endTagToken
+	selfClosingTagToken
+	commentToken
+)
+
+// htmlToken is a piece of html
+type htmlToken struct {
+	kind tokenKind
+	raw  string // the origin text of this token
+	name string // lower case tag name, only for tags
+}
+
+// voidElements never have an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements contain text only up to their end tag
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+}
+
+// tokenizeHTML splits s into tokens, the concatenation of all the tokens'
+// raw text is s itself.
+func tokenizeHTML(s string) []htmlToken {
+	var tokens []htmlToken
+	for len(s) != 0 {
+		i := strings.IndexByte(s, '<')
+		if i != 0 {
+			if i < 0 {
+				i = len(s)
+			}
+			tokens = append(tokens, htmlToken{kind: textToken, raw: s[:i]})
+			s = s[i:]
+			continue
+		}
+
+		t, n := nextTag(s)
+		tokens = append(tokens, t)
+		s = s[n:]
+
+		// the contents of raw text elements are never parsed
+		if t.kind == startTagToken && rawTextElements[t.name] {
+			end := indexFold(s, "</"+t.name)
+			if end < 0 {
+				end = len(s)
+			}
+			if end != 0 {
+				tokens = append(tokens, htmlToken{kind: textToken, raw: s[:end]})
+				s = s[end:]
+			}
+		}
+	}
+	return tokens
+}
+
+// nextTag parses the tag (or comment) at the beginning of s, which starts
+// with '<'. It returns the token and its length.
+func nextTag(s string) (htmlToken, int) {
+	if strings.HasPrefix(s, "<!--") {
+		n := strings.Index(s[4:], "-->")
+		if n < 0 {
+			return htmlToken{kind: commentToken, raw: s}, len(s)
+		}
+		n += 4 + 3
+		return htmlToken{kind: commentToken, raw: s[:n]}, n
+	}
+
+	kind := startTagToken
+	begin := 1
+	if strings.HasPrefix(s, "</") {
+		kind = endTagToken
+		begin = 2
+	}
+	// a tag name must start with a letter, otherwise it's just text
+	if begin >= len(s) || !isASCIILetter(s[begin]) {
+		if strings.HasPrefix(s, "<!") || strings.HasPrefix(s, "<?") {
+			n := strings.IndexByte(s, '>') + 1
+			if n == 0 {
+				n = len(s)
+			}
+			return htmlToken{kind: commentToken, raw: s[:n]}, n
+		}
+		return htmlToken{kind: textToken, raw: s[:1]}, 1
+	}
+
+	end := begin
+	for end < len(s) && !isTagNameEnd(s[end]) {
+		end++
+	}
+	name := strings.ToLower(s[begin:end])
+
+	// find the closing '>' outside of the quoted values
+	var quote byte
+	n := end
+	for ; n < len(s); n++ {
+		c := s[n]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '"' || c == '\'' {
+			quote = c
+		} else if c == '>' {
+			break
+		}
+	}
+	if n < len(s) {
+		n++
+	}
+	raw := s[:n]
+	if kind == startTagToken && (voidElements[name] || strings.HasSuffix(raw, "/>")) {
+		kind = selfClosingTagToken
+	}
+	return htmlToken{kind: kind, raw: raw, name: name}, n
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isTagNameEnd(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\f', '/', '>':
+		return true
+	}
+	return false
+}
+
+// indexFold is a case insensitive strings.Index
+func indexFold(s, substr string) int {
+	return strings.Index(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// closeTags gives the end tags of all the unclosed elements in tokens
+func closeTags(tokens []htmlToken) string {
+	var open []string
+	for _, t := range tokens {
+		switch t.kind {
+		case startTagToken:
+			open = append(open, t.name)
+		case endTagToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == t.name {
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+	var b strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+// htmlAttr is an attribute of a tag
+type htmlAttr struct {
+	name  string // lower case
+	value string // unescaped
+}
+
+// attrs parses the attributes of a tag token
+func (t htmlToken) attrs() []htmlAttr {
+	if t.kind != startTagToken && t.kind != selfClosingTagToken {
+		return nil
+	}
+	s := strings.TrimSuffix(t.raw, ">")
+	s = s[1+len(t.name):]
+
+	var attrs []htmlAttr
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f/")
+		if s == "" {
+			return attrs
+		}
+		n := strings.IndexAny(s, " \t\n\r\f/=")
+		if n < 0 {
+			n = len(s)
+		}
+		a := htmlAttr{name: strings.ToLower(s[:n])}
+		s = strings.TrimLeft(s[n:], " \t\n\r\f")
+		if strings.HasPrefix(s, "=") {
+			s = strings.TrimLeft(s[1:], " \t\n\r\f")
+			var v string
+			if s != "" && (s[0] == '"' || s[0] == '\'') {
+				end := strings.IndexByte(s[1:], s[0])
+				if end < 0 {
+					v, s = s[1:], ""
+				} else {
+					v, s = s[1:end+1], s[end+2:]
+				}
+			} else {
+				end := strings.IndexAny(s, " \t\n\r\f")
+				if end < 0 {
+					end = len(s)
+				}
+				v, s = s[:end], s[end:]
+			}
+			a.value = html.UnescapeString(v)
+		}
+		if a.name != "" {
+			attrs = append(attrs, a)
+		}
+	}
+}
+
+// buildTag gives the html of a start tag
+func buildTag(name string, attrs []htmlAttr, selfClosing bool) string {
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for _, a := range attrs {
+		b.WriteString(" " + a.name + `="` + html.EscapeString(a.value) + `"`)
+	}
+	if selfClosing {
+		b.WriteString(" /")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// urlAttributes are the attributes containing an url
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "poster": true, "cite": true,
+}
+
+// RewriteURLs replaces the urls in the html with the ones given by f,
+// the tags without any url changed are kept untouched.
+func RewriteURLs(s string, f func(string) string) string {
+	var b strings.Builder
+	for _, t := range tokenizeHTML(s) {
+		if t.kind != startTagToken && t.kind != selfClosingTagToken {
+			b.WriteString(t.raw)
+			continue
+		}
+		attrs := t.attrs()
+		changed := false
+		for i, a := range attrs {
+			if !urlAttributes[a.name] {
+				continue
+			}
+			if u := f(a.value); u != a.value {
+				attrs[i].value = u
+				changed = true
+			}
+		}
+		if !changed {
+			b.WriteString(t.raw)
+			continue
+		}
+		b.WriteString(buildTag(t.name, attrs, strings.HasSuffix(t.raw, "/>")))
+	}
+	return b.String()
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteURLs(t *testing.T) {
+	abs := func(u string) string {
+		if strings.HasPrefix(u, "/") {
+			return "http://example.com" + u
+		}
+		return u
+	}
+	for name, c := range map[string]struct {
+		input  string
+		expect string
+	}{
+		"img": {
+			input:  `<p><img src="/images/k/a.png" alt="a"></p>`,
+			expect: `<p><img src="http://example.com/images/k/a.png" alt="a"></p>`,
+		},
+		"selfClosing": {
+			input:  `<img src='/a.png'/>`,
+			expect: `<img src="http://example.com/a.png" />`,
+		},
+		"untouched": {
+			input:  `<a  href="http://other.com/" class=x>link</a>`,
+			expect: `<a  href="http://other.com/" class=x>link</a>`,
+		},
+		"escaped": {
+			input:  `<a href="/a?b=1&amp;c=2">link</a>`,
+			expect: `<a href="http://example.com/a?b=1&amp;c=2">link</a>`,
+		},
+		"text": {
+			input:  `<code>src="/a.png"</code>`,
+			expect: `<code>src="/a.png"</code>`,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := RewriteURLs(c.input, abs); got != c.expect {
+				t.Errorf("expect %q, got %q\n", c.expect, got)
+			}
+		})
+	}
+}
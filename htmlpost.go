@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"errors"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	RegisterNamedGenerator("html", 0, htmlGenerator{})
+}
+
+// htmlGenerator generates the posts written in html. The title is the
+// one of <title>, the date and tags are given by the <meta> tags, like
+// <meta name="date" content="2006-01-02"> and
+// <meta name="keywords" content="go, web">, and so are the optional
+// attributes, like <meta name="draft" content="true">. The content is
+// the <body>. A file without both the <title> and the date isn't a post,
+// like a fragment included by the others.
+type htmlGenerator struct{}
+
+func (htmlGenerator) Match(filename string) bool {
+	return strings.HasSuffix(filename, ".html") || strings.HasSuffix(filename, ".htm")
+}
+
+// the names of the <meta> tags for the date and tags besides the ones of
+// knownAttrs, in the "name" or "property" attribute
+var (
+	htmlDateMetas = map[string]bool{
+		"date":                   true,
+		"dcterms.date":           true,
+		"article:published_time": true,
+	}
+	htmlTagsMetas = map[string]bool{
+		"keywords":    true,
+		"tags":        true,
+		"article:tag": true,
+	}
+	htmlUpdatedMetas = map[string]bool{
+		"dcterms.modified":      true,
+		"article:modified_time": true,
+	}
+)
+
+// Sniff recognizes a document starting with <!DOCTYPE html> or <html>
+func (htmlGenerator) Sniff(head []byte) bool {
+	s := strings.ToLower(strings.TrimSpace(string(head)))
+	return strings.HasPrefix(s, "<!doctype html") || strings.HasPrefix(s, "<html")
+}
+
+func (htmlGenerator) Generate(input io.Reader, s Staticer) (Poster, error) {
+	c, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	tokens := tokenizeHTML(string(c))
+
+	var (
+		m         meta
+		hasDate   bool
+		hasTitle  bool
+		bodyStart = -1 // the index of the first token in the body
+		bodyEnd   = len(tokens)
+		headEnd   = -1 // the index after </head>, or the last tag of the head
+		line      = 1
+	)
+	for i, t := range tokens {
+		switch {
+		case t.kind == startTagToken && t.name == "title" && !hasTitle:
+			if i+1 < len(tokens) && tokens[i+1].kind == textToken {
+				m.title = strings.TrimSpace(html.UnescapeString(tokens[i+1].raw))
+			}
+			hasTitle = true
+		case (t.kind == startTagToken || t.kind == selfClosingTagToken) && t.name == "meta":
+			if err := applyMeta(&m, t.attrs(), &hasDate); err != nil {
+				return nil, &LineError{line, err}
+			}
+			if headEnd <= i {
+				headEnd = i + 1
+			}
+		case t.kind == endTagToken && t.name == "title" && headEnd <= i:
+			headEnd = i + 1
+		case t.kind == endTagToken && t.name == "head":
+			headEnd = i + 1
+		case t.kind == startTagToken && t.name == "body" && bodyStart < 0:
+			bodyStart = i + 1
+		case t.kind == endTagToken && t.name == "body":
+			bodyEnd = i
+		}
+		line += strings.Count(t.raw, "\n")
+	}
+	if !hasTitle && !hasDate {
+		return nil, errNotPost
+	}
+	if m.title == "" {
+		return nil, &LineError{1, errors.New("html: can't find the <title>\n")}
+	}
+	if !hasDate {
+		return nil, &LineError{1, errors.New("html: can't find the date <meta>\n")}
+	}
+	if bodyStart < 0 {
+		bodyStart = headEnd
+		if bodyStart < 0 {
+			bodyStart = 0
+		}
+	}
+	if bodyEnd < bodyStart {
+		bodyEnd = len(tokens)
+	}
+
+	m.key = generateKey(m.title, m.slug, s)
+	mk := &markup{key: m.key, s: s}
+	htmlBody(mk, tokens[bodyStart:bodyEnd])
+	mk.fill(&m)
+	return newPost(m), nil
+}
+
+// applyMeta fills the meta with a <meta> tag
+func applyMeta(m *meta, attrs []htmlAttr, hasDate *bool) error {
+	var name, content string
+	for _, a := range attrs {
+		switch a.name {
+		case "name", "property":
+			name = strings.ToLower(strings.TrimSpace(a.value))
+		case "content":
+			content = strings.TrimSpace(a.value)
+		}
+	}
+	switch {
+	case htmlDateMetas[name]:
+		d, err := parseDate(content)
+		if err != nil {
+			return err
+		}
+		m.date, *hasDate = d, true
+	case htmlUpdatedMetas[name]:
+		return m.applyAttr(attrUpdated, datePattern.FindString(content))
+	case htmlTagsMetas[name]:
+		for _, tag := range strings.Split(content, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				m.tags = append(m.tags, tag)
+			}
+		}
+	case knownAttrs[name]:
+		return m.applyAttr(name, content)
+	}
+	return nil
+}
+
+// linkElements are the elements whose relative urls are rewritten
+var linkElements = map[string]bool{
+	"img": true, "a": true, "video": true, "audio": true,
+	"source": true, "track": true, "iframe": true, "embed": true,
+}
+
+// htmlBody writes the tokens of the body, the local images and links are
+// prefixed and collected, and the headings get an unique id for the toc
+func htmlBody(mk *markup, tokens []htmlToken) {
+	// the ids given by the author are never generated
+	for _, t := range tokens {
+		if t.kind != startTagToken && t.kind != selfClosingTagToken {
+			continue
+		}
+		for _, a := range t.attrs() {
+			if a.name == "id" && a.value != "" {
+				mk.toc.reserve(a.value)
+			}
+		}
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind != startTagToken && t.kind != selfClosingTagToken {
+			mk.out.WriteString(t.raw)
+			continue
+		}
+		switch {
+		case linkElements[t.name]:
+			attrs := t.attrs()
+			changed := false
+			for j, a := range attrs {
+				switch {
+				case t.name == "img" && a.name == "src" && isLocalLink(a.value):
+					attrs[j].value = mk.image(a.value)
+				case urlAttributes[a.name] && isRelativeLink(a.value):
+					attrs[j].value = mk.href(a.value)
+				default:
+					continue
+				}
+				changed = true
+			}
+			if changed {
+				mk.out.WriteString(buildTag(t.name, attrs, strings.HasSuffix(t.raw, "/>")))
+				continue
+			}
+		case t.kind == startTagToken && len(t.name) == 2 && t.name[0] == 'h' && t.name[1] >= '1' && t.name[1] <= '6':
+			level := int(t.name[1] - '0')
+			end := i + 1
+			for end < len(tokens) && !(tokens[end].kind == endTagToken && tokens[end].name == t.name) {
+				end++
+			}
+			var inner strings.Builder
+			for _, it := range tokens[i+1 : end] {
+				inner.WriteString(it.raw)
+			}
+			title := htmlText(inner.String())
+			attrs := t.attrs()
+			id := ""
+			for _, a := range attrs {
+				if a.name == "id" {
+					id = a.value
+				}
+			}
+			if id == "" {
+				id = mk.toc.uniqueID(title)
+				attrs = append(attrs, htmlAttr{name: "id", value: id})
+				mk.out.WriteString(buildTag(t.name, attrs, false))
+			} else {
+				mk.out.WriteString(t.raw)
+			}
+			mk.toc.add(level, title, id)
+			continue
+		}
+		mk.out.WriteString(t.raw)
+	}
+	content := strings.TrimSpace(mk.out.String())
+	if content != "" {
+		content += "\n"
+	}
+	mk.out.Reset()
+	mk.out.WriteString(content)
+}
+
+// isLocalLink reports whether the link is to a file in the repository,
+// rather than an url with a scheme or host, or a fragment
+func isLocalLink(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && u.Scheme == "" && u.Host == "" && u.Path != ""
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHTMLMatch(t *testing.T) {
+	for name, c := range map[string]struct {
+		path   string
+		expect bool
+	}{
+		"html": {
+			path:   "a/b/c.html",
+			expect: true,
+		},
+		"htm": {
+			path:   "a/b/c.htm",
+			expect: true,
+		},
+		"unmatch": {
+			path:   "a/b/c.xhtml5",
+			expect: false,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := (htmlGenerator{}).Match(c.path); got != c.expect {
+				t.Errorf("got %v, but want %v\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestHTMLGenerate(t *testing.T) {
+	const head = "<html><head><title>hello &amp; world</title>\n<meta name=\"date\" content=\"2012-12-01\">\n"
+	for name, c := range map[string]struct {
+		input        string
+		expectErr    error
+		expectResult Poster
+	}{
+		"normal": {
+			input: head + "<meta name=\"keywords\" content=\"tag1, tag2\"></head>\n<body class=\"x\">\n<h1>Title <em>hello</em></h1>\n</body></html>\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello & world",
+				date:    parseTime("2012-12-01"),
+				tags:    []string{"tag1", "tag2"},
+				content: "<h1 id=\"title-hello\">Title <em>hello</em></h1>\n",
+				toc: []*Heading{
+					{Level: 1, Title: "Title hello", Anchor: "title-hello"},
+				},
+			}),
+		},
+		"attributes": {
+			input: "<title>hello world</title><meta property=\"article:published_time\" content=\"2012-12-01T08:00:00Z\">" +
+				"<meta property=\"article:modified_time\" content=\"2013-01-02T08:00:00Z\">" +
+				"<meta name=\"draft\" content=\"true\"><meta name=\"slug\" content=\"Hello Go\">" +
+				"<meta property=\"article:tag\" content=\"a\"><meta property=\"article:tag\" content=\"b\">",
+			expectResult: newPost(meta{
+				key:     "Hello_Go",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				updated: parseTime("2013-01-02"),
+				tags:    []string{"a", "b"},
+				draft:   true,
+			}),
+		},
+		"noBody": {
+			input: head + "</head>\n<p>hi</p>\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello & world",
+				date:    parseTime("2012-12-01"),
+				content: "<p>hi</p>\n",
+			}),
+		},
+		"images": {
+			input: head + "<body><img src=\"1.png\" alt=\"1\"><img src=\"/2/2.png\"/><img src=\"http://3/3.png\"><img src=\"data:image/png;base64,AA\"></body>",
+			expectResult: newPost(meta{
+				key:        "hello_world",
+				title:      "hello & world",
+				date:       parseTime("2012-12-01"),
+				content:    "<img src=\"/images/hello_world/1.png\" alt=\"1\"><img src=\"/images/hello_world//2/2.png\" /><img src=\"http://3/3.png\"><img src=\"data:image/png;base64,AA\">\n",
+				staticList: []string{"/images/hello_world/1.png", "/images/hello_world//2/2.png"},
+			}),
+		},
+		"headings": {
+			input: head + "<body><h2 id=\"own\">Own</h2><h3>Sub</h3><h2>Own</h2></body>",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello & world",
+				date:    parseTime("2012-12-01"),
+				content: "<h2 id=\"own\">Own</h2><h3 id=\"sub\">Sub</h3><h2 id=\"own-1\">Own</h2>\n",
+				toc: []*Heading{
+					{Level: 2, Title: "Own", Anchor: "own", Children: []*Heading{
+						{Level: 3, Title: "Sub", Anchor: "sub"},
+					}},
+					{Level: 2, Title: "Own", Anchor: "own-1"},
+				},
+			}),
+		},
+		"headingBeforeOwnID": {
+			input: head + "<body><h2>Intro</h2><h2 id=\"intro\">Again</h2></body>",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello & world",
+				date:    parseTime("2012-12-01"),
+				content: "<h2 id=\"intro-1\">Intro</h2><h2 id=\"intro\">Again</h2>\n",
+				toc: []*Heading{
+					{Level: 2, Title: "Intro", Anchor: "intro-1"},
+					{Level: 2, Title: "Again", Anchor: "intro"},
+				},
+			}),
+		},
+		"notPost": {
+			input:     "<html><body>hi</body></html>",
+			expectErr: errNotPost,
+		},
+		"noTitle": {
+			input:     "<meta name=\"date\" content=\"2012-12-01\"><p>hi</p>",
+			expectErr: errors.New("line 1: html: can't find the <title>"),
+		},
+		"noDate": {
+			input:     "<title>t</title>",
+			expectErr: errors.New("line 1: html: can't find the date <meta>"),
+		},
+		"invalidDate": {
+			input:     "<title>t</title>\n\n<meta name=\"date\" content=\"someday\">",
+			expectErr: errors.New("line 3: invalid date \"someday\""),
+		},
+		"invalidDraft": {
+			input:     head + "<meta name=\"draft\" content=\"maybe\">",
+			expectErr: errors.New("line 3: invalid draft attribute"),
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, err := htmlGenerator{}.Generate(strings.NewReader(c.input), nil)
+			if err = matchError(c.expectErr, err); err != nil {
+				t.Error(err)
+			}
+			if c.expectResult != nil && !isPosterEqual(got, c.expectResult) {
+				t.Errorf("\n\tgot result: %#v,\n\tbut want %#v\n", got, c.expectResult)
+			}
+		})
+	}
+}
@@ -12,5 +12,5 @@ type StringKey string
 func (s StringKey) Key() string { return string(s) }
 
 var (
-	_ Keyer = *(*StringKey)(nil)
+	_ Keyer = StringKey("")
 )
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Linker is optionally implemented by a Poster to tell the keys of the
+// posts it links to
+type Linker interface {
+	Links() []string
+}
+
+func links(v interface{}) []string {
+	if l, ok := v.(Linker); ok {
+		return l.Links()
+	}
+	return nil
+}
+
+// Warner is optionally implemented by a Poster to tell the problems
+// found when generating it, like the missing static resources
+type Warner interface {
+	Warnings() []string
+}
+
+func warnings(v interface{}) []string {
+	if w, ok := v.(Warner); ok {
+		return w.Warnings()
+	}
+	return nil
+}
+
+// Backlinker is optionally implemented by a Storager to tell the posts
+// linking to a post
+type Backlinker interface {
+	Backlinks(key string) ([]Poster, error)
+}
+
+var _ Backlinker = &Storage{}
+
+// Warning is a problem of a post in the storage
+type Warning struct {
+	Key    string
+	Source string // where the post comes from, see Sourcer
+	Msg    string
+}
+
+func (w Warning) String() string {
+	if w.Source == "" {
+		return fmt.Sprintf("%s: %s", w.Key, w.Msg)
+	}
+	return fmt.Sprintf("%s(%s): %s", w.Key, w.Source, w.Msg)
+}
+
+// relink updates the links graph after the post with the key is changed
+func (d *Storage) relink(key string) {
+	for _, target := range d.links[key] {
+		delete(d.backlinks[target], key)
+		if len(d.backlinks[target]) == 0 {
+			delete(d.backlinks, target)
+		}
+	}
+	delete(d.links, key)
+
+	p, found := d.data[key]
+	if !found {
+		return
+	}
+	targets := links(p)
+	if len(targets) == 0 {
+		return
+	}
+	d.links[key] = targets
+	for _, target := range targets {
+		if d.backlinks[target] == nil {
+			d.backlinks[target] = make(map[string]bool)
+		}
+		d.backlinks[target][key] = true
+	}
+}
+
+// resolve gives the current key of the key, which may be a previous one
+func (d *Storage) resolve(key string) (string, bool) {
+	if _, found := d.data[key]; found {
+		return key, true
+	}
+	current, found := d.aliases[key]
+	return current, found
+}
+
+// backlinksOf gives the keys of the posts linking to the post with the
+// key, including the links to its previous keys
+func (d *Storage) backlinksOf(key string) []string {
+	keys := make([]string, 0)
+	from := make(map[string]bool)
+	for target, sources := range d.backlinks {
+		if current, found := d.resolve(target); !found || current != key {
+			continue
+		}
+		for k := range sources {
+			if k != key && !from[k] {
+				from[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+// warningsOf gives the warnings of all the posts, including the links to
+// the posts not in the storage
+func (d *Storage) warningsOf() []Warning {
+	ws := make([]Warning, 0)
+	for key, p := range d.data {
+		for _, msg := range warnings(p) {
+			ws = append(ws, Warning{Key: key, Source: source(p), Msg: msg})
+		}
+		for _, target := range d.links[key] {
+			if _, found := d.resolve(target); !found {
+				ws = append(ws, Warning{
+					Key:    key,
+					Source: source(p),
+					Msg:    fmt.Sprintf("broken link to post(%s)", target),
+				})
+			}
+		}
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		if ws[i].Key != ws[j].Key {
+			return ws[i].Key < ws[j].Key
+		}
+		return ws[i].Msg < ws[j].Msg
+	})
+	return ws
+}
+
+// Backlinks gives the published posts linking to the post with the key,
+// the latest first
+func (s *Storage) Backlinks(key string) ([]Poster, error) {
+	r := &request{
+		cmd:    backlinks,
+		args:   []interface{}{key},
+		result: make(chan *Result, 1),
+		err:    make(chan error, 1),
+	}
+	s.requestCh <- r
+	if err := <-r.err; err != nil {
+		return nil, err
+	}
+	result := <-r.result
+	sort.Sort(result)
+	return result.Content, nil
+}
+
+// Warnings gives the warnings of the posts in the storage, like the
+// broken links and the missing static resources
+func (s *Storage) Warnings() []Warning {
+	r := &request{
+		cmd:      warns,
+		warnings: make(chan []Warning, 1),
+	}
+	s.requestCh <- r
+	return <-r.warnings
+}
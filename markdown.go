@@ -3,6 +3,7 @@ package storage
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
@@ -27,16 +28,120 @@ const (
 )
 
 func init() {
-	RegisterGenerator(markdownGenerator{})
+	RegisterNamedGenerator("markdown", 0, markdownGenerator{})
 }
 
-type markdownGenerator struct{}
+// markdownGenerator generates the markdown posts, the zero value uses
+// the default flags
+type markdownGenerator struct {
+	// the flags added to or removed from the defaults
+	addHTML, removeHTML int
+	addExt, removeExt   int
+	imagePrefix         string
+}
+
+// MarkdownOptions are the options of a markdown generator. The
+// extensions and html flags are named after the ones of blackfriday,
+// like "footnotes" for EXTENSION_FOOTNOTES, they are added to the
+// defaults, or removed from them if prefixed with '-'.
+type MarkdownOptions struct {
+	Extensions []string `json:"extensions"`
+	HTMLFlags  []string `json:"htmlFlags"`
+	// ImagePrefix replaces the ImagePrefix of the local images' links,
+	// and the Prefix of the repository's StaticURL, whose Base and Hash
+	// still apply
+	ImagePrefix string `json:"imagePrefix"`
+}
+
+var (
+	markdownExtensions = map[string]int{
+		"noIntraEmphasis":        blackfriday.EXTENSION_NO_INTRA_EMPHASIS,
+		"tables":                 blackfriday.EXTENSION_TABLES,
+		"fencedCode":             blackfriday.EXTENSION_FENCED_CODE,
+		"autolink":               blackfriday.EXTENSION_AUTOLINK,
+		"strikethrough":          blackfriday.EXTENSION_STRIKETHROUGH,
+		"laxHTMLBlocks":          blackfriday.EXTENSION_LAX_HTML_BLOCKS,
+		"spaceHeaders":           blackfriday.EXTENSION_SPACE_HEADERS,
+		"hardLineBreak":          blackfriday.EXTENSION_HARD_LINE_BREAK,
+		"tabSizeEight":           blackfriday.EXTENSION_TAB_SIZE_EIGHT,
+		"footnotes":              blackfriday.EXTENSION_FOOTNOTES,
+		"noEmptyLineBeforeBlock": blackfriday.EXTENSION_NO_EMPTY_LINE_BEFORE_BLOCK,
+		"headerIDs":              blackfriday.EXTENSION_HEADER_IDS,
+		"autoHeaderIDs":          blackfriday.EXTENSION_AUTO_HEADER_IDS,
+		"backslashLineBreak":     blackfriday.EXTENSION_BACKSLASH_LINE_BREAK,
+		"definitionLists":        blackfriday.EXTENSION_DEFINITION_LISTS,
+		"joinLines":              blackfriday.EXTENSION_JOIN_LINES,
+	}
+	markdownHTMLFlags = map[string]int{
+		"skipHTML":                blackfriday.HTML_SKIP_HTML,
+		"skipStyle":               blackfriday.HTML_SKIP_STYLE,
+		"skipImages":              blackfriday.HTML_SKIP_IMAGES,
+		"skipLinks":               blackfriday.HTML_SKIP_LINKS,
+		"safelink":                blackfriday.HTML_SAFELINK,
+		"nofollowLinks":           blackfriday.HTML_NOFOLLOW_LINKS,
+		"noreferrerLinks":         blackfriday.HTML_NOREFERRER_LINKS,
+		"hrefTargetBlank":         blackfriday.HTML_HREF_TARGET_BLANK,
+		"useXHTML":                blackfriday.HTML_USE_XHTML,
+		"useSmartypants":          blackfriday.HTML_USE_SMARTYPANTS,
+		"smartypantsFractions":    blackfriday.HTML_SMARTYPANTS_FRACTIONS,
+		"smartypantsDashes":       blackfriday.HTML_SMARTYPANTS_DASHES,
+		"smartypantsLatexDashes":  blackfriday.HTML_SMARTYPANTS_LATEX_DASHES,
+		"smartypantsAngledQuotes": blackfriday.HTML_SMARTYPANTS_ANGLED_QUOTES,
+		"footnoteReturnLinks":     blackfriday.HTML_FOOTNOTE_RETURN_LINKS,
+	}
+)
+
+// NewMarkdownGenerator creates a markdown generator with the options
+func NewMarkdownGenerator(opts MarkdownOptions) (Generator, error) {
+	var (
+		g   = markdownGenerator{imagePrefix: opts.ImagePrefix}
+		err error
+	)
+	if g.addExt, g.removeExt, err = parseFlags(opts.Extensions, markdownExtensions); err != nil {
+		return nil, fmt.Errorf("markdown: extension %s", err)
+	}
+	if g.addHTML, g.removeHTML, err = parseFlags(opts.HTMLFlags, markdownHTMLFlags); err != nil {
+		return nil, fmt.Errorf("markdown: html flag %s", err)
+	}
+	return g, nil
+}
+
+// parseFlags gives the flags to add and the ones to remove, which are
+// prefixed with '-'
+func parseFlags(names []string, known map[string]int) (add, remove int, err error) {
+	for _, name := range names {
+		flags := &add
+		if strings.HasPrefix(name, "-") {
+			flags, name = &remove, name[1:]
+		}
+		flag, ok := known[name]
+		if !ok {
+			return 0, 0, fmt.Errorf("%q is unknown\n", name)
+		}
+		*flags |= flag
+	}
+	return add, remove, nil
+}
 
 func (m markdownGenerator) Match(filename string) bool {
 	return strings.HasSuffix(filename, ".md")
 }
 
-func (markdownGenerator) Generate(input io.Reader, _ Staticer) (Poster, error) {
+// Sniff recognizes the header line like "title | date | tags"
+func (markdownGenerator) Sniff(head []byte) bool {
+	line := head
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		line = head[:i]
+	}
+	parts := strings.Split(string(line), seperator)
+	if len(parts) != 3 {
+		return false
+	}
+	_, err := time.Parse(timePattern, strings.TrimSpace(parts[1]))
+	return err == nil
+}
+
+func (g markdownGenerator) Generate(input io.Reader, s Staticer) (Poster, error) {
 	c, e := ioutil.ReadAll(input)
 	if e != nil {
 		return nil, e
@@ -44,21 +149,19 @@ func (markdownGenerator) Generate(input io.Reader, _ Staticer) (Poster, error) {
 	// title
 	firstLineIndex := strings.Index(string(c), "\n")
 	if firstLineIndex == -1 {
-		return nil, errors.New("generateAll: there must be at least one line\n")
+		return nil, &LineError{1, errors.New("generateAll: there must be at least one line\n")}
 	}
 	firstLine := strings.TrimSpace(string(c[:firstLineIndex]))
 	titleDateTags := strings.Split(firstLine, seperator)
 	if len(titleDateTags) != 3 {
-		return nil, errors.New("generateAll: can't find title, date and tags\n")
+		return nil, &LineError{1, errors.New("generateAll: can't find title, date and tags\n")}
 	}
 	title := strings.TrimSpace(titleDateTags[0])
 	// date
 	t, e := time.Parse(timePattern, strings.TrimSpace(titleDateTags[1]))
 	if e != nil {
-		return nil, e
+		return nil, &LineError{1, e}
 	}
-	// key
-	key := title2Key(title)
 	// tags
 	var tags []string
 	tagsString := strings.TrimSpace(titleDateTags[2])
@@ -68,41 +171,127 @@ func (markdownGenerator) Generate(input io.Reader, _ Staticer) (Poster, error) {
 			tags[i] = strings.TrimSpace(tag)
 		}
 	}
+	m := meta{
+		title:   title,
+		date:    t,
+		tags:    tags,
+		isSlide: false,
+	}
+	// optional attributes
+	remain := c[firstLineIndex+1:]
+	for lineNum := 2; len(remain) != 0; lineNum++ {
+		line := remain
+		next := len(remain)
+		if i := bytes.IndexByte(remain, '\n'); i != -1 {
+			line, next = remain[:i], i+1
+		}
+		name, value, ok := parseAttr(string(line))
+		if !ok {
+			break
+		}
+		if e := m.applyAttr(name, value); e != nil {
+			return nil, &LineError{lineNum, e}
+		}
+		remain = remain[next:]
+	}
+	// key
+	key := generateKey(title, m.slug, s)
+	m.key = key
 	// content
-	remain := bytes.TrimSpace(c[firstLineIndex+1:])
+	remain = bytes.TrimSpace(remain)
 	renderer := &myRender{
 		key:      key,
-		Renderer: blackfriday.HtmlRenderer(htmlFlags, "", ""),
+		s:        s,
+		prefix:   g.imagePrefix,
+		Renderer: blackfriday.HtmlRenderer((htmlFlags|g.addHTML)&^g.removeHTML, "", ""),
 	}
-	content := blackfriday.Markdown(remain, renderer, extensions)
+	content := blackfriday.Markdown(remain, renderer, (extensions|g.addExt)&^g.removeExt)
+	m.content = wikiLinks(s, bytes2String(content), &renderer.links)
+	m.staticList = renderer.images
+	m.links = renderer.links
+	m.toc = renderer.toc.toc
+	m.warnings = renderer.warnings
 
-	return newPost(meta{
-		key:        key,
-		title:      title,
-		date:       t,
-		content:    bytes2String(content),
-		tags:       tags,
-		isSlide:    false,
-		staticList: renderer.images,
-	}), nil
+	return newPost(m), nil
 }
 
 type myRender struct {
-	images []string // collect image links
-	key    string   // myself post key
+	images []string   // collect image links
+	links  []string   // collect the keys of the linked posts
+	key    string     // myself post key
+	s      Staticer   // of the post, which may build the image links
+	prefix string     // of the image links, ImagePrefix if empty
+	toc    tocBuilder // collect headings
+	// collect the problems, like the invalid highlighted lines
+	warnings []string
 	blackfriday.Renderer
 }
 
-func (mr *myRender) BlockCode(out *bytes.Buffer, text []byte, lang string) {
+// give every heading an unique id and add it into the toc
+func (mr *myRender) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	marker := out.Len()
+	if marker > 0 {
+		out.WriteByte('\n')
+	}
+	start := out.Len()
+	if !text() {
+		out.Truncate(marker)
+		return
+	}
+	inner := string(out.Bytes()[start:])
+	out.Truncate(start)
+
+	title := htmlText(inner)
+	if id == "" {
+		id = title
+	}
+	id = mr.toc.uniqueID(id)
+	fmt.Fprintf(out, "<h%d id=\"%s\">%s</h%d>\n", level, id, inner, level)
+	mr.toc.add(level, title, id)
+}
+
+func (mr *myRender) BlockCode(out *bytes.Buffer, text []byte, info string) {
 	out.WriteString(`<div class="code">`)
-	mr.Renderer.BlockCode(out, text, lang)
+	// info is like "go {1,3-5}", highlight the known languages
+	fields := strings.SplitN(strings.TrimSpace(info), " ", 2)
+	if l := findLexer(fields[0]); l != nil {
+		var hl lineRanges
+		if len(fields) == 2 {
+			var err error
+			if hl, err = parseLineRanges(fields[1]); err != nil {
+				mr.warnings = append(mr.warnings, err.Error())
+			}
+		}
+		out.WriteByte('\n')
+		out.WriteString(highlightBlock(l, fields[0], string(text), hl))
+	} else {
+		mr.Renderer.BlockCode(out, text, info)
+	}
 	out.WriteString(`</div>`)
 }
 
+// href gives the link of a relative link, see localLink
+func (mr *myRender) href(link string) string {
+	return localLink(mr.s, mr.prefix, mr.key, link, &mr.images, &mr.links)
+}
+
+// rewrite the relative links to the posts and the static resources
+func (mr *myRender) Link(out *bytes.Buffer, link, title, content []byte) {
+	mr.Renderer.Link(out, []byte(mr.href(string(link))), title, content)
+}
+
+func (mr *myRender) RawHtmlTag(out *bytes.Buffer, tag []byte) {
+	mr.Renderer.RawHtmlTag(out, []byte(RewriteURLs(string(tag), mr.href)))
+}
+
+func (mr *myRender) BlockHtml(out *bytes.Buffer, text []byte) {
+	mr.Renderer.BlockHtml(out, []byte(RewriteURLs(string(text), mr.href)))
+}
+
 // add prefix to img link
 func (mr *myRender) Image(out *bytes.Buffer, link, title, alt []byte) {
 	if slink := string(link); needChangeImageLink(slink) {
-		imageLink := generateImageLink(mr.key, slink)
+		imageLink := staticLink(mr.s, mr.prefix, mr.key, slink)
 		link = []byte(imageLink)
 		mr.images = append(mr.images, imageLink)
 	}
@@ -41,8 +41,11 @@ func TestMarkDownGenerate(t *testing.T) {
 				key:     "hello_world",
 				title:   "hello world",
 				date:    parseTime("2012-12-01"),
-				content: "<h1>title hello world</h1>\n",
+				content: "<h1 id=\"title-hello-world\">title hello world</h1>\n",
 				tags:    []string{"tag1", "tag2"},
+				toc: []*Heading{
+					{Level: 1, Title: "title hello world", Anchor: "title-hello-world"},
+				},
 			}),
 		},
 		"noTag": {
@@ -53,6 +56,80 @@ func TestMarkDownGenerate(t *testing.T) {
 				date:  parseTime("2012-12-01"),
 			}),
 		},
+		"draft": {
+			input: "hello world | 2012-12-01 | \ndraft: true\n# title hello world \n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				content: "<h1 id=\"title-hello-world\">title hello world</h1>\n",
+				draft:   true,
+				toc: []*Heading{
+					{Level: 1, Title: "title hello world", Anchor: "title-hello-world"},
+				},
+			}),
+		},
+		"slug": {
+			input: "hello world | 2012-12-01 | \nslug: Hello Go\n![1](1.png)\n",
+			expectResult: newPost(meta{
+				key:        "Hello_Go",
+				title:      "hello world",
+				date:       parseTime("2012-12-01"),
+				content:    "<p><img src=\"/images/Hello_Go/1.png\" alt=\"1\" /></p>\n",
+				staticList: []string{"/images/Hello_Go/1.png"},
+			}),
+		},
+		"updated": {
+			input: "hello world | 2012-12-01 | \nupdated: 2013-01-02\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				updated: parseTime("2013-01-02"),
+			}),
+		},
+		"invalidUpdated": {
+			input:     "hello world | 2012-12-01 | \nupdated: yesterday\n",
+			expectErr: errors.New("invalid updated attribute"),
+		},
+		"invalidDraft": {
+			input:     "hello world | 2012-12-01 | \ndraft: maybe\n",
+			expectErr: errors.New("invalid draft attribute"),
+		},
+		"toc": {
+			input: "hello world | 2012-12-01 | \n# Intro\n## *Go* & C\n## Go C\n# Intro\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				content: "<h1 id=\"intro\">Intro</h1>\n\n<h2 id=\"go-c\"><em>Go</em> &amp; C</h2>\n\n<h2 id=\"go-c-1\">Go C</h2>\n\n<h1 id=\"intro-1\">Intro</h1>\n",
+				toc: []*Heading{
+					{Level: 1, Title: "Intro", Anchor: "intro", Children: []*Heading{
+						{Level: 2, Title: "Go & C", Anchor: "go-c"},
+						{Level: 2, Title: "Go C", Anchor: "go-c-1"},
+					}},
+					{Level: 1, Title: "Intro", Anchor: "intro-1"},
+				},
+			}),
+		},
+		"highlight": {
+			input: "hello world | 2012-12-01 | \n```go {2}\nx := 1\nreturn x\n```\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				content: "<div class=\"code\">\n<pre class=\"numbers\"><code class=\"language-go\"><span num=\"1\">x := <span class=\"num\">1</span></span>\n<span num=\"2\" class=\"hl\"><span class=\"kw\">return</span> x</span>\n</code></pre>\n</div>",
+			}),
+		},
+		"unknownLanguage": {
+			input: "hello world | 2012-12-01 | \n```foo\nx := 1\n```\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				content: "<div class=\"code\">\n<pre><code class=\"language-foo\">x := 1\n</code></pre>\n</div>",
+			}),
+		},
 		"noContent": {
 			input:     "hello world | 2012-12-01 | tag1",
 			expectErr: errors.New("generateAll: there must be at least one line"),
@@ -99,3 +176,61 @@ func TestMarkDownGenerate(t *testing.T) {
 		})
 	}
 }
+
+func TestNewMarkdownGenerator(t *testing.T) {
+	for name, c := range map[string]struct {
+		opts         MarkdownOptions
+		expectErr    error
+		expectResult Poster
+	}{
+		"default": {
+			expectResult: newPost(meta{
+				key:        "hello",
+				title:      "hello",
+				date:       parseTime("2012-12-01"),
+				content:    "<p>a\nb <a href=\"http://x.org[^1\">http://x.org[^1</a>] <img src=\"/images/hello/1.png\" alt=\"1\" /></p>\n",
+				staticList: []string{"/images/hello/1.png"},
+			}),
+		},
+		"options": {
+			opts: MarkdownOptions{
+				Extensions:  []string{"footnotes", "hardLineBreak", "-autolink"},
+				HTMLFlags:   []string{"-useXHTML"},
+				ImagePrefix: "https://cdn.x.org/images",
+			},
+			expectResult: newPost(meta{
+				key:        "hello",
+				title:      "hello",
+				date:       parseTime("2012-12-01"),
+				content:    "<p>a<br>\nb http://x.org<sup class=\"footnote-ref\" id=\"fnref:1\"><a href=\"#fn:1\">1</a></sup> <img src=\"https://cdn.x.org/images/hello/1.png\" alt=\"1\"></p>\n<div class=\"footnotes\">\n\n<hr>\n\n<ol>\n<li id=\"fn:1\">note<br>\n</li>\n</ol>\n</div>\n",
+				staticList: []string{"https://cdn.x.org/images/hello/1.png"},
+			}),
+		},
+		"unknownExtension": {
+			opts:      MarkdownOptions{Extensions: []string{"noexist"}},
+			expectErr: errors.New("markdown: extension \"noexist\" is unknown"),
+		},
+		"unknownHTMLFlag": {
+			opts:      MarkdownOptions{HTMLFlags: []string{"-noexist"}},
+			expectErr: errors.New("markdown: html flag \"noexist\" is unknown"),
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			gen, err := NewMarkdownGenerator(c.opts)
+			if err = matchError(c.expectErr, err); err != nil {
+				t.Fatal(err)
+			}
+			if c.expectResult == nil {
+				return
+			}
+			got, err := gen.Generate(strings.NewReader("hello | 2012-12-01 |\na\nb http://x.org[^1] ![1](1.png)\n\n[^1]: note\n"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isPosterEqual(got, c.expectResult) {
+				t.Errorf("\n\tgot result: %#v,\n\tbut want %#v\n", got, c.expectResult)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// markup writes the html of a post for the generators of the light
+// weight markup languages, which are parsed by hand
+type markup struct {
+	key    string
+	s      Staticer   // of the post, which may build the image links
+	images []string   // collect image links
+	links  []string   // collect the keys of the linked posts
+	toc    tocBuilder // collect headings
+	out    strings.Builder
+}
+
+// heading writes a heading with an unique id and adds it into the toc
+func (mk *markup) heading(level int, inner string) {
+	title := htmlText(inner)
+	id := mk.toc.uniqueID(title)
+	fmt.Fprintf(&mk.out, "<h%d id=\"%s\">%s</h%d>\n", level, id, inner, level)
+	mk.toc.add(level, title, id)
+}
+
+// code writes a code block as the markdown generator does, the known
+// languages are highlighted
+func (mk *markup) code(lang, text string) {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	mk.out.WriteString("<div class=\"code\">\n")
+	if l := findLexer(lang); l != nil {
+		mk.out.WriteString(highlightBlock(l, lang, text, nil))
+	} else if lang != "" {
+		fmt.Fprintf(&mk.out, "<pre><code class=\"language-%s\">%s</code></pre>\n",
+			html.EscapeString(lang), html.EscapeString(text))
+	} else {
+		fmt.Fprintf(&mk.out, "<pre><code>%s</code></pre>\n", html.EscapeString(text))
+	}
+	mk.out.WriteString("</div>\n")
+}
+
+// image gives the link of an image, the local ones are prefixed and
+// collected
+func (mk *markup) image(link string) string {
+	if !needChangeImageLink(link) {
+		return link
+	}
+	link = staticLink(mk.s, "", mk.key, link)
+	mk.images = append(mk.images, link)
+	return link
+}
+
+// href gives the link of a relative link, which is the link of the post
+// or the static resource it points to, see localLink
+func (mk *markup) href(link string) string {
+	return localLink(mk.s, "", mk.key, link, &mk.images, &mk.links)
+}
+
+// img gives the html of an image
+func (mk *markup) img(link, alt string) string {
+	return fmt.Sprintf("<img src=\"%s\" alt=\"%s\" />",
+		html.EscapeString(mk.image(link)), html.EscapeString(alt))
+}
+
+// fill fills the meta with the written content, whose wiki-style links
+// are replaced
+func (mk *markup) fill(m *meta) {
+	m.content = wikiLinks(mk.s, mk.out.String(), &mk.links)
+	m.staticList = mk.images
+	m.links = mk.links
+	m.toc = mk.toc.toc
+}
+
+var imageExts = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".svg":  true,
+	".webp": true,
+}
+
+// isImage reports whether the link is of an image by its extension
+func isImage(link string) bool {
+	if i := strings.IndexAny(link, "?#"); i >= 0 {
+		link = link[:i]
+	}
+	return imageExts[strings.ToLower(path.Ext(link))]
+}
+
+var datePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// parseDate parses the first date like "2006-01-02" in s, so that the
+// time and weekday around it are allowed
+func parseDate(s string) (time.Time, error) {
+	d := datePattern.FindString(s)
+	if d == "" {
+		return time.Time{}, fmt.Errorf("invalid date %q\n", s)
+	}
+	return time.Parse(timePattern, d)
+}
+
+// wikiLinkRE matches a wiki-style link to a post, like "[[Title]]" or
+// "[[Title|text]]"
+var wikiLinkRE = regexp.MustCompile(`\[\[([^\[\]|]+)(?:\|([^\[\]]+))?\]\]`)
+
+// wikiLinks replaces the wiki-style links in the text of the html with
+// the links of the posts with the titles, whose keys are collected into
+// links. The ones in the code and the links are kept.
+func wikiLinks(s Staticer, content string, links *[]string) string {
+	if !strings.Contains(content, "[[") {
+		return content
+	}
+	var b strings.Builder
+	kept := 0 // the depth of the elements keeping the text
+	for _, t := range tokenizeHTML(content) {
+		keep := t.name == "code" || t.name == "pre" || t.name == "a"
+		switch {
+		case t.kind == startTagToken && keep:
+			kept++
+		case t.kind == endTagToken && keep && kept > 0:
+			kept--
+		case t.kind == textToken && kept == 0:
+			b.WriteString(wikiLinkRE.ReplaceAllStringFunc(t.raw, func(l string) string {
+				sm := wikiLinkRE.FindStringSubmatch(l)
+				title, text := html.UnescapeString(strings.TrimSpace(sm[1])), sm[1]
+				if sm[2] != "" {
+					text = sm[2]
+				}
+				key := titleKey(s, title)
+				addLink(links, key)
+				return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(PostLink(key)), strings.TrimSpace(text))
+			}))
+			continue
+		}
+		b.WriteString(t.raw)
+	}
+	return b.String()
+}
+
+// titleKey gives the key of the post with the title, which is found by s
+// if it's a PostFinder, or generated from the title otherwise
+func titleKey(s Staticer, title string) string {
+	if pf, ok := s.(PostFinder); ok {
+		if key, ok := pf.TitleKey(title); ok {
+			return key
+		}
+	}
+	return generateKey(title, "", s)
+}
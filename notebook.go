@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+func init() {
+	RegisterNamedGenerator("notebook", 0, notebookGenerator{})
+}
+
+// notebookGenerator generates the posts from the jupyter notebooks. The
+// title, date and tags are given by the notebook's metadata, like
+//
+//	"metadata": {"title": "hello", "date": "2006-01-02", "tags": ["go"]}
+//
+// and so are the optional attributes. The markdown cells are rendered
+// as the markdown posts, the code cells are highlighted, and their text,
+// html and png outputs are shown, the png ones are served as the static
+// resources of the post.
+type notebookGenerator struct{}
+
+func (notebookGenerator) Match(filename string) bool {
+	return strings.HasSuffix(filename, ".ipynb")
+}
+
+// Sniff recognizes a json object with the notebook's fields
+func (notebookGenerator) Sniff(head []byte) bool {
+	s := strings.TrimSpace(string(head))
+	return strings.HasPrefix(s, "{") &&
+		(strings.Contains(s, `"cells"`) || strings.Contains(s, `"nbformat"`))
+}
+
+// notebook is the part of the notebook format we care about
+type notebook struct {
+	Metadata map[string]json.RawMessage `json:"metadata"`
+	Cells    []notebookCell             `json:"cells"`
+}
+
+type notebookCell struct {
+	CellType string           `json:"cell_type"`
+	Source   multiline        `json:"source"`
+	Outputs  []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType string                     `json:"output_type"`
+	Name       string                     `json:"name"` // of the stream
+	Text       multiline                  `json:"text"`
+	Data       map[string]json.RawMessage `json:"data"` // by mime type
+	Ename      string                     `json:"ename"`
+	Evalue     string                     `json:"evalue"`
+}
+
+// multiline is a text given as a string or a list of lines
+type multiline string
+
+func (ml *multiline) UnmarshalJSON(b []byte) error {
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err == nil {
+		*ml = multiline(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*ml = multiline(s)
+	return nil
+}
+
+func (notebookGenerator) Generate(input io.Reader, s Staticer) (Poster, error) {
+	c, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var nb notebook
+	if err := json.Unmarshal(c, &nb); err != nil {
+		line := 1
+		if se, ok := err.(*json.SyntaxError); ok {
+			line += bytes.Count(c[:se.Offset], []byte("\n"))
+		}
+		return nil, &LineError{line, fmt.Errorf("notebook: %s\n", err)}
+	}
+
+	var m meta
+	if err := nb.fillMeta(&m); err != nil {
+		return nil, &LineError{1, err}
+	}
+	m.key = generateKey(m.title, m.slug, s)
+
+	np := &notebookPost{outputs: make(map[string][]byte)}
+	mk := &markup{key: m.key, s: s}
+	renderer := &myRender{
+		key:      m.key,
+		s:        s,
+		Renderer: blackfriday.HtmlRenderer(htmlFlags, "", ""),
+	}
+	lang := nb.language()
+	for i, cell := range nb.Cells {
+		switch cell.CellType {
+		case "markdown":
+			mk.out.Write(blackfriday.Markdown([]byte(cell.Source), renderer, extensions))
+			mk.images = append(mk.images, renderer.images...)
+			renderer.images = nil
+		case "code":
+			if strings.TrimSpace(string(cell.Source)) != "" {
+				mk.code(lang, string(cell.Source))
+			}
+			for j, o := range cell.Outputs {
+				name := fmt.Sprintf("output-%d-%d.png", i+1, j+1)
+				if err := mk.output(o, name, np.outputs); err != nil {
+					return nil, &LineError{1, fmt.Errorf("notebook: cell %d: %s\n", i+1, err)}
+				}
+			}
+		}
+	}
+	mk.toc = renderer.toc
+	mk.links = renderer.links
+	mk.fill(&m)
+	m.warnings = renderer.warnings
+	np.post = newPost(m)
+	return np, nil
+}
+
+// fillMeta fills the meta with the notebook's metadata
+func (nb *notebook) fillMeta(m *meta) error {
+	if v := metaValue(nb.Metadata["title"]); v != "" {
+		m.title = v
+	} else {
+		return errors.New("notebook: can't find the title in the metadata\n")
+	}
+	if v := metaValue(nb.Metadata["date"]); v != "" {
+		d, err := parseDate(v)
+		if err != nil {
+			return err
+		}
+		m.date = d
+	} else {
+		return errors.New("notebook: can't find the date in the metadata\n")
+	}
+	for _, tag := range strings.Split(metaValue(nb.Metadata["tags"]), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			m.tags = append(m.tags, tag)
+		}
+	}
+	for _, name := range []string{attrDraft, attrSlug, attrAliases, attrUpdated} {
+		if raw, ok := nb.Metadata[name]; ok {
+			if err := m.applyAttr(name, metaValue(raw)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// metaValue gives a metadata value as a string, the lists are joined
+// with ',' and the other values are kept as they are, like true
+func metaValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return strings.Join(list, ",")
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// language gives the language of the code cells
+func (nb *notebook) language() string {
+	var info struct {
+		Name     string `json:"name"`
+		Language string `json:"language"`
+	}
+	if json.Unmarshal(nb.Metadata["language_info"], &info) == nil && info.Name != "" {
+		return info.Name
+	}
+	if json.Unmarshal(nb.Metadata["kernelspec"], &info) == nil {
+		return info.Language
+	}
+	return ""
+}
+
+// output writes an output of a code cell, a png image is kept in
+// outputs with the name
+func (mk *markup) output(o notebookOutput, name string, outputs map[string][]byte) error {
+	switch o.OutputType {
+	case "stream":
+		class := "output"
+		if o.Name == "stderr" {
+			class += " stderr"
+		}
+		fmt.Fprintf(&mk.out, "<div class=\"%s\">\n<pre>%s</pre>\n</div>\n", class, html.EscapeString(string(o.Text)))
+	case "execute_result", "display_data":
+		var data multiline
+		if o.data("image/png", &data) {
+			b, err := base64.StdEncoding.DecodeString(strings.Replace(string(data), "\n", "", -1))
+			if err != nil {
+				return fmt.Errorf("invalid png output: %s", err)
+			}
+			outputs[name] = b
+			fmt.Fprintf(&mk.out, "<div class=\"output\">\n%s\n</div>\n", mk.img(name, ""))
+		} else if o.data("text/html", &data) {
+			fmt.Fprintf(&mk.out, "<div class=\"output\">\n%s\n</div>\n", strings.TrimSpace(string(data)))
+		} else if o.data("text/plain", &data) {
+			fmt.Fprintf(&mk.out, "<div class=\"output\">\n<pre>%s</pre>\n</div>\n", html.EscapeString(string(data)))
+		}
+	case "error":
+		fmt.Fprintf(&mk.out, "<div class=\"output error\">\n<pre>%s: %s</pre>\n</div>\n",
+			html.EscapeString(o.Ename), html.EscapeString(o.Evalue))
+	}
+	return nil
+}
+
+// data gets the textual data of the output in the mime type
+func (o *notebookOutput) data(mime string, data *multiline) bool {
+	raw, ok := o.Data[mime]
+	return ok && json.Unmarshal(raw, data) == nil
+}
+
+// notebookPost is a post with the images of the outputs embedded
+type notebookPost struct {
+	*post
+	outputs map[string][]byte
+}
+
+func (np *notebookPost) embedded(p string) ([]byte, bool) {
+	b, ok := np.outputs[path.Clean(p)]
+	return b, ok
+}
+
+func (np *notebookPost) Static(p string) io.ReadCloser {
+	if rc, ok := openEmbedded(np, p); ok {
+		return rc
+	}
+	return np.post.Static(p)
+}
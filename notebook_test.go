@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNotebookMatch(t *testing.T) {
+	for name, c := range map[string]struct {
+		path   string
+		expect bool
+	}{
+		"match": {
+			path:   "a/b/c.ipynb",
+			expect: true,
+		},
+		"unmatch": {
+			path:   "a/b/c.ipynb.json",
+			expect: false,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := (notebookGenerator{}).Match(c.path); got != c.expect {
+				t.Errorf("got %v, but want %v\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestNotebookGenerate(t *testing.T) {
+	const head = `{"metadata": {"title": "hello world", "date": "2012-12-01", "language_info": {"name": "go"}}, "cells": `
+	for name, c := range map[string]struct {
+		input        string
+		expectErr    error
+		expectResult Poster
+	}{
+		"normal": {
+			input: `{"metadata": {"title": "hello world", "date": "2012-12-01", "tags": ["tag1", "tag2"]},
+				"cells": [{"cell_type": "markdown", "source": ["# Title *hello*\n", "\n", "![a](1.png)"]}]}`,
+			expectResult: newPost(meta{
+				key:        "hello_world",
+				title:      "hello world",
+				date:       parseTime("2012-12-01"),
+				tags:       []string{"tag1", "tag2"},
+				content:    "<h1 id=\"title-hello\">Title <em>hello</em></h1>\n\n<p><img src=\"/images/hello_world/1.png\" alt=\"a\" /></p>\n",
+				staticList: []string{"/images/hello_world/1.png"},
+				toc: []*Heading{
+					{Level: 1, Title: "Title hello", Anchor: "title-hello"},
+				},
+			}),
+		},
+		"attributes": {
+			input: `{"metadata": {"title": "hello world", "date": "2012-12-01", "tags": "a, b",
+				"draft": true, "slug": "Hello Go", "aliases": ["x", "y"], "updated": "2013-01-02"}, "cells": []}`,
+			expectResult: newPost(meta{
+				key:     "Hello_Go",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				updated: parseTime("2013-01-02"),
+				tags:    []string{"a", "b"},
+				draft:   true,
+				aliases: []string{"x", "y"},
+			}),
+		},
+		"code": {
+			input: head + `[{"cell_type": "code", "source": ["x := 1"], "outputs": [
+				{"output_type": "stream", "name": "stderr", "text": "a<b\n"},
+				{"output_type": "execute_result", "data": {"text/plain": ["1"], "application/json": {"a": 1}}},
+				{"output_type": "display_data", "data": {"text/html": "<b>2</b>\n", "text/plain": "2"}},
+				{"output_type": "error", "ename": "panic", "evalue": "oops", "traceback": []}]},
+				{"cell_type": "raw", "source": "ignored"}]}`,
+			expectResult: newPost(meta{
+				key:   "hello_world",
+				title: "hello world",
+				date:  parseTime("2012-12-01"),
+				content: "<div class=\"code\">\n<pre class=\"numbers\"><code class=\"language-go\"><span num=\"1\">x := <span class=\"num\">1</span></span>\n</code></pre>\n</div>\n" +
+					"<div class=\"output stderr\">\n<pre>a&lt;b\n</pre>\n</div>\n" +
+					"<div class=\"output\">\n<pre>1</pre>\n</div>\n" +
+					"<div class=\"output\">\n<b>2</b>\n</div>\n" +
+					"<div class=\"output error\">\n<pre>panic: oops</pre>\n</div>\n",
+			}),
+		},
+		"png": {
+			input: head + `[{"cell_type": "code", "source": "", "outputs": [
+				{"output_type": "display_data", "data": {"image/png": "iVBORw0K\n", "text/plain": "<Figure>"}}]}]}`,
+			expectResult: newPost(meta{
+				key:        "hello_world",
+				title:      "hello world",
+				date:       parseTime("2012-12-01"),
+				content:    "<div class=\"output\">\n<img src=\"/images/hello_world/output-1-1.png\" alt=\"\" />\n</div>\n",
+				staticList: []string{"/images/hello_world/output-1-1.png"},
+			}),
+		},
+		"invalidPNG": {
+			input: head + `[{"cell_type": "markdown", "source": ""}, {"cell_type": "code", "source": "", "outputs": [
+				{"output_type": "display_data", "data": {"image/png": "!!"}}]}]}`,
+			expectErr: errors.New("line 1: notebook: cell 2: invalid png output"),
+		},
+		"invalidJSON": {
+			input:     "{\n\"metadata\": {\n,\n}}",
+			expectErr: errors.New("line 3: notebook: invalid character ','"),
+		},
+		"noTitle": {
+			input:     `{"metadata": {"date": "2012-12-01"}, "cells": []}`,
+			expectErr: errors.New("line 1: notebook: can't find the title in the metadata"),
+		},
+		"noDate": {
+			input:     `{"metadata": {"title": "t"}, "cells": []}`,
+			expectErr: errors.New("line 1: notebook: can't find the date in the metadata"),
+		},
+		"invalidDate": {
+			input:     `{"metadata": {"title": "t", "date": "someday"}, "cells": []}`,
+			expectErr: errors.New("line 1: invalid date \"someday\""),
+		},
+		"invalidDraft": {
+			input:     `{"metadata": {"title": "t", "date": "2012-12-01", "draft": "maybe"}, "cells": []}`,
+			expectErr: errors.New("line 1: invalid draft attribute"),
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, err := notebookGenerator{}.Generate(strings.NewReader(c.input), nil)
+			if err = matchError(c.expectErr, err); err != nil {
+				t.Error(err)
+			}
+			if c.expectResult != nil && !isPosterEqual(got, c.expectResult) {
+				t.Errorf("\n\tgot result: %#v,\n\tbut want %#v\n", got, c.expectResult)
+			}
+		})
+	}
+}
+
+func TestNotebookStatic(t *testing.T) {
+	input := `{"metadata": {"title": "t", "date": "2012-12-01"}, "cells": [{"cell_type": "code", "source": "", "outputs": [
+		{"output_type": "display_data", "data": {"image/png": ["iVBO", "Rw0K"]}}]}]}`
+	p, err := notebookGenerator{}.Generate(strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the embedded images are served by the wrapping posts as well
+	for name, s := range map[string]Staticer{
+		"post":  p,
+		"local": &localPost{Poster: p, path: "testdata/localRepo/t.ipynb"},
+	} {
+		for path, expect := range map[string]string{
+			"output-1-1.png":   "\x89PNG\r\n",
+			"./output-1-1.png": "\x89PNG\r\n",
+		} {
+			rc := s.Static(path)
+			got, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Errorf("%s: %s: %s\n", name, path, err)
+			}
+			if string(got) != expect {
+				t.Errorf("%s: %s: got %q, but want %q\n", name, path, got, expect)
+			}
+		}
+	}
+}
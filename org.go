@@ -0,0 +1,440 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterNamedGenerator("org", 0, orgGenerator{})
+}
+
+// orgGenerator generates the posts written in Emacs org-mode. The title
+// and date are given by "#+TITLE:" and "#+DATE:", the tags by
+// "#+FILETAGS:", and the optional attributes are keywords as well, like
+// "#+DRAFT: true".
+type orgGenerator struct{}
+
+func (orgGenerator) Match(filename string) bool {
+	return strings.HasSuffix(filename, ".org")
+}
+
+var (
+	orgKeyword  = regexp.MustCompile(`^\s*#\+(\w+):\s*(.*?)\s*$`)
+	orgBegin    = regexp.MustCompile(`(?i)^\s*#\+begin_(\w+)\s*(.*?)\s*$`)
+	orgHeading  = regexp.MustCompile(`^(\*+)\s+(.*?)(\s+:[\w@#%:]+:)?\s*$`)
+	orgBullet   = regexp.MustCompile(`^(\s*)([-+*]|\d+[.)])\s+(.*)$`)
+	orgTableSep = regexp.MustCompile(`^\s*\|[-+:| ]*-[-+:| ]*$`)
+	orgRule     = regexp.MustCompile(`^\s*-{5,}\s*$`)
+)
+
+// Sniff recognizes a #+TITLE keyword
+func (orgGenerator) Sniff(head []byte) bool {
+	for _, line := range strings.Split(string(head), "\n") {
+		if sm := orgKeyword.FindStringSubmatch(line); sm != nil && strings.ToLower(sm[1]) == "title" {
+			return true
+		}
+	}
+	return false
+}
+
+func (orgGenerator) Generate(input io.Reader, s Staticer) (Poster, error) {
+	c, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.Replace(string(c), "\r\n", "\n", -1), "\n")
+
+	// the keywords may be anywhere
+	var m meta
+	hasDate := false
+	for i, line := range lines {
+		sm := orgKeyword.FindStringSubmatch(line)
+		if sm == nil {
+			continue
+		}
+		name, value := strings.ToLower(sm[1]), sm[2]
+		switch {
+		case name == "title":
+			m.title = value
+		case name == "date":
+			if m.date, err = parseDate(value); err != nil {
+				return nil, &LineError{i + 1, err}
+			}
+			hasDate = true
+		case name == "filetags":
+			m.tags = strings.FieldsFunc(value, func(r rune) bool {
+				return r == ':' || r == ',' || r == ' ' || r == '\t'
+			})
+		case knownAttrs[name]:
+			if err = m.applyAttr(name, value); err != nil {
+				return nil, &LineError{i + 1, err}
+			}
+		}
+	}
+	if m.title == "" {
+		return nil, &LineError{1, errors.New("org: can't find #+TITLE\n")}
+	}
+	if !hasDate {
+		return nil, &LineError{1, errors.New("org: can't find #+DATE\n")}
+	}
+	m.key = generateKey(m.title, m.slug, s)
+
+	o := &orgParser{lines: lines}
+	o.key, o.s = m.key, s
+	if err = o.parse(); err != nil {
+		return nil, err
+	}
+	o.fill(&m)
+	return newPost(m), nil
+}
+
+// orgParser parses the body of an org document line by line
+type orgParser struct {
+	markup
+	lines []string
+	i     int // the current line
+}
+
+func (o *orgParser) parse() error {
+	for o.i < len(o.lines) {
+		line := o.lines[o.i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			o.i++
+		case orgBegin.MatchString(line):
+			if err := o.block(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(trimmed, "#+"), trimmed == "#", strings.HasPrefix(trimmed, "# "):
+			// keywords and comments
+			o.i++
+		case orgHeading.MatchString(line):
+			sm := orgHeading.FindStringSubmatch(line)
+			o.heading(len(sm[1]), o.inline(sm[2]))
+			o.i++
+		case orgRule.MatchString(line):
+			o.out.WriteString("<hr />\n")
+			o.i++
+		case strings.HasPrefix(trimmed, "|"):
+			o.table()
+		case o.isBullet(line):
+			o.list()
+		default:
+			o.paragraph()
+		}
+	}
+	return nil
+}
+
+// block writes a "#+BEGIN_xxx" block
+func (o *orgParser) block() error {
+	sm := orgBegin.FindStringSubmatch(o.lines[o.i])
+	kind, params := strings.ToLower(sm[1]), sm[2]
+	end := "#+end_" + kind
+	begin := o.i
+	var body []string
+	for o.i++; o.i < len(o.lines); o.i++ {
+		if strings.ToLower(strings.TrimSpace(o.lines[o.i])) == end {
+			break
+		}
+		body = append(body, o.lines[o.i])
+	}
+	if o.i == len(o.lines) {
+		return &LineError{begin + 1, fmt.Errorf("org: unterminated #+BEGIN_%s\n", sm[1])}
+	}
+	o.i++
+
+	switch kind {
+	case "src":
+		var lang string
+		if fields := strings.Fields(params); len(fields) != 0 {
+			lang = fields[0]
+		}
+		o.code(lang, strings.Join(unindent(body), "\n"))
+	case "example":
+		o.code("", strings.Join(unindent(body), "\n"))
+	case "quote":
+		o.out.WriteString("<blockquote>\n")
+		o.nested(body)
+		o.out.WriteString("</blockquote>\n")
+	case "center":
+		o.out.WriteString("<div class=\"center\">\n")
+		o.nested(body)
+		o.out.WriteString("</div>\n")
+	case "export":
+		if strings.ToLower(strings.TrimSpace(params)) == "html" {
+			o.out.WriteString(strings.Join(body, "\n") + "\n")
+		}
+	default:
+		o.nested(body)
+	}
+	return nil
+}
+
+// nested parses the lines in a block
+func (o *orgParser) nested(lines []string) {
+	saved, i := o.lines, o.i
+	o.lines, o.i = lines, 0
+	// the blocks are closed, so no error
+	o.parse()
+	o.lines, o.i = saved, i
+}
+
+// unindent removes the common indent of the lines
+func unindent(lines []string) []string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if n := len(l) - len(strings.TrimLeft(l, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			l = l[indent:]
+		}
+		out[i] = strings.TrimRight(l, " \t")
+	}
+	return out
+}
+
+// table writes the consecutive table lines, the rows above the first
+// separator are the header
+func (o *orgParser) table() {
+	var rows [][]string
+	header := 0
+	for ; o.i < len(o.lines); o.i++ {
+		line := strings.TrimSpace(o.lines[o.i])
+		if !strings.HasPrefix(line, "|") {
+			break
+		}
+		if orgTableSep.MatchString(line) {
+			if header == 0 {
+				header = len(rows)
+			}
+			continue
+		}
+		line = strings.TrimSuffix(line[1:], "|")
+		cells := strings.Split(line, "|")
+		for i := range cells {
+			cells[i] = o.inline(strings.TrimSpace(cells[i]))
+		}
+		rows = append(rows, cells)
+	}
+	if header == len(rows) {
+		header = 0
+	}
+
+	o.out.WriteString("<table>\n")
+	if header > 0 {
+		o.out.WriteString("<thead>\n")
+		writeRows(&o.out, rows[:header], "th")
+		o.out.WriteString("</thead>\n")
+	}
+	o.out.WriteString("<tbody>\n")
+	writeRows(&o.out, rows[header:], "td")
+	o.out.WriteString("</tbody>\n</table>\n")
+}
+
+func writeRows(b *strings.Builder, rows [][]string, tag string) {
+	for _, row := range rows {
+		b.WriteString("<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(b, "<%s>%s</%s>", tag, cell, tag)
+		}
+		b.WriteString("</tr>\n")
+	}
+}
+
+// isBullet reports whether the line is a list item, the ones with '*'
+// must be indented not to be a heading
+func (o *orgParser) isBullet(line string) bool {
+	sm := orgBullet.FindStringSubmatch(line)
+	return sm != nil && !(sm[2] == "*" && sm[1] == "")
+}
+
+// list writes the items at the indent of the current line, and the
+// nested lists in them
+func (o *orgParser) list() {
+	first := orgBullet.FindStringSubmatch(o.lines[o.i])
+	indent := len(first[1])
+	tag := "ul"
+	if first[2] != "-" && first[2] != "+" && first[2] != "*" {
+		tag = "ol"
+	}
+	fmt.Fprintf(&o.out, "<%s>\n", tag)
+	for o.i < len(o.lines) {
+		sm := orgBullet.FindStringSubmatch(o.lines[o.i])
+		if sm == nil || !o.isBullet(o.lines[o.i]) || len(sm[1]) != indent {
+			break
+		}
+		o.i++
+		text := []string{sm[3]}
+		open := false // whether the text is written
+		writeText := func() {
+			if !open {
+				fmt.Fprintf(&o.out, "<li>%s", o.inline(strings.Join(text, "\n")))
+				open = true
+			}
+		}
+		for o.i < len(o.lines) {
+			line := o.lines[o.i]
+			if strings.TrimSpace(line) == "" {
+				// a blank line ends the list unless an item follows
+				next := o.i + 1
+				for next < len(o.lines) && strings.TrimSpace(o.lines[next]) == "" {
+					next++
+				}
+				if next == len(o.lines) || !o.isBullet(o.lines[next]) || o.indent(o.lines[next]) < indent {
+					break
+				}
+				o.i = next
+				continue
+			}
+			if o.isBullet(line) {
+				if o.indent(line) <= indent {
+					break
+				}
+				writeText()
+				o.out.WriteByte('\n')
+				o.list()
+				continue
+			}
+			if o.indent(line) <= indent {
+				break
+			}
+			if open {
+				o.out.WriteString(o.inline(strings.TrimSpace(line)) + "\n")
+			} else {
+				text = append(text, strings.TrimSpace(line))
+			}
+			o.i++
+		}
+		writeText()
+		o.out.WriteString("</li>\n")
+		if o.i < len(o.lines) && strings.TrimSpace(o.lines[o.i]) == "" {
+			break
+		}
+	}
+	fmt.Fprintf(&o.out, "</%s>\n", tag)
+}
+
+// indent gives the width of the leading spaces of the line
+func (o *orgParser) indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// paragraph writes the lines until a blank line or another element
+func (o *orgParser) paragraph() {
+	var text []string
+	for ; o.i < len(o.lines); o.i++ {
+		line := o.lines[o.i]
+		trimmed := strings.TrimSpace(line)
+		if len(text) != 0 && (trimmed == "" || orgHeading.MatchString(line) ||
+			strings.HasPrefix(trimmed, "#+") ||
+			strings.HasPrefix(trimmed, "|") || o.isBullet(line)) {
+			break
+		}
+		text = append(text, trimmed)
+	}
+	fmt.Fprintf(&o.out, "<p>%s</p>\n", o.inline(strings.Join(text, "\n")))
+}
+
+// the inline markers and their tags
+var orgMarkers = map[byte]string{
+	'*': "strong",
+	'/': "em",
+	'_': "u",
+	'+': "del",
+	'=': "code",
+	'~': "code",
+}
+
+const (
+	orgPre  = " \t\n-({'\""
+	orgPost = " \t\n-.,:!?;'\")}["
+)
+
+// inline gives the html of the text with the inline markup and links
+func (o *orgParser) inline(s string) string {
+	var b strings.Builder
+	plain := 0 // the start of the plain text not written yet
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "[[") {
+			if end := strings.Index(s[i:], "]]"); end > 0 {
+				b.WriteString(html.EscapeString(s[plain:i]))
+				b.WriteString(o.link(s[i+2 : i+end]))
+				i += end + 2
+				plain = i
+				continue
+			}
+		}
+		if tag, ok := orgMarkers[s[i]]; ok && (i == 0 || strings.IndexByte(orgPre, s[i-1]) >= 0) {
+			if j := closeMarker(s, i); j > 0 {
+				b.WriteString(html.EscapeString(s[plain:i]))
+				inner := s[i+1 : j]
+				if tag == "code" {
+					inner = html.EscapeString(inner)
+				} else {
+					inner = o.inline(inner)
+				}
+				fmt.Fprintf(&b, "<%s>%s</%s>", tag, inner, tag)
+				i = j + 1
+				plain = i
+				continue
+			}
+		}
+		i++
+	}
+	b.WriteString(html.EscapeString(s[plain:]))
+	return b.String()
+}
+
+// closeMarker gives the index of the marker closing the one at i, or -1
+func closeMarker(s string, i int) int {
+	m := s[i]
+	if i+1 >= len(s) || isSpace(s[i+1]) {
+		return -1
+	}
+	for j := i + 2; j < len(s); j++ {
+		if s[j] == m && !isSpace(s[j-1]) && (j+1 == len(s) || strings.IndexByte(orgPost, s[j+1]) >= 0) {
+			return j
+		}
+	}
+	return -1
+}
+
+// link gives the html of a link like "[[target][description]]", the
+// images without a description are shown
+func (o *orgParser) link(s string) string {
+	target, desc := s, ""
+	if i := strings.Index(s, "]["); i >= 0 {
+		target, desc = s[:i], s[i+2:]
+	}
+	target = strings.TrimPrefix(target, "file:")
+	if desc == "" {
+		if isImage(target) {
+			return o.img(target, "")
+		}
+		desc = html.EscapeString(target)
+	} else if d := strings.TrimPrefix(desc, "file:"); isImage(d) && !strings.Contains(d, " ") {
+		desc = o.img(d, "")
+	} else {
+		desc = o.inline(desc)
+	}
+	// the links to the headings
+	if strings.HasPrefix(target, "*") {
+		target = "#" + slugify(target[1:])
+	}
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(o.href(target)), desc)
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOrgMatch(t *testing.T) {
+	for name, c := range map[string]struct {
+		path   string
+		expect bool
+	}{
+		"match": {
+			path:   "a/b/c.org",
+			expect: true,
+		},
+		"unmatch": {
+			path:   "a/b/c.organ",
+			expect: false,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := (orgGenerator{}).Match(c.path); got != c.expect {
+				t.Errorf("got %v, but want %v\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestOrgGenerate(t *testing.T) {
+	for name, c := range map[string]struct {
+		input        string
+		expectErr    error
+		expectResult Poster
+	}{
+		"normal": {
+			input: "#+TITLE: hello world\n#+DATE: <2012-12-01 Sat>\n#+FILETAGS: :tag1:tag2:\n\n* Title *hello* :noexport:\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				tags:    []string{"tag1", "tag2"},
+				content: "<h1 id=\"title-hello\">Title <strong>hello</strong></h1>\n",
+				toc: []*Heading{
+					{Level: 1, Title: "Title hello", Anchor: "title-hello"},
+				},
+			}),
+		},
+		"attributes": {
+			input: "#+title: hello world\n#+date: 2012-12-01\n#+draft: true\n#+slug: Hello Go\n#+updated: 2013-01-02\n",
+			expectResult: newPost(meta{
+				key:     "Hello_Go",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				updated: parseTime("2013-01-02"),
+				draft:   true,
+			}),
+		},
+		"inline": {
+			input: "#+TITLE: t\n#+DATE: 2012-12-01\n# a comment\nSome *bold*, /em/, _u_, +del+, =a<b= and ~c~,\nnot 2*3*4 or a/b/c.\n",
+			expectResult: newPost(meta{
+				key:     "t",
+				title:   "t",
+				date:    parseTime("2012-12-01"),
+				content: "<p>Some <strong>bold</strong>, <em>em</em>, <u>u</u>, <del>del</del>, <code>a&lt;b</code> and <code>c</code>,\nnot 2*3*4 or a/b/c.</p>\n",
+			}),
+		},
+		"links": {
+			input: "#+TITLE: t\n#+DATE: 2012-12-01\n[[https://orgmode.org][the *site*]] [[*Intro][intro]] [[file:1.png]] [[http://2/2.png]] [[/a][file:3.jpg]]\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<p><a href=\"https://orgmode.org\">the <strong>site</strong></a> <a href=\"#intro\">intro</a> " +
+					"<img src=\"/images/t/1.png\" alt=\"\" /> <img src=\"http://2/2.png\" alt=\"\" /> " +
+					"<a href=\"/a\"><img src=\"/images/t/3.jpg\" alt=\"\" /></a></p>\n",
+				staticList: []string{"/images/t/1.png", "/images/t/3.jpg"},
+			}),
+		},
+		"lists": {
+			input: "#+TITLE: t\n#+DATE: 2012-12-01\n- one\n- two\n  1. a\n  2) b\n- three\n  more\n\n- four\n\nafter\n",
+			expectResult: newPost(meta{
+				key:     "t",
+				title:   "t",
+				date:    parseTime("2012-12-01"),
+				content: "<ul>\n<li>one</li>\n<li>two\n<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n</li>\n<li>three\nmore</li>\n<li>four</li>\n</ul>\n<p>after</p>\n",
+			}),
+		},
+		"table": {
+			input: "#+TITLE: t\n#+DATE: 2012-12-01\n| a | *b* |\n|---+-----|\n| 1 | 2   |\n",
+			expectResult: newPost(meta{
+				key:     "t",
+				title:   "t",
+				date:    parseTime("2012-12-01"),
+				content: "<table>\n<thead>\n<tr><th>a</th><th><strong>b</strong></th></tr>\n</thead>\n<tbody>\n<tr><td>1</td><td>2</td></tr>\n</tbody>\n</table>\n",
+			}),
+		},
+		"blocks": {
+			input: "#+TITLE: t\n#+DATE: 2012-12-01\n#+BEGIN_SRC go :exports code\n  x := 1\n#+END_SRC\n#+begin_example\n<a>\n#+end_example\n#+BEGIN_QUOTE\n/q/\n#+END_QUOTE\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<div class=\"code\">\n<pre class=\"numbers\"><code class=\"language-go\"><span num=\"1\">x := <span class=\"num\">1</span></span>\n</code></pre>\n</div>\n" +
+					"<div class=\"code\">\n<pre><code>&lt;a&gt;\n</code></pre>\n</div>\n" +
+					"<blockquote>\n<p><em>q</em></p>\n</blockquote>\n",
+			}),
+		},
+		"noTitle": {
+			input:     "#+DATE: 2012-12-01\n",
+			expectErr: errors.New("line 1: org: can't find #+TITLE"),
+		},
+		"noDate": {
+			input:     "#+TITLE: t\n",
+			expectErr: errors.New("line 1: org: can't find #+DATE"),
+		},
+		"invalidDate": {
+			input:     "#+TITLE: t\n#+DATE: someday\n",
+			expectErr: errors.New("line 2: invalid date \"someday\""),
+		},
+		"invalidDraft": {
+			input:     "#+TITLE: t\n#+DATE: 2012-12-01\n#+DRAFT: maybe\n",
+			expectErr: errors.New("line 3: invalid draft attribute"),
+		},
+		"unterminated": {
+			input:     "#+TITLE: t\n#+DATE: 2012-12-01\n\n#+BEGIN_SRC go\nx\n",
+			expectErr: errors.New("line 4: org: unterminated #+BEGIN_SRC"),
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, err := orgGenerator{}.Generate(strings.NewReader(c.input), nil)
+			if err = matchError(c.expectErr, err); err != nil {
+				t.Error(err)
+			}
+			if c.expectResult != nil && !isPosterEqual(got, c.expectResult) {
+				t.Errorf("\n\tgot result: %#v,\n\tbut want %#v\n", got, c.expectResult)
+			}
+		})
+	}
+}
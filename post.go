@@ -1,11 +1,15 @@
 package storage
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 )
 
 // meta contain the necessary infomations of a post
@@ -13,10 +17,19 @@ type meta struct {
 	key        string
 	title      string
 	date       time.Time
+	updated    time.Time
 	content    string
 	tags       []string
 	isSlide    bool
 	staticList []string
+	draft      bool
+	slug       string
+	aliases    []string
+	summary    string
+	words      int
+	toc        []*Heading
+	links      []string // the keys of the linked posts
+	warnings   []string // the problems found when generating the post
 }
 
 // post represent a basic Poster instance
@@ -25,9 +38,18 @@ type post struct {
 	meta
 }
 
-var _ Poster = &post{}
+var (
+	_ Poster     = &post{}
+	_ Summarizer = &post{}
+	_ Outliner   = &post{}
+	_ Aliaser    = &post{}
+	_ Updater    = &post{}
+	_ Drafter    = &post{}
+	_ Warner     = &post{}
+)
 
 func newPost(m meta) *post {
+	m.summary, m.words = summarize(m.content)
 	return &post{
 		meta: m,
 	}
@@ -40,6 +62,15 @@ func (p *post) Date() time.Time {
 	return p.date
 }
 
+func (p *post) Updated() time.Time {
+	p.RLock()
+	defer p.RUnlock()
+	if p.updated.Before(p.date) {
+		return p.date
+	}
+	return p.updated
+}
+
 func (p *post) Content() string {
 	p.RLock()
 	defer p.RUnlock()
@@ -70,6 +101,56 @@ func (p *post) IsSlide() bool {
 	return p.isSlide
 }
 
+func (p *post) IsDraft() bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.draft
+}
+
+func (p *post) Summary() string {
+	p.RLock()
+	defer p.RUnlock()
+	return p.summary
+}
+
+func (p *post) WordCount() int {
+	p.RLock()
+	defer p.RUnlock()
+	return p.words
+}
+
+func (p *post) ReadingTime() time.Duration {
+	p.RLock()
+	defer p.RUnlock()
+	return readingTime(p.words)
+}
+
+func (p *post) TOC() []*Heading {
+	p.RLock()
+	defer p.RUnlock()
+	return p.toc
+}
+
+func (p *post) Aliases() []string {
+	p.RLock()
+	defer p.RUnlock()
+	return p.aliases
+}
+
+// Warnings gives the problems found when generating the post
+func (p *post) Warnings() []string {
+	p.RLock()
+	defer p.RUnlock()
+	return p.warnings
+}
+
+// Links gives the keys of the posts linked by the post
+func (p *post) Links() []string {
+	p.RLock()
+	defer p.RUnlock()
+	return p.links
+}
+
 func (p *post) StaticList() []string {
 	p.RLock()
 	defer p.RUnlock()
@@ -80,13 +161,164 @@ func (p *post) Static(string) io.ReadCloser {
 	return ioutil.NopCloser(strings.NewReader("nop"))
 }
 
+// movedKeys records the previous key of a post whose key changes from
+// old to current
+func movedKeys(keys []string, old, current string) []string {
+	moved := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		// moved back
+		if k != current && k != old {
+			moved = append(moved, k)
+		}
+	}
+	if old != current {
+		moved = append(moved, old)
+	}
+	return moved
+}
+
+// mergeAliases gives the aliases from the metadata and the moved keys
+func mergeAliases(aliases, moved []string) []string {
+	if len(moved) == 0 {
+		return aliases
+	}
+	return append(append([]string(nil), aliases...), moved...)
+}
+
+// Besides title, date and tags, a post's header may carry some
+// optional attributes, one "name: value" per line.
+const (
+	attrDraft   = "draft"
+	attrSlug    = "slug"
+	attrAliases = "aliases"
+	attrUpdated = "updated"
+)
+
+var knownAttrs = map[string]bool{
+	attrDraft:   true,
+	attrSlug:    true,
+	attrAliases: true,
+	attrUpdated: true,
+}
+
+// parseAttr checks whether the line is an optional header attribute
+func parseAttr(line string) (name, value string, ok bool) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	name = strings.ToLower(strings.TrimSpace(line[:i]))
+	if !knownAttrs[name] {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(line[i+1:]), true
+}
+
+// applyAttr fills the meta with an attribute got from parseAttr
+func (m *meta) applyAttr(name, value string) error {
+	switch name {
+	case attrDraft:
+		if value == "" {
+			m.draft = true
+			return nil
+		}
+		draft, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid draft attribute %q: %s", value, err)
+		}
+		m.draft = draft
+	case attrSlug:
+		m.slug = value
+	case attrAliases:
+		for _, alias := range strings.Split(value, ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				m.aliases = append(m.aliases, alias)
+			}
+		}
+	case attrUpdated:
+		updated, err := time.Parse(timePattern, value)
+		if err != nil {
+			return fmt.Errorf("invalid updated attribute %q: %s", value, err)
+		}
+		m.updated = updated
+	}
+	return nil
+}
+
+// title2Key turns a title into an url friendly key, the letters and
+// digits of any language are kept, the others become '_'
 func title2Key(title string) string {
-	return strings.Replace(title, " ", "_", -1)
+	return joinWords(title, '_')
+}
+
+// joinWords joins the words, which are made of letters and digits, in s
+// with sep
+func joinWords(s string, sep byte) string {
+	var b strings.Builder
+	split := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			if split && b.Len() != 0 {
+				b.WriteByte(sep)
+			}
+			split = false
+			b.WriteRune(r)
+		} else {
+			split = true
+		}
+	}
+	return b.String()
+}
+
+// generateKey gives the key of a post, from the slug if any, otherwise
+// from the title. It's prefixed with the namespace of s if any.
+func generateKey(title, slug string, s Staticer) string {
+	key := title2Key(title)
+	if slug != "" {
+		key = title2Key(slug)
+	}
+	if key == "" {
+		key = "untitled"
+	}
+	if ns, ok := s.(Namespacer); ok && ns.Namespace() != "" {
+		key = title2Key(ns.Namespace()) + "/" + key
+	}
+	return key
+}
+
+// PostLink gives the link of the post with the key, which is used for
+// the links between the posts, like handler.PostURL
+var PostLink = func(key string) string {
+	return (&url.URL{Path: "/posts/" + key}).EscapedPath()
+}
+
+// PostFinder is optionally implemented by the Staticer passed to
+// Generator.Generate, it finds the other posts linked by the post
+type PostFinder interface {
+	// PostKey gives the key of the post generated from the source at
+	// path, which is relative to the post like a static resource
+	PostKey(path string) (string, bool)
+	// TitleKey gives the key of the post with the title
+	TitleKey(title string) (string, bool)
 }
 
-const imagePrefix = "/images/" //add this prefix to the origin image link
+// ImagePrefix is added to the origin image link, the link becomes
+// ImagePrefix + key + "/" + link
+const ImagePrefix = "/images/"
+
 func generateImageLink(key, link string) string {
-	return imagePrefix + key + "/" + link
+	return prefixImageLink(ImagePrefix, key, link)
+}
+
+// prefixImageLink is generateImageLink with another prefix, ImagePrefix
+// is used if it's empty
+func prefixImageLink(prefix, key, link string) string {
+	if prefix == "" {
+		prefix = ImagePrefix
+	} else if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix + key + "/" + link
 }
 
 // wantChange check whether the image's link need to add prefix
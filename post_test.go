@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateKey(t *testing.T) {
+	for name, c := range map[string]struct {
+		title     string
+		slug      string
+		namespace string
+		expect    string
+	}{
+		"normal": {
+			title:  "hello world",
+			expect: "hello_world",
+		},
+		"punctuation": {
+			title:  " What's new in a/b? (part 1) ",
+			expect: "What_s_new_in_a_b_part_1",
+		},
+		"unicode": {
+			title:  "你好, 世界! Café",
+			expect: "你好_世界_Café",
+		},
+		"empty": {
+			title:  "???",
+			expect: "untitled",
+		},
+		"slug": {
+			title:  "hello world",
+			slug:   "my/first post",
+			expect: "my_first_post",
+		},
+		"namespace": {
+			title:     "hello world",
+			namespace: "blog",
+			expect:    "blog/hello_world",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			var s Staticer
+			if c.namespace != "" {
+				s = repoStaticer{namespace: c.namespace}
+			}
+			if got := generateKey(c.title, c.slug, s); got != c.expect {
+				t.Errorf("got %q, but want %q\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestGenerateLineError(t *testing.T) {
+	for name, c := range map[string]struct {
+		gen    Generator
+		input  string
+		expect int
+	}{
+		"markdownHeader": {
+			gen:    markdownGenerator{},
+			input:  "title | someday | \n",
+			expect: 1,
+		},
+		"markdownAttr": {
+			gen:    markdownGenerator{},
+			input:  "title | 2012-12-01 | \nslug: s\ndraft: maybe\n",
+			expect: 3,
+		},
+		"presentAttr": {
+			gen:    articleGenerator,
+			input:  "Title\ndraft: maybe\n",
+			expect: 2,
+		},
+		"presentCommand": {
+			gen:    articleGenerator,
+			input:  "Title\nslug: s\n\n* Section\n\n.unknown x\n",
+			expect: 6,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			_, err := c.gen.Generate(strings.NewReader(c.input), ts)
+			var le *LineError
+			if !errors.As(err, &le) {
+				t.Fatalf("expect a LineError, but got %v\n", err)
+			}
+			if le.Line != c.expect {
+				t.Errorf("got line %d, but want %d\n", le.Line, c.expect)
+			}
+		})
+	}
+}
+
+func TestUpdatedFallback(t *testing.T) {
+	p := plainPost{newPost(meta{date: parseTime("2012-12-01"), updated: parseTime("2012-12-02")})}
+	if got := Updated(p); !got.Equal(p.Date()) {
+		t.Errorf("got %v, but want %v\n", got, p.Date())
+	}
+}
+
+func TestIsDraftFallback(t *testing.T) {
+	p := plainPost{newPost(meta{draft: true})}
+	if IsDraft(p) {
+		t.Error("a post without IsDraft isn't a draft\n")
+	}
+	if !IsDraft(newPost(meta{draft: true})) {
+		t.Error("expect a draft\n")
+	}
+}
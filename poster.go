@@ -30,3 +30,110 @@ type Poster interface {
 	// StaticList gives a list of all static resources
 	StaticList() []string
 }
+
+// Summarizer is optionally implemented by a Poster to give a teaser and
+// the length of its content, which are computed from the content
+// otherwise, see Summary, WordCount and ReadingTime.
+type Summarizer interface {
+	// Summary returns the leading part of the content as a teaser.
+	Summary() string
+	// WordCount returns the number of words in the content.
+	WordCount() int
+	// ReadingTime returns the estimated time to read the post.
+	ReadingTime() time.Duration
+}
+
+// Summary gives the leading part of the post's content as a teaser
+func Summary(p Poster) string {
+	if s, ok := p.(Summarizer); ok {
+		return s.Summary()
+	}
+	summary, _ := summarize(p.Content())
+	return summary
+}
+
+// WordCount gives the number of words in the post's content
+func WordCount(p Poster) int {
+	if s, ok := p.(Summarizer); ok {
+		return s.WordCount()
+	}
+	_, words := summarize(p.Content())
+	return words
+}
+
+// ReadingTime gives the estimated time to read the post
+func ReadingTime(p Poster) time.Duration {
+	if s, ok := p.(Summarizer); ok {
+		return s.ReadingTime()
+	}
+	return readingTime(WordCount(p))
+}
+
+// Outliner is optionally implemented by a Poster to give its table of
+// contents
+type Outliner interface {
+	// TOC returns the table of contents.
+	TOC() []*Heading
+}
+
+// TOC gives the table of contents of the post, nil if it doesn't have
+// one
+func TOC(p Poster) []*Heading {
+	if o, ok := p.(Outliner); ok {
+		return o.TOC()
+	}
+	return nil
+}
+
+// Aliaser is optionally implemented by a Poster whose key has changed,
+// so that it's still found by the previous keys
+type Aliaser interface {
+	// Aliases returns the previous keys of the post.
+	Aliases() []string
+}
+
+// Aliases gives the previous keys of the post
+func Aliases(p Poster) []string {
+	if a, ok := p.(Aliaser); ok {
+		return a.Aliases()
+	}
+	return nil
+}
+
+// Updater is optionally implemented by a Poster updated after its Date
+type Updater interface {
+	// Updated returns the time of the last update, which is Date
+	// if never updated.
+	Updated() time.Time
+}
+
+// Updated gives the time of the post's last update, which is its Date
+// if it's never updated
+func Updated(p Poster) time.Time {
+	if u, ok := p.(Updater); ok {
+		return u.Updated()
+	}
+	return p.Date()
+}
+
+// Drafter is optionally implemented by a Poster which may be a draft
+type Drafter interface {
+	// IsDraft reports whether this post is a draft which shouldn't be
+	// published yet.
+	IsDraft() bool
+}
+
+// IsDraft reports whether the post is a draft, which it isn't unless
+// it tells
+func IsDraft(p Poster) bool {
+	if d, ok := p.(Drafter); ok {
+		return d.IsDraft()
+	}
+	return false
+}
+
+// isPublished reports whether a post is visible at the time t, that is
+// neither a draft nor scheduled for a later date.
+func isPublished(p Poster, t time.Time) bool {
+	return !IsDraft(p) && !p.Date().After(t)
+}
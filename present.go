@@ -2,10 +2,17 @@ package storage
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"html"
 	"html/template"
 	"io"
 	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/tools/present"
 )
@@ -164,28 +171,31 @@ var (
 		match: func(filename string) bool {
 			return strings.HasSuffix(filename, ".article")
 		},
+		sniff: true,
 	}
 	slideGenerator = presentGenerator{
 		match: func(filename string) bool {
 			return strings.HasSuffix(filename, ".slide")
 		},
+		slide: true,
 	}
-)
 
-func init() {
-	funcMap := template.FuncMap{
+	// the functions for the templates besides the ones of present
+	presentFuncs = template.FuncMap{
 		"sectioned": func(d *present.Doc) bool {
 			return len(d.Sections) > 1
 		},
 	}
+)
 
+func init() {
 	// init articleTmpl and slideTmpl
 	var e error
-	articleTmpl, e = present.Template().Funcs(funcMap).Parse(articleTmplString)
+	articleTmpl, e = present.Template().Funcs(presentFuncs).Parse(articleTmplString)
 	if e != nil {
 		panic(e)
 	}
-	slideTmpl, e = present.Template().Funcs(funcMap).Parse(slideTmplString)
+	slideTmpl, e = present.Template().Funcs(presentFuncs).Parse(slideTmplString)
 	if e != nil {
 		panic(e)
 	}
@@ -196,36 +206,116 @@ func init() {
 	articleGenerator.tmpl = articleTmpl
 	slideGenerator.tmpl = slideTmpl
 
-	RegisterGenerator(articleGenerator)
-	RegisterGenerator(slideGenerator)
+	RegisterNamedGenerator("article", 0, articleGenerator)
+	RegisterNamedGenerator("slide", 0, slideGenerator)
 }
 
 type presentGenerator struct {
-	match func(string) bool
-	tmpl  *template.Template
+	match       func(string) bool
+	tmpl        *template.Template
+	slide       bool
+	sniff       bool   // whether to recognize the sources by the header
+	imagePrefix string // of the image links, ImagePrefix if empty
+}
+
+// PresentOptions are the options of the present generators. The
+// templates are loaded from the files over the default ones, so they
+// may only redefine some of them, like the "root" or "image" template.
+type PresentOptions struct {
+	ArticleTemplate string `json:"articleTemplate"`
+	SlideTemplate   string `json:"slideTemplate"`
+	// ImagePrefix replaces the ImagePrefix of the local images' links,
+	// and the Prefix of the repository's StaticURL, whose Base and Hash
+	// still apply
+	ImagePrefix string `json:"imagePrefix"`
+}
+
+// NewPresentGenerators creates the generators of the present articles
+// and slides with the options
+func NewPresentGenerators(opts PresentOptions) (article, slide Generator, err error) {
+	a, s := articleGenerator, slideGenerator
+	a.imagePrefix, s.imagePrefix = opts.ImagePrefix, opts.ImagePrefix
+	if opts.ArticleTemplate != "" {
+		if a.tmpl, err = loadPresentTemplate(articleTmplString, opts.ArticleTemplate); err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.SlideTemplate != "" {
+		if s.tmpl, err = loadPresentTemplate(slideTmplString, opts.SlideTemplate); err != nil {
+			return nil, nil, err
+		}
+	}
+	return a, s, nil
+}
+
+// loadPresentTemplate loads the template file over the default one
+func loadPresentTemplate(base, path string) (*template.Template, error) {
+	t, err := present.Template().Funcs(presentFuncs).Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if t, err = t.ParseFiles(path); err != nil {
+		return nil, fmt.Errorf("present: %s\n", err)
+	}
+	return t, nil
 }
 
 func (p presentGenerator) Match(filename string) bool {
 	return p.match(filename)
 }
 
+// Sniff recognizes the header with a date or tags after the title, the
+// sources without an extension are articles rather than slides
+func (p presentGenerator) Sniff(head []byte) bool {
+	if !p.sniff {
+		return false
+	}
+	lines := strings.Split(strings.TrimLeft(string(head), " \t\r\n"), "\n")
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Tags:") {
+			return true
+		}
+		if _, err := time.Parse("15:04 2 Jan 2006", line); err == nil {
+			return true
+		}
+		if _, err := time.Parse("2 Jan 2006", line); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (p presentGenerator) Generate(input io.Reader, s Staticer) (Poster, error) {
 	return p.generate(input, s, p.tmpl)
 }
 
-func (presentGenerator) generate(input io.Reader, s Staticer, tmpl *template.Template) (Poster, error) {
-	ctx := &present.Context{func(filename string) ([]byte, error) {
+func (p presentGenerator) generate(input io.Reader, s Staticer, tmpl *template.Template) (Poster, error) {
+	ctx := &present.Context{ReadFile: func(filename string) ([]byte, error) {
 		r := s.Static(filename)
 		defer r.Close()
 		return ioutil.ReadAll(r)
 	}}
-	doc, err := ctx.Parse(input, "", 0)
+	c, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var m meta
+	stripped, err := stripAttrs(c, &m)
 	if err != nil {
 		return nil, err
 	}
-	key := title2Key(doc.Title)
+	doc, err := ctx.Parse(bytes.NewReader(stripped), "", 0)
+	if err != nil {
+		return nil, presentError(err, bytes.Count(c, []byte("\n"))-bytes.Count(stripped, []byte("\n")))
+	}
+	key := generateKey(doc.Title, m.slug, s)
 
-	images := fixImageLink(doc, key)
+	images, links := fixLinks(doc, s, p.imagePrefix, key)
+	highlightCode(doc)
 
 	// TODO: buffer pool
 	b := new(bytes.Buffer)
@@ -234,36 +324,207 @@ func (presentGenerator) generate(input io.Reader, s Staticer, tmpl *template.Tem
 		return nil, err
 	}
 
-	return newPost(meta{
-		title:      doc.Title,
-		date:       doc.Time,
-		key:        key,
-		content:    bytes2String(b.Bytes()),
-		tags:       doc.Tags,
-		isSlide:    tmpl == slideTmpl,
-		staticList: images,
-	}), nil
+	m.title = doc.Title
+	m.date = doc.Time
+	m.key = key
+	m.content = bytes2String(b.Bytes())
+	m.tags = doc.Tags
+	m.isSlide = p.slide
+	m.staticList = images
+	m.links = links
+	m.toc = presentTOC(doc, m.isSlide)
+	return newPost(m), nil
+}
+
+// stripAttrs applies the optional attributes found in the header to m
+// and removes them, as the present parser doesn't know them.
+func stripAttrs(input []byte, m *meta) ([]byte, error) {
+	lines := bytes.SplitAfter(input, []byte("\n"))
+	out := make([]byte, 0, len(input))
+	seenTitle := false
+	for i, line := range lines {
+		text := strings.TrimSpace(string(line))
+		if text == "" {
+			if seenTitle {
+				// end of header
+				for _, l := range lines[i:] {
+					out = append(out, l...)
+				}
+				break
+			}
+		} else if !seenTitle {
+			seenTitle = true
+		} else if name, value, ok := parseAttr(text); ok {
+			if err := m.applyAttr(name, value); err != nil {
+				return nil, &LineError{i + 1, err}
+			}
+			continue
+		}
+		out = append(out, line...)
+	}
+	return out, nil
+}
+
+// presentErrorRE matches the errors of the present parser, which look
+// like "<name>:<line>: <message>"
+var presentErrorRE = regexp.MustCompile(`^:(\d+): (.*)$`)
+
+// presentError turns a parser error with a line number into LineError,
+// the stripped lines before it are counted back.
+func presentError(err error, stripped int) error {
+	m := presentErrorRE.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(m[1])
+	return &LineError{line + stripped, errors.New(m[2])}
 }
 
-func fixImageLink(doc *present.Doc, key string) (images []string) {
+// presentTOC collects the sections which are rendered with an anchor
+func presentTOC(doc *present.Doc, isSlide bool) []*Heading {
+	var tb tocBuilder
+	var walk func(present.Elem)
+	walk = func(e present.Elem) {
+		s, ok := e.(present.Section)
+		if !ok {
+			return
+		}
+		tb.add(len(s.Number), s.Title, "TOC_"+s.FormattedNumber())
+		for _, e := range s.Elem {
+			walk(e)
+		}
+	}
+	for _, s := range doc.Sections {
+		// the outermost sections are slides or the only section
+		// of an article, which have no anchor
+		if isSlide || len(doc.Sections) == 1 {
+			for _, e := range s.Elem {
+				walk(e)
+			}
+		} else {
+			walk(s)
+		}
+	}
+	return tb.toc
+}
+
+// walkElems replaces all the elements except sections in doc with
+// the results of f
+func walkElems(doc *present.Doc, f func(present.Elem) present.Elem) {
 	var checkElem func(present.Elem) present.Elem
 	checkElem = func(e present.Elem) present.Elem {
 		if s, ok := e.(present.Section); ok {
 			for i, e := range s.Elem {
 				s.Elem[i] = checkElem(e)
 			}
+			return s
 		}
-		if image, ok := e.(present.Image); ok {
-			if needChangeImageLink(image.URL) {
-				image.URL = generateImageLink(key, image.URL)
-				images = append(images, image.URL)
-				return image
-			}
-		}
-		return e
+		return f(e)
 	}
 	for i, s := range doc.Sections {
 		doc.Sections[i] = checkElem(s).(present.Section)
 	}
+}
+
+// fixLinks collects the links of the local static resources and the
+// keys of the linked posts in doc. It rewrites the urls relative to the
+// post in the images, the iframes, the links and the html.
+func fixLinks(doc *present.Doc, s Staticer, prefix, key string) (statics, links []string) {
+	href := func(link string) string {
+		return localLink(s, prefix, key, link, &statics, &links)
+	}
+	walkElems(doc, func(e present.Elem) present.Elem {
+		switch e := e.(type) {
+		case present.Image:
+			if needChangeImageLink(e.URL) {
+				e.URL = staticLink(s, prefix, key, e.URL)
+				statics = append(statics, e.URL)
+			}
+			return e
+		case present.Iframe:
+			e.URL = href(e.URL)
+			return e
+		case present.Link:
+			if e.URL != nil {
+				if u, err := url.Parse(href(e.URL.String())); err == nil {
+					e.URL = u
+				}
+			}
+			return e
+		case present.Text:
+			if !e.Pre {
+				for i, line := range e.Lines {
+					e.Lines[i] = fixTextLinks(line, href)
+				}
+			}
+			return e
+		case present.List:
+			for i, line := range e.Bullet {
+				e.Bullet[i] = fixTextLinks(line, href)
+			}
+			return e
+		case present.HTML:
+			e.HTML = template.HTML(RewriteURLs(string(e.HTML), href))
+			return e
+		}
+		return e
+	})
 	return
 }
+
+// textLinkRE matches an inline link of present, like "[[url][label]]"
+var textLinkRE = regexp.MustCompile(`\[\[([^\]]+)\](\[[^\]]+\])?\]`)
+
+// fixTextLinks rewrites the urls of the inline links in a line of text
+func fixTextLinks(line string, href func(string) string) string {
+	return textLinkRE.ReplaceAllStringFunc(line, func(l string) string {
+		sm := textLinkRE.FindStringSubmatch(l)
+		link, label := href(sm[1]), sm[2]
+		if link == sm[1] {
+			return l
+		}
+		if label == "" {
+			// the label was the url
+			label = "[" + sm[1] + "]"
+		}
+		return "[[" + link + "]" + label + "]"
+	})
+}
+
+// codeLineRE matches a line of the code rendered by present
+var codeLineRE = regexp.MustCompile(`<span num="(\d+)">(.*?)</span>\n`)
+
+// highlightCode highlights the code elements according to the files'
+// extensions, the line numbers and the highlighted lines are kept.
+func highlightCode(doc *present.Doc) {
+	unstyle := strings.NewReplacer("<b>", "", "</b>", "")
+	walkElems(doc, func(e present.Elem) present.Elem {
+		c, ok := e.(present.Code)
+		if !ok {
+			return e
+		}
+		l := findLexer(c.Ext)
+		if l == nil {
+			return e
+		}
+		text := string(c.Text)
+		matches := codeLineRE.FindAllStringSubmatchIndex(text, -1)
+		src := make([]string, len(matches))
+		for i, m := range matches {
+			src[i] = html.UnescapeString(unstyle.Replace(text[m[4]:m[5]]))
+		}
+		lines := highlightLines(l, strings.Join(src, "\n"))
+
+		var b strings.Builder
+		last := 0
+		for i, m := range matches {
+			b.WriteString(text[last:m[0]])
+			num, _ := strconv.Atoi(text[m[2]:m[3]])
+			writeLine(&b, num, strings.Contains(text[m[4]:m[5]], "<b>"), lines[i])
+			last = m[1]
+		}
+		b.WriteString(text[last:])
+		c.Text = template.HTML(b.String())
+		return c
+	})
+}
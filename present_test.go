@@ -1,7 +1,12 @@
 package storage
 
 import (
+	"errors"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -40,9 +45,14 @@ func TestArticleGenerate(t *testing.T) {
 				key:        "Title",
 				title:      "Title",
 				date:       parseTime("2006-01-02"),
-				content:    "<h2>Subtitle</h2><p>Some Text</p><h4 id=\"TOC_1.1.\">Subsection</h4><ul><li>bullets</li><li>more bullets</li><li>a bullet with</li></ul><h4 id=\"TOC_1.1.1.\">Sub-subsection</h4><p>Some More text</p><div class=\"code\"><pre>Preformatted text\nis indented (however you like)</pre></div><p>Further Text, including invocations like:</p><div class=\"code\">\n\n\n<pre><span num=\"7\">func main() {</span>\n<span num=\"8\">    fmt.Println(&#34;hello tw&#34;)</span>\n<span num=\"9\">}</span>\n</pre>\n\n\n</div><div class=\"playground\">\n\n\n<pre><span num=\"1\">package main</span>\n<span num=\"2\"></span>\n<span num=\"3\">import (</span>\n<span num=\"4\">    &#34;fmt&#34;</span>\n<span num=\"5\">)</span>\n<span num=\"6\"></span>\n<span num=\"7\">func main() {</span>\n<span num=\"8\">    fmt.Println(&#34;hello tw&#34;)</span>\n<span num=\"9\">}</span>\n</pre>\n\n\n</div><div class=\"image\">\n<img src=\"/images/Title/image.jpg\">\n</div><div class=\"image\">\n<img src=\"http://foo/image.jpg\">\n</div><div class=\"iframe\">\n<iframe src=\"http://foo\"frameborder=\"0\" allowfullscreen mozallowfullscreen webkitallowfullscreen></iframe>\n</div><p class=\"link\"><a href=\"http://foo\" target=\"_blank\">label</a></p><html><head>test</head><body><h1>hello tw</h1></body></html>\n<p>Again, more text</p>",
+				content:    "<h2>Subtitle</h2><p>Some Text</p><h4 id=\"TOC_1.1.\">Subsection</h4><ul><li>bullets</li><li>more bullets</li><li>a bullet with</li></ul><h4 id=\"TOC_1.1.1.\">Sub-subsection</h4><p>Some More text</p><div class=\"code\"><pre>Preformatted text\nis indented (however you like)</pre></div><p>Further Text, including invocations like:</p><div class=\"code\">\n\n\n<pre><span num=\"7\"><span class=\"kw\">func</span> main() {</span>\n<span num=\"8\">    fmt.Println(<span class=\"str\">&#34;hello tw&#34;</span>)</span>\n<span num=\"9\">}</span>\n</pre>\n\n\n</div><div class=\"playground\">\n\n\n<pre><span num=\"1\"><span class=\"kw\">package</span> main</span>\n<span num=\"2\"></span>\n<span num=\"3\"><span class=\"kw\">import</span> (</span>\n<span num=\"4\">    <span class=\"str\">&#34;fmt&#34;</span></span>\n<span num=\"5\">)</span>\n<span num=\"6\"></span>\n<span num=\"7\"><span class=\"kw\">func</span> main() {</span>\n<span num=\"8\">    fmt.Println(<span class=\"str\">&#34;hello tw&#34;</span>)</span>\n<span num=\"9\">}</span>\n</pre>\n\n\n</div><div class=\"image\">\n<img src=\"/images/Title/image.jpg\">\n</div><div class=\"image\">\n<img src=\"http://foo/image.jpg\">\n</div><div class=\"iframe\">\n<iframe src=\"http://foo\"frameborder=\"0\" allowfullscreen mozallowfullscreen webkitallowfullscreen></iframe>\n</div><p class=\"link\"><a href=\"http://foo\" target=\"_blank\">label</a></p><html><head>test</head><body><h1>hello tw</h1></body></html>\n<p>Again, more text</p>",
 				tags:       []string{"foo", "bar", "baz"},
 				staticList: []string{"/images/Title/image.jpg"},
+				toc: []*Heading{
+					{Level: 2, Title: "Subsection", Anchor: "TOC_1.1.", Children: []*Heading{
+						{Level: 3, Title: "Sub-subsection", Anchor: "TOC_1.1.1."},
+					}},
+				},
 			}),
 		},
 	} {
@@ -99,10 +109,15 @@ func TestSlideGenerate(t *testing.T) {
 				key:        "Title",
 				title:      "Title",
 				date:       parseTime("2006-01-02"),
-				content:    "<section class='slides layout-widescreen'>\n<article>\n<h1>Title</h1><h3>Subtitle</h3><h3>2 January 2006</h3><div class=\"presenter\"><p>Author Name</p><p>Job title, Company</p></div></article>\n<article><h3>Title of slide or section (must have asterisk)</h3><p>Some Text</p><h2id=\"TOC_1.1.\">1.1.Subsection</h2><ul><li>bullets</li><li>more bullets</li><li>a bullet with</li></ul><h3id=\"TOC_1.1.1.\">1.1.1.Sub-subsection</h3><p>Some More text</p><div class=\"code\"><pre>Preformatted text\nis indented (however you like)</pre></div><p>Further Text, including invocations like:</p><div class=\"code\" contenteditable=\"true\" spellcheck=\"false\">\n\n\n<pre><span num=\"7\">func main() {</span>\n<span num=\"8\">    fmt.Println(&#34;hello tw&#34;)</span>\n<span num=\"9\">}</span>\n</pre>\n\n\n</div><div class=\"codeplayground\" contenteditable=\"true\" spellcheck=\"false\">\n\n\n<pre><span num=\"1\">package main</span>\n<span num=\"2\"></span>\n<span num=\"3\">import (</span>\n<span num=\"4\">    &#34;fmt&#34;</span>\n<span num=\"5\">)</span>\n<span num=\"6\"></span>\n<span num=\"7\">func main() {</span>\n<span num=\"8\">    fmt.Println(&#34;hello tw&#34;)</span>\n<span num=\"9\">}</span>\n</pre>\n\n\n</div><div class=\"image\">\n<img src=\"/images/Title/image.jpg\">\n</div><div class=\"image\">\n<img src=\"http://foo/image.jpg\">\n</div><iframe src=\"http://foo\"></iframe><p class=\"link\"><a href=\"http://foo\" target=\"_blank\">label</a></p><html><head>test</head><body><h1>hello tw</h1></body></html>\n<p>Again, more text</p></article>\n<article>\n<h3>Thank you</h1><div class=\"presenter\"><p>Author Name</p><p>Job title, Company</p><p class=\"link\"><a href=\"mailto:joe@example.com\" target=\"_blank\">joe@example.com</a></p><p class=\"link\"><a href=\"http://url/\" target=\"_blank\">http://url/</a></p><p class=\"link\"><a href=\"http://twitter.com/twitter_name\" target=\"_blank\">@twitter_name</a></p></div></article>",
+				content:    "<section class='slides layout-widescreen'>\n<article>\n<h1>Title</h1><h3>Subtitle</h3><h3>2 January 2006</h3><div class=\"presenter\"><p>Author Name</p><p>Job title, Company</p></div></article>\n<article><h3>Title of slide or section (must have asterisk)</h3><p>Some Text</p><h2id=\"TOC_1.1.\">1.1.Subsection</h2><ul><li>bullets</li><li>more bullets</li><li>a bullet with</li></ul><h3id=\"TOC_1.1.1.\">1.1.1.Sub-subsection</h3><p>Some More text</p><div class=\"code\"><pre>Preformatted text\nis indented (however you like)</pre></div><p>Further Text, including invocations like:</p><div class=\"code\" contenteditable=\"true\" spellcheck=\"false\">\n\n\n<pre><span num=\"7\"><span class=\"kw\">func</span> main() {</span>\n<span num=\"8\">    fmt.Println(<span class=\"str\">&#34;hello tw&#34;</span>)</span>\n<span num=\"9\">}</span>\n</pre>\n\n\n</div><div class=\"codeplayground\" contenteditable=\"true\" spellcheck=\"false\">\n\n\n<pre><span num=\"1\"><span class=\"kw\">package</span> main</span>\n<span num=\"2\"></span>\n<span num=\"3\"><span class=\"kw\">import</span> (</span>\n<span num=\"4\">    <span class=\"str\">&#34;fmt&#34;</span></span>\n<span num=\"5\">)</span>\n<span num=\"6\"></span>\n<span num=\"7\"><span class=\"kw\">func</span> main() {</span>\n<span num=\"8\">    fmt.Println(<span class=\"str\">&#34;hello tw&#34;</span>)</span>\n<span num=\"9\">}</span>\n</pre>\n\n\n</div><div class=\"image\">\n<img src=\"/images/Title/image.jpg\">\n</div><div class=\"image\">\n<img src=\"http://foo/image.jpg\">\n</div><iframe src=\"http://foo\"></iframe><p class=\"link\"><a href=\"http://foo\" target=\"_blank\">label</a></p><html><head>test</head><body><h1>hello tw</h1></body></html>\n<p>Again, more text</p></article>\n<article>\n<h3>Thank you</h1><div class=\"presenter\"><p>Author Name</p><p>Job title, Company</p><p class=\"link\"><a href=\"mailto:joe@example.com\" target=\"_blank\">joe@example.com</a></p><p class=\"link\"><a href=\"http://url/\" target=\"_blank\">http://url/</a></p><p class=\"link\"><a href=\"http://twitter.com/twitter_name\" target=\"_blank\">@twitter_name</a></p></div></article>",
 				tags:       []string{"foo", "bar", "baz"},
 				staticList: []string{"/images/Title/image.jpg"},
-				isSlide:    true,
+				toc: []*Heading{
+					{Level: 2, Title: "Subsection", Anchor: "TOC_1.1.", Children: []*Heading{
+						{Level: 3, Title: "Sub-subsection", Anchor: "TOC_1.1.1."},
+					}},
+				},
+				isSlide: true,
 			}),
 		},
 	} {
@@ -124,3 +139,137 @@ func TestSlideGenerate(t *testing.T) {
 		})
 	}
 }
+
+func TestStripAttrs(t *testing.T) {
+	for name, c := range map[string]struct {
+		input  string
+		expect string
+		draft  bool
+	}{
+		"none": {
+			input:  "Title\nTags: foo\n\n* Section\n",
+			expect: "Title\nTags: foo\n\n* Section\n",
+		},
+		"draft": {
+			input:  "Title\nDraft: true\nTags: foo\n\n* Section\nDraft: false\n",
+			expect: "Title\nTags: foo\n\n* Section\nDraft: false\n",
+			draft:  true,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			var m meta
+			got, err := stripAttrs([]byte(c.input), &m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.expect {
+				t.Errorf("got %q, but want %q\n", got, c.expect)
+			}
+			if m.draft != c.draft {
+				t.Errorf("got draft %v, but want %v\n", m.draft, c.draft)
+			}
+		})
+	}
+}
+
+func TestNewPresentGenerators(t *testing.T) {
+	dir, err := ioutil.TempDir("", "present")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmpl := filepath.Join(dir, "image.tmpl")
+	err = ioutil.WriteFile(tmpl, []byte(`{{- define "image" -}}<figure><img src="{{- .URL -}}"></figure>{{- end -}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const input = "Title\n0:00 2 Jan 2006\n\n* Section\n\n.image a.png\n"
+	for name, c := range map[string]struct {
+		opts          PresentOptions
+		expectErr     error
+		expectArticle Poster
+		expectSlide   Poster
+	}{
+		"template": {
+			opts: PresentOptions{
+				ArticleTemplate: tmpl,
+				ImagePrefix:     "https://cdn.x.org/images",
+			},
+			expectArticle: newPost(meta{
+				key:        "Title",
+				title:      "Title",
+				date:       parseTime("2006-01-02"),
+				content:    "<figure><img src=\"https://cdn.x.org/images/Title/a.png\"></figure>",
+				staticList: []string{"https://cdn.x.org/images/Title/a.png"},
+			}),
+			expectSlide: newPost(meta{
+				key:        "Title",
+				title:      "Title",
+				date:       parseTime("2006-01-02"),
+				content:    "<section class='slides layout-widescreen'>\n<article>\n<h1>Title</h1><h3>2 January 2006</h3></article>\n<article><h3>Section</h3><div class=\"image\">\n<img src=\"https://cdn.x.org/images/Title/a.png\">\n</div></article>\n<article>\n<h3>Thank you</h1></article>",
+				isSlide:    true,
+				staticList: []string{"https://cdn.x.org/images/Title/a.png"},
+			}),
+		},
+		"noTemplate": {
+			opts:      PresentOptions{SlideTemplate: filepath.Join(dir, "noexist.tmpl")},
+			expectErr: errors.New("present: open " + filepath.Join(dir, "noexist.tmpl")),
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			article, slide, err := NewPresentGenerators(c.opts)
+			if err = matchError(c.expectErr, err); err != nil {
+				t.Fatal(err)
+			}
+			if c.expectErr != nil {
+				return
+			}
+			got, err := article.Generate(strings.NewReader(input), ts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isPosterEqual(got, c.expectArticle) {
+				t.Errorf("article mismatch:\ngot: %#v\nwant:%#v\n", got, c.expectArticle)
+			}
+			if got, err = slide.Generate(strings.NewReader(input), ts); err != nil {
+				t.Fatal(err)
+			}
+			if !isPosterEqual(got, c.expectSlide) {
+				t.Errorf("slide mismatch:\ngot: %#v\nwant:%#v\n", got, c.expectSlide)
+			}
+		})
+	}
+}
+
+func TestPresentStaticLinks(t *testing.T) {
+	files := map[string]string{
+		"frag.html": `<p><img src="a.png"><a href="doc.pdf?v=1#p2">doc</a> <a href="/tags/">tags</a> <a href="#x">x</a></p>`,
+	}
+	s := repoStaticer{
+		StaticFunc: func(path string) io.ReadCloser {
+			return ioutil.NopCloser(strings.NewReader(files[path]))
+		},
+		url: StaticURL{Base: "https://cdn.x.org", Prefix: "static"},
+	}
+	got, err := articleGenerator.Generate(strings.NewReader("Title\n0:00 2 Jan 2006\n\n* Section\n\n.iframe page.html 300 400\n.html frag.html\n"), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := newPost(meta{
+		key:     "Title",
+		title:   "Title",
+		date:    parseTime("2006-01-02"),
+		content: "<div class=\"iframe\">\n<iframe src=\"https://cdn.x.org/static/Title/page.html\"height=\"300\"width=\"400\"frameborder=\"0\" allowfullscreen mozallowfullscreen webkitallowfullscreen></iframe>\n</div><p><img src=\"https://cdn.x.org/static/Title/a.png\"><a href=\"https://cdn.x.org/static/Title/doc.pdf?v=1#p2\">doc</a> <a href=\"/tags/\">tags</a> <a href=\"#x\">x</a></p>",
+		staticList: []string{
+			"https://cdn.x.org/static/Title/page.html",
+			"https://cdn.x.org/static/Title/a.png",
+			"https://cdn.x.org/static/Title/doc.pdf",
+		},
+	})
+	if !isPosterEqual(got, expect) {
+		t.Errorf("result mismatch:\ngot: %#v\nwant:%#v\n", got, expect)
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"log"
+	"sync"
 	"time"
 )
 
@@ -15,6 +16,13 @@ type Repository interface {
 	Uninstall(s Storager)
 }
 
+// Configurer is implemented by the repositories which accept the
+// options in their Config
+type Configurer interface {
+	// Configure is called once the repository is created
+	Configure(c *Config) error
+}
+
 // Creator creates a repository with a root path
 type Creator func(root string) (Repository, error)
 
@@ -31,47 +39,78 @@ func UnregisterRepoType(t string) {
 	delete(supportedRepoTypes, t)
 }
 
-func newRepos(configPath string, s Storager) ([]Repository, error) {
-	cfg, err := getConfig(configPath)
-	if err != nil {
-		return nil, err
-	}
-
-	var rs []Repository
+// newRepos creates the repositories in the config, the returned channel
+// is closed once all of them are refreshed for the first time
+func newRepos(cfg Configs, s Storager) ([]Repository, <-chan struct{}) {
+	var (
+		rs []Repository
+		ss []Storager // the storage for each repository
+	)
 	for _, c := range cfg {
 		kind := c.Type
 		root := c.Root
 		if create, supported := supportedRepoTypes[kind]; supported {
+			policy, found := findPolicy(c.Trust)
+			if !found {
+				log.Printf("add repo: trust level(%s) isn't supported\n", c.Trust)
+				continue
+			}
+
 			repo, err := create(root)
 			if err != nil {
 				log.Printf("create repo failed: %s\n", err)
 				continue
 			}
 
+			if cr, ok := repo.(Configurer); ok {
+				if err := cr.Configure(c); err != nil {
+					log.Printf("configure repo failed: %s\n", err)
+					continue
+				}
+			}
+
 			if err := repo.Install(c.User, c.Password); err != nil {
 				log.Printf("install repo failed: %s\n", err)
 				continue
 			}
 
 			rs = append(rs, repo)
+			if policy != nil {
+				ss = append(ss, sanitizer{s, policy})
+			} else {
+				ss = append(ss, s)
+			}
 			log.Printf("add a repo, type:%s, root:%s\n", kind, root)
 		} else {
 			log.Printf("add repo: type(%s) isn't supported yet\n", kind)
 		}
 	}
 
-	startRepoChecker(rs, s)
+	ready := startRepoChecker(rs, ss)
 
-	return rs, nil
+	return rs, ready
 }
 
-func startRepoChecker(rs []Repository, s Storager) {
-	for _, repo := range rs {
-		go func(repo Repository) {
+// startRepoChecker refreshes the repositories at once and then every
+// second, the returned channel is closed after the first refreshes
+func startRepoChecker(rs []Repository, ss []Storager) <-chan struct{} {
+	var wg sync.WaitGroup
+	wg.Add(len(rs))
+	for i, repo := range rs {
+		go func(repo Repository, s Storager) {
+			repo.Refresh(s)
+			wg.Done()
 			c := time.Tick(1 * time.Second)
 			for range c {
 				repo.Refresh(s)
 			}
-		}(repo)
+		}(repo, ss[i])
 	}
+
+	ready := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ready)
+	}()
+	return ready
 }
@@ -1,13 +1,18 @@
 package storage
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"path"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/v29/github"
 	"github.com/gregjones/httpcache"
@@ -20,11 +25,18 @@ func init() {
 var nilError = errors.New("nil error")
 
 type githubRepo struct {
-	client   *github.Client
-	owner    string
-	name     string
-	posts    map[string]*githubPost
-	lastSHA1 string
+	client    *github.Client
+	owner     string
+	name      string
+	strict    bool
+	namespace string
+	staticURL StaticURL
+	include   []string
+	exclude   []string
+	gens      *GeneratorMap
+	posts     map[string]*githubPost
+	files     map[string]bool // the files in the tree of lastSHA1
+	lastSHA1  string
 }
 
 func newGithubRepo(name string) (Repository, error) {
@@ -34,6 +46,22 @@ func newGithubRepo(name string) (Repository, error) {
 	}, nil
 }
 
+// Implement the Configurer interface
+func (gr *githubRepo) Configure(c *Config) error {
+	gr.strict = c.Strict
+	gr.namespace = c.Namespace
+	gr.staticURL = c.StaticURL
+	gr.include, gr.exclude = c.Include, c.Exclude
+	var err error
+	if gr.gens, err = newGeneratorMap(c); err != nil {
+		return err
+	}
+	if err = c.StaticURL.check(); err != nil {
+		return err
+	}
+	return (&PathFilter{Include: c.Include, Exclude: c.Exclude}).check()
+}
+
 // Implement the Repository interface
 func (gr *githubRepo) Install(user, password string) error {
 	// TODO:	oauth2
@@ -84,10 +112,18 @@ func (gr *githubRepo) Refresh(s Storager) {
 		return
 	}
 	treeArray := tree.Entries
+	filter := gr.filter(treeArray)
 	paths := make([]string, 0)
+	gr.files = make(map[string]bool)
 	for i := range treeArray {
 		path := treeArray[i].GetPath()
-		if FindGenerator(path) == nil {
+		if treeArray[i].GetType() == "blob" {
+			gr.files[path] = true
+		}
+		if !filter.Match(path) {
+			continue
+		}
+		if gen, sniff := gr.gens.Find(path); gen == nil && !sniff {
 			continue
 		}
 		paths = append(paths, path)
@@ -101,6 +137,29 @@ func (gr *githubRepo) Refresh(s Storager) {
 	gr.lastSHA1 = sha1
 }
 
+// filter gives the filter of the config and the IgnoreFile in the tree
+func (gr *githubRepo) filter(entries []github.TreeEntry) *PathFilter {
+	filter := &PathFilter{
+		Include: gr.include,
+		Exclude: append(append([]string(nil), defaultExclude...), gr.exclude...),
+	}
+	for i := range entries {
+		if entries[i].GetPath() != IgnoreFile {
+			continue
+		}
+		rc, err := gr.client.Repositories.DownloadContents(context.Background(), gr.owner, gr.name, IgnoreFile, nil)
+		if err != nil {
+			log.Printf("failed to get %s: %s\n", IgnoreFile, err)
+			break
+		}
+		if err = filter.ReadIgnore(rc); err != nil {
+			log.Printf("failed to read %s: %s\n", IgnoreFile, err)
+		}
+		rc.Close()
+	}
+	return filter
+}
+
 // the paths has been sorted in increasing order
 func (gr *githubRepo) clean(s Storager, paths []string) {
 	cleans := make([]Keyer, 0)
@@ -120,32 +179,62 @@ func (gr *githubRepo) clean(s Storager, paths []string) {
 
 // the paths has been sorted in increasing order
 func (gr *githubRepo) update(s Storager, paths []string) {
+	// all the posts are known before generating them for the links
+	// between them
 	for _, path := range paths {
-		post, found := gr.posts[path]
-		if !found {
-			post = newGithubPost(path, gr)
-			gr.posts[path] = post
+		if _, found := gr.posts[path]; !found {
+			gr.posts[path] = newGithubPost(path, gr)
 			dprintf("Add a new github post(%s)\n", path)
 		}
-		// update a exist one
-		if e := post.update(s); e != nil {
-			log.Printf("Update a github post(%s) failed: %s\n", path, e)
+	}
+	var pending []string
+	for _, path := range paths {
+		gr.updatePost(s, path)
+		if post := gr.posts[path]; post != nil && post.pending {
+			pending = append(pending, path)
+		}
+	}
+	// now the linked posts are generated
+	for _, path := range pending {
+		gr.updatePost(s, path)
+	}
+}
+
+// updatePost updates the post at path
+func (gr *githubRepo) updatePost(s Storager, path string) {
+	post := gr.posts[path]
+	if e := post.update(s); e == errNotPost {
+		// the sniffed file isn't a post
+		if post.Poster != nil {
+			if err := s.Remove(post); err != nil {
+				log.Printf("remove github post failed: %s\n", err)
+			}
 		}
+		delete(gr.posts, path)
+	} else if e != nil {
+		log.Printf("Update a github post(%s) failed: %s\n", path, e)
 	}
 }
 
 type githubPost struct {
 	Poster
-	repo *githubRepo
-	path string
-	gen  Generator
+	repo  *githubRepo
+	path  string
+	gen   Generator
+	sniff bool     // whether the generator is given by the content
+	moved []string // previous keys
+	// pending is set when the post links to a post not generated yet
+	pending  bool
+	warnings []string // the missing static resources
 }
 
 func newGithubPost(path string, repo *githubRepo) *githubPost {
+	gen, sniff := repo.gens.Find(path)
 	return &githubPost{
-		repo: repo,
-		path: path,
-		gen:  FindGenerator(path),
+		repo:  repo,
+		path:  path,
+		gen:   gen,
+		sniff: sniff,
 	}
 }
 
@@ -154,34 +243,158 @@ func (gp *githubPost) update(s Storager) error {
 	if err != nil {
 		return err
 	}
+	defer rc.Close()
 
-	p, err := gp.gen.Generate(rc, gp)
+	var r io.Reader = rc
+	gp.pending = false
+	if gp.sniff {
+		br := bufio.NewReader(rc)
+		head, _ := br.Peek(SniffLen)
+		if gp.gen = gp.repo.gens.SniffGenerator(head); gp.gen == nil {
+			return errNotPost
+		}
+		r = br
+	}
+	p, err := gp.gen.Generate(r, repoStaticer{
+		StaticFunc: gp.open,
+		namespace:  gp.repo.namespace,
+		url:        gp.repo.staticURL,
+		post:       gp.postKey,
+		title:      gp.titleKey,
+	})
 	if err != nil {
 		return err
 	}
 	// remove the old one if any
 	if gp.Poster != nil {
+		gp.moved = movedKeys(gp.moved, gp.Key(), p.Key())
 		err = s.Remove(gp)
 		if err != nil {
 			return err
 		}
 	}
 	gp.Poster = p
+	gp.warnings = missingStatics(p, gp.check)
+	for _, w := range gp.Warnings() {
+		log.Printf("Update a github post(%s): %s\n", gp.path, w)
+	}
 	// add the new one
 	err = s.Add(gp)
-	if err != nil {
+	if _, ok := err.(*KeyCollisionError); ok {
+		log.Printf("Add a github post(%s): %s\n", gp.path, err)
+	} else if err != nil {
 		return err
 	}
 	dprintf("update a github post(%s)\n", gp.path)
 	return nil
 }
 
+// Implement the Summarizer interface
+func (gp *githubPost) Summary() string            { return Summary(gp.Poster) }
+func (gp *githubPost) WordCount() int             { return WordCount(gp.Poster) }
+func (gp *githubPost) ReadingTime() time.Duration { return ReadingTime(gp.Poster) }
+
+// Implement the Outliner interface
+func (gp *githubPost) TOC() []*Heading { return TOC(gp.Poster) }
+
+// Implement the Updater interface
+func (gp *githubPost) Updated() time.Time { return Updated(gp.Poster) }
+
+// Implement the Drafter interface
+func (gp *githubPost) IsDraft() bool { return IsDraft(gp.Poster) }
+
+// Aliases includes the previous keys of the github post
+func (gp *githubPost) Aliases() []string {
+	return mergeAliases(Aliases(gp.Poster), gp.moved)
+}
+
+// Implement the Sourcer interface
+func (gp *githubPost) Source() string {
+	return "github:" + gp.repo.owner + "/" + gp.repo.name + "/" + gp.path
+}
+
+// Implement the Linker interface
+func (gp *githubPost) Links() []string {
+	return links(gp.Poster)
+}
+
+// Implement the Warner interface
+func (gp *githubPost) Warnings() []string {
+	return append(append([]string(nil), warnings(gp.Poster)...), gp.warnings...)
+}
+
+// name gives the path in the repository of a file relative to the
+// post, absolute paths are relative to the repository's root
+func (gp *githubPost) name(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)[1:]
+	}
+	return path.Join(path.Dir(gp.path), p)
+}
+
+// check reports an error if the file relative to the post isn't in the
+// tree
+func (gp *githubPost) check(p string) error {
+	if !gp.repo.files[gp.name(p)] {
+		return &os.PathError{Op: "static", Path: p, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+// postKey gives the key of the post generated from the file at p,
+// which is relative to the post like its static resources
+func (gp *githubPost) postKey(p string) (string, bool) {
+	target, found := gp.repo.posts[gp.name(p)]
+	if !found {
+		return "", false
+	}
+	if target.Poster == nil {
+		gp.pending = true
+		return "", false
+	}
+	return target.Key(), true
+}
+
+// titleKey gives the key of the post with the title in the repository
+func (gp *githubPost) titleKey(title string) (string, bool) {
+	key, found, ungenerated := "", false, false
+	for _, p := range gp.repo.posts {
+		if p.Poster == nil {
+			ungenerated = true
+			continue
+		}
+		if strings.EqualFold(p.Title(), title) && (!found || p.Key() < key) {
+			key, found = p.Key(), true
+		}
+	}
+	if !found && ungenerated {
+		// it may be a post not generated yet
+		gp.pending = true
+	}
+	return key, found
+}
+
 func (gp *githubPost) Static(p string) io.ReadCloser {
-	p = path.Join(path.Dir(gp.path), p)
-	rc, err := gp.repo.client.Repositories.DownloadContents(context.Background(), gp.repo.owner, gp.repo.name, p, nil)
+	if rc, ok := openEmbedded(gp.Poster, p); ok {
+		return rc
+	}
+	if gp.repo.strict && !isListed(gp, p) {
+		return staticError{&os.PathError{Op: "static", Path: p, Err: ErrNotListed}}
+	}
+	return gp.open(p)
+}
+
+// open downloads a file relative to the post, absolute paths are
+// relative to the repository's root. Files outside of the root are
+// refused.
+func (gp *githubPost) open(p string) io.ReadCloser {
+	name := gp.name(p)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return staticError{&os.PathError{Op: "static", Path: p, Err: ErrOutsideRepo}}
+	}
+	rc, err := gp.repo.client.Repositories.DownloadContents(context.Background(), gp.repo.owner, gp.repo.name, name, nil)
 	if err != nil {
-		log.Printf("failed to get static resource[%s]: %v\n", p, err)
-		return nil
+		return staticError{fmt.Errorf("failed to get static resource[%s]: %v\n", name, err)}
 	}
 	return rc
 }
@@ -1,12 +1,13 @@
 package storage
 
 import (
+	"bufio"
 	"errors"
-	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -15,8 +16,17 @@ func init() {
 }
 
 type localRepo struct {
-	root  string
-	posts map[string]*localPost
+	root      string
+	strict    bool
+	namespace string
+	staticURL StaticURL
+	include   []string
+	exclude   []string
+	filter    *PathFilter
+	gens      *GeneratorMap
+	posts     map[string]*localPost
+	unknown   map[string]time.Time // the modified time of the sniffed non-posts
+	walking   bool                 // whether some posts may not be walked yet
 }
 
 func newLocalRepo(root string) (Repository, error) {
@@ -30,11 +40,28 @@ func newLocalRepo(root string) (Repository, error) {
 		return nil, errors.New("you can't specify a file as a repo root")
 	}
 	return &localRepo{
-		root:  root,
-		posts: make(map[string]*localPost),
+		root:    root,
+		posts:   make(map[string]*localPost),
+		unknown: make(map[string]time.Time),
 	}, nil
 }
 
+// implement the Configurer interface
+func (lr *localRepo) Configure(c *Config) error {
+	lr.strict = c.Strict
+	lr.namespace = c.Namespace
+	lr.staticURL = c.StaticURL
+	lr.include, lr.exclude = c.Include, c.Exclude
+	var err error
+	if lr.gens, err = newGeneratorMap(c); err != nil {
+		return err
+	}
+	if err = c.StaticURL.check(); err != nil {
+		return err
+	}
+	return (&PathFilter{Include: c.Include, Exclude: c.Exclude}).check()
+}
+
 // implement the Repository interface
 func (lr *localRepo) Install(user, password string) error {
 	// TODO: verify user and password pair
@@ -54,7 +81,13 @@ func (lr *localRepo) Uninstall(s Storager) {
 }
 
 func (lr *localRepo) Refresh(s Storager) {
-	// delete the removed files
+	// the ignore file may be changed
+	filter, err := LoadPathFilter(lr.root, lr.include, lr.exclude)
+	if err != nil {
+		log.Printf("load the filter of local repo(%s) failed: %s\n", lr.root, err)
+	}
+	lr.filter = filter
+	// delete the removed and excluded files
 	lr.clean(s)
 	// add newer post and update the exist post
 	lr.update(s)
@@ -66,7 +99,7 @@ func (lr *localRepo) clean(s Storager) {
 	for relPath, p := range lr.posts {
 		absPath := filepath.Join(lr.root, relPath)
 		_, err := os.Stat(absPath)
-		if err != nil && os.IsNotExist(err) {
+		if err != nil && os.IsNotExist(err) || !lr.filter.Match(filepath.ToSlash(relPath)) {
 			cleans = append(cleans, p)
 			delete(lr.posts, relPath)
 		}
@@ -80,23 +113,40 @@ func (lr *localRepo) clean(s Storager) {
 
 // update add new post or update the exist ones
 func (lr *localRepo) update(s Storager) {
+	lr.walking = true
 	if err := filepath.Walk(lr.root, func(path string, info os.FileInfo, err error) error {
-		// only focus on regular files
-		if info.IsDir() {
+		if err != nil {
+			log.Printf("Walk local repo(%s) error: %s\n", lr.root, err)
 			return nil
 		}
 		relPath, _ := filepath.Rel(lr.root, path)
+		// only focus on the chosen regular files
+		if info.IsDir() {
+			if relPath != "." && lr.filter.SkipDir(filepath.ToSlash(relPath)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !lr.filter.Match(filepath.ToSlash(relPath)) {
+			return nil
+		}
 		post, found := lr.posts[relPath]
 		if !found {
-			post = newLocalPost(path)
+			if ut, ok := lr.unknown[relPath]; ok && !info.ModTime().After(ut) {
+				return nil
+			}
+			post = newLocalPost(path, lr.gens)
 			if post == nil {
 				return nil
 			}
+			post.repo = lr
 			lr.posts[relPath] = post
 			dprintf("Add a new local post(%s)\n", path)
 		}
 		// update an existing one
-		if e := post.update(s); e != nil {
+		if e := post.update(s); e == errNotPost {
+			lr.forget(s, relPath, info.ModTime())
+		} else if e != nil {
 			log.Printf("Update a local post(%s) failed: %s\n", path, e)
 		}
 		return nil
@@ -104,24 +154,54 @@ func (lr *localRepo) update(s Storager) {
 		log.Printf("Walk local repo(%s) error: %s\n",
 			lr.root, err)
 	}
+	lr.walking = false
+	// now the linked posts are known
+	for _, post := range lr.posts {
+		if !post.pending {
+			continue
+		}
+		post.lastUpdate = time.Time{}
+		if e := post.update(s); e != nil && e != errNotPost {
+			log.Printf("Update a local post(%s) failed: %s\n", post.path, e)
+		}
+	}
+}
+
+// forget forgets the sniffed file which isn't a post until it's modified
+func (lr *localRepo) forget(s Storager, relPath string, modTime time.Time) {
+	if p := lr.posts[relPath]; p.Poster != nil {
+		if err := s.Remove(p); err != nil {
+			log.Printf("remove local post failed: %s\n", err)
+		}
+	}
+	delete(lr.posts, relPath)
+	lr.unknown[relPath] = modTime
 }
 
 // represet a local post
 type localPost struct {
 	Poster
+	repo       *localRepo
 	path       string
 	gen        Generator
+	sniff      bool // whether the generator is given by the content
 	lastUpdate time.Time
+	moved      []string // previous keys
+	// pending is set when the post links to a post not generated yet,
+	// it's generated again after the others
+	pending  bool
+	warnings []string // the missing static resources
 }
 
-func newLocalPost(path string) *localPost {
-	gen := FindGenerator(path)
-	if gen == nil {
+func newLocalPost(path string, gens *GeneratorMap) *localPost {
+	gen, sniff := gens.Find(path)
+	if gen == nil && !sniff {
 		return nil
 	}
 	return &localPost{
-		path: path,
-		gen:  gen,
+		path:  path,
+		gen:   gen,
+		sniff: sniff,
 	}
 }
 
@@ -136,12 +216,13 @@ func (lp *localPost) update(s Storager) error {
 		return err
 	}
 	if ut := fi.ModTime(); ut.After(lp.lastUpdate) {
-		p, err := lp.gen.Generate(file, lp)
+		p, err := lp.generate(file)
 		if err != nil {
 			return err
 		}
 		// remove the old one if any
 		if lp.Poster != nil {
+			lp.moved = movedKeys(lp.moved, lp.Key(), p.Key())
 			err = s.Remove(lp)
 			if err != nil {
 				return err
@@ -149,9 +230,15 @@ func (lp *localPost) update(s Storager) error {
 		}
 		// add the new one
 		lp.Poster = p
+		lp.warnings = missingStatics(p, lp.check)
+		for _, w := range lp.Warnings() {
+			log.Printf("Update a local post(%s): %s\n", lp.path, w)
+		}
 		err = s.Add(lp)
-		if err != nil {
-			return nil
+		if _, ok := err.(*KeyCollisionError); ok {
+			log.Printf("Add a local post(%s): %s\n", lp.path, err)
+		} else if err != nil {
+			return err
 		}
 
 		lp.lastUpdate = ut
@@ -159,16 +246,195 @@ func (lp *localPost) update(s Storager) error {
 	return nil
 }
 
+// generate generates the post from its source
+func (lp *localPost) generate(r io.Reader) (Poster, error) {
+	var (
+		gens *GeneratorMap
+		s    = repoStaticer{StaticFunc: lp.open}
+	)
+	if lp.repo != nil {
+		gens = lp.repo.gens
+		s.namespace, s.url = lp.repo.namespace, lp.repo.staticURL
+		s.post, s.title = lp.postKey, lp.titleKey
+	}
+	lp.pending = false
+	if lp.sniff {
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(SniffLen)
+		if lp.gen = gens.SniffGenerator(head); lp.gen == nil {
+			return nil, errNotPost
+		}
+		r = br
+	}
+	return lp.gen.Generate(r, s)
+}
+
+// postKey gives the key of the post generated from the file at path,
+// which is relative to the post like its static resources
+func (lp *localPost) postKey(path string) (string, bool) {
+	lr := lp.repo
+	name := filepath.FromSlash(path)
+	if filepath.IsAbs(name) {
+		name = filepath.Join(lr.root, name)
+	} else {
+		name = filepath.Join(filepath.Dir(lp.path), name)
+	}
+	relPath, err := filepath.Rel(lr.root, name)
+	if err != nil {
+		return "", false
+	}
+	if target, found := lr.posts[relPath]; found {
+		if target.Poster == nil {
+			return "", false
+		}
+		return target.Key(), true
+	}
+	// it may be a post not walked yet
+	if gen, _ := lr.gens.Find(name); gen != nil && (lr.filter == nil || lr.filter.Match(filepath.ToSlash(relPath))) {
+		if fi, err := os.Stat(name); err == nil && fi.Mode().IsRegular() {
+			lp.pending = true
+		}
+	}
+	return "", false
+}
+
+// titleKey gives the key of the post with the title in the repository
+func (lp *localPost) titleKey(title string) (string, bool) {
+	key, found := "", false
+	for _, p := range lp.repo.posts {
+		if p.Poster == nil || !strings.EqualFold(p.Title(), title) {
+			continue
+		}
+		if !found || p.Key() < key {
+			key, found = p.Key(), true
+		}
+	}
+	if !found && lp.repo.walking {
+		// it may be a post not walked yet
+		lp.pending = true
+	}
+	return key, found
+}
+
+// GenerateFile generates the post of a file in the local repository at
+// root just as the repository does, without adding it into a storage.
+// The Poster is nil if there isn't a generator for the file, or the
+// file isn't a post.
+func GenerateFile(root, path string) (Poster, error) {
+	lp := newLocalPost(path, nil)
+	if lp == nil {
+		return nil, nil
+	}
+	lp.repo = &localRepo{root: root}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if lp.Poster, err = lp.generate(file); err == errNotPost {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	lp.warnings = missingStatics(lp.Poster, lp.check)
+	return lp, nil
+}
+
+// Implement the Summarizer interface
+func (lp *localPost) Summary() string            { return Summary(lp.Poster) }
+func (lp *localPost) WordCount() int             { return WordCount(lp.Poster) }
+func (lp *localPost) ReadingTime() time.Duration { return ReadingTime(lp.Poster) }
+
+// Implement the Outliner interface
+func (lp *localPost) TOC() []*Heading { return TOC(lp.Poster) }
+
+// Implement the Updater interface
+func (lp *localPost) Updated() time.Time { return Updated(lp.Poster) }
+
+// Implement the Drafter interface
+func (lp *localPost) IsDraft() bool { return IsDraft(lp.Poster) }
+
+// Aliases includes the previous keys of the local post
+func (lp *localPost) Aliases() []string {
+	return mergeAliases(Aliases(lp.Poster), lp.moved)
+}
+
+// Implement the Sourcer interface
+func (lp *localPost) Source() string {
+	return "local:" + lp.path
+}
+
+// Implement the Linker interface
+func (lp *localPost) Links() []string {
+	return links(lp.Poster)
+}
+
+// Implement the Warner interface
+func (lp *localPost) Warnings() []string {
+	return append(append([]string(nil), warnings(lp.Poster)...), lp.warnings...)
+}
+
 // Implement localPost's Static interface
 func (lp *localPost) Static(path string) io.ReadCloser {
-	path = filepath.FromSlash(path)
-	if !filepath.IsAbs(path) {
-		path = filepath.Join(filepath.Dir(lp.path), path)
+	if rc, ok := openEmbedded(lp.Poster, path); ok {
+		return rc
 	}
-	file, err := os.Open(path)
+	if lp.repo != nil && lp.repo.strict && !isListed(lp, path) {
+		return staticError{&os.PathError{Op: "static", Path: path, Err: ErrNotListed}}
+	}
+	return lp.open(path)
+}
+
+// open opens a file relative to the post, absolute paths are relative
+// to the repository's root. Files outside of the root are refused.
+func (lp *localPost) open(path string) io.ReadCloser {
+	root := filepath.Dir(lp.path)
+	if lp.repo != nil {
+		root = lp.repo.root
+	}
+	name := filepath.FromSlash(path)
+	if filepath.IsAbs(name) {
+		name = filepath.Join(root, name)
+	} else {
+		name = filepath.Join(filepath.Dir(lp.path), name)
+	}
+
+	// resolve the symlinks before checking
+	realRoot, err := filepath.EvalSymlinks(root)
 	if err != nil {
-		return StaticErr(fmt.Sprintf("open %q file failed: %s\n",
-			path, err))
+		return staticError{err}
+	}
+	realName, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return staticError{err}
+	}
+	if !isInside(realRoot, realName) {
+		return staticError{&os.PathError{Op: "static", Path: path, Err: ErrOutsideRepo}}
+	}
+
+	file, err := os.Open(realName)
+	if err != nil {
+		return staticError{err}
 	}
 	return file
 }
+
+// check gives the error of opening the file relative to the post
+func (lp *localPost) check(path string) error {
+	rc := lp.open(path)
+	defer rc.Close()
+	if se, ok := rc.(staticError); ok {
+		return se.err
+	}
+	return nil
+}
+
+// isInside reports whether the path is inside of the root directory
+func isInside(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
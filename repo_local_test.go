@@ -3,8 +3,12 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewLocalRepo(t *testing.T) {
@@ -57,24 +61,24 @@ func TestLocalRepoRefresh(t *testing.T) {
 		"update": {
 			prepare: map[string]*localPost{},
 			expect: map[string]*localPost{
-				"1.md":      newLocalPost(filepath.Join("./testdata/localRepo/", "1.md")),
-				"1.article": newLocalPost(filepath.Join("./testdata/localRepo/", "1.article")),
-				"1.slide":   newLocalPost(filepath.Join("./testdata/localRepo/", "1.slide")),
-				"level1" + string(filepath.Separator) + "1.md": newLocalPost(filepath.Join("./testdata/localRepo/", "level1/1.md")),
+				"1.md":      newLocalPost(filepath.Join("./testdata/localRepo/", "1.md"), nil),
+				"1.article": newLocalPost(filepath.Join("./testdata/localRepo/", "1.article"), nil),
+				"1.slide":   newLocalPost(filepath.Join("./testdata/localRepo/", "1.slide"), nil),
+				"level1" + string(filepath.Separator) + "1.md": newLocalPost(filepath.Join("./testdata/localRepo/", "level1/1.md"), nil),
 			},
 		},
 
 		"clean": {
 			prepare: map[string]*localPost{
-				"1.md":              newLocalPost(filepath.Join("./testdata/localRepo/", "1.md")),
-				"noexist.md":        newLocalPost(filepath.Join("./testdata/localRepo/", "noexist.md")),
-				"level1/noexist.md": newLocalPost(filepath.Join("./testdata/localRepo/", "level1/noexist.md")),
+				"1.md":              newLocalPost(filepath.Join("./testdata/localRepo/", "1.md"), nil),
+				"noexist.md":        newLocalPost(filepath.Join("./testdata/localRepo/", "noexist.md"), nil),
+				"level1/noexist.md": newLocalPost(filepath.Join("./testdata/localRepo/", "level1/noexist.md"), nil),
 			},
 			expect: map[string]*localPost{
-				"1.md":      newLocalPost(filepath.Join("./testdata/localRepo/", "1.md")),
-				"1.article": newLocalPost(filepath.Join("./testdata/localRepo/", "1.article")),
-				"1.slide":   newLocalPost(filepath.Join("./testdata/localRepo/", "1.slide")),
-				"level1" + string(filepath.Separator) + "1.md": newLocalPost(filepath.Join("./testdata/localRepo/", "level1/1.md")),
+				"1.md":      newLocalPost(filepath.Join("./testdata/localRepo/", "1.md"), nil),
+				"1.article": newLocalPost(filepath.Join("./testdata/localRepo/", "1.article"), nil),
+				"1.slide":   newLocalPost(filepath.Join("./testdata/localRepo/", "1.slide"), nil),
+				"level1" + string(filepath.Separator) + "1.md": newLocalPost(filepath.Join("./testdata/localRepo/", "level1/1.md"), nil),
 			},
 		},
 	} {
@@ -89,6 +93,114 @@ func TestLocalRepoRefresh(t *testing.T) {
 	}
 }
 
+func TestLocalRepoFilter(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(name, content string) {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a.md", "a.md~", ".git/b.md", "node_modules/c/README.md", "drafts/d.md", "posts/e.md"} {
+		write(name, "title | 2012-12-01 | \nhi\n")
+	}
+	write(IgnoreFile, "node_modules/\n")
+
+	repo, err := newLocalRepo(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr := repo.(*localRepo)
+	if err = lr.Configure(&Config{Exclude: []string{"*~", "/drafts/"}}); err != nil {
+		t.Fatal(err)
+	}
+	lr.Refresh(&nopStorage{})
+	expect := map[string]*localPost{
+		"a.md":                         {path: filepath.Join(root, "a.md")},
+		filepath.Join("posts", "e.md"): {path: filepath.Join(root, "posts", "e.md")},
+	}
+	if err := checkLocalPosts(expect, lr.posts); err != nil {
+		t.Error(err)
+	}
+
+	// the excluded posts are removed
+	write(IgnoreFile, "node_modules/\nposts/\n")
+	lr.Refresh(&nopStorage{})
+	delete(expect, filepath.Join("posts", "e.md"))
+	if err := checkLocalPosts(expect, lr.posts); err != nil {
+		t.Error(err)
+	}
+
+	if err = lr.Configure(&Config{Include: []string{"[a"}}); err == nil {
+		t.Error("expect an error for an invalid pattern\n")
+	}
+}
+
+func TestLocalRepoGenerators(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a.md", "b.txt", "c.html", "notes"} {
+		write(name, "title "+name+" | 2012-12-01 | \nhi\n")
+	}
+	write("LICENSE", "Copyright (c) 2012\n")
+
+	repo, err := newLocalRepo(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr := repo.(*localRepo)
+	if err = lr.Configure(&Config{
+		Generators: map[string]string{".txt": "markdown", ".html": ""},
+		Sniff:      true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	lr.Refresh(&nopStorage{})
+	expect := map[string]*localPost{
+		"a.md":  {path: filepath.Join(root, "a.md")},
+		"b.txt": {path: filepath.Join(root, "b.txt")},
+		"notes": {path: filepath.Join(root, "notes")},
+	}
+	if err := checkLocalPosts(expect, lr.posts); err != nil {
+		t.Error(err)
+	}
+
+	// the sniffed files are checked again once modified
+	write("LICENSE", "license | 2012-12-01 | \nhi\n")
+	write("notes", "just notes\n")
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{"LICENSE", "notes"} {
+		if err := os.Chtimes(filepath.Join(root, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lr.Refresh(&nopStorage{})
+	delete(expect, "notes")
+	expect["LICENSE"] = &localPost{path: filepath.Join(root, "LICENSE")}
+	if err := checkLocalPosts(expect, lr.posts); err != nil {
+		t.Error(err)
+	}
+
+	if err = lr.Configure(&Config{Generators: map[string]string{".txt": "noexist"}}); err == nil {
+		t.Error("expect an error for an unknown generator\n")
+	}
+}
+
 func checkLocalPosts(expect, real map[string]*localPost) error {
 	if len(real) != len(expect) {
 		return fmt.Errorf("length of posts isn't equal: expect %v but get %v\n",
@@ -105,3 +217,244 @@ func checkLocalPosts(expect, real map[string]*localPost) error {
 	}
 	return nil
 }
+
+func TestLocalPostStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "repo")
+	for _, d := range []string{root, filepath.Join(root, "level1")} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{
+		filepath.Join(dir, "secret"):             "secret",
+		filepath.Join(root, "a.png"):             "a",
+		filepath.Join(root, "level1", "b.png"):   "b",
+		filepath.Join(root, "level1", "post.md"): "post | 2012-12-01 | \n![b](b.png)\n",
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := newLocalRepo(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr := repo.(*localRepo)
+	lr.Refresh(&nopStorage{})
+	lp := lr.posts[filepath.Join("level1", "post.md")]
+	if lp == nil {
+		t.Fatal("can't find the post")
+	}
+
+	for name, c := range map[string]struct {
+		path      string
+		strict    bool
+		expect    string
+		expectErr error
+	}{
+		"relative": {
+			path:   "b.png",
+			expect: "b",
+		},
+		"parent": {
+			path:   "../a.png",
+			expect: "a",
+		},
+		"absolute": {
+			path:   "/a.png",
+			expect: "a",
+		},
+		"escape": {
+			path:      "../../secret",
+			expectErr: ErrOutsideRepo,
+		},
+		"absoluteEscape": {
+			path:      "/../secret",
+			expectErr: ErrOutsideRepo,
+		},
+		"symlinkEscape": {
+			path:      "../link",
+			expectErr: ErrOutsideRepo,
+		},
+		"strictListed": {
+			path:   "b.png",
+			strict: true,
+			expect: "b",
+		},
+		"strictNotListed": {
+			path:      "../a.png",
+			strict:    true,
+			expectErr: ErrNotListed,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			lr.strict = c.strict
+			rc := lp.Static(c.path)
+			defer rc.Close()
+			got, err := ioutil.ReadAll(rc)
+			if e := matchError(c.expectErr, err); e != nil {
+				t.Fatal(e)
+			}
+			if c.expectErr == ErrOutsideRepo || c.expectErr == ErrNotListed {
+				if !errors.Is(err, c.expectErr) {
+					t.Errorf("got error %v, but want %v\n", err, c.expectErr)
+				}
+			}
+			if string(got) != c.expect {
+				t.Errorf("got %q, but want %q\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestLocalPostMoved(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, "post.md")
+	write := func(content string, mtime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New("./testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := newLocalRepo(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour)
+	write("old title | 2012-12-01 | \nhi\n", mtime)
+	repo.Refresh(s)
+	write("new title | 2012-12-01 | \nhi\n", mtime.Add(time.Minute))
+	repo.Refresh(s)
+
+	r, err := s.Get(StringKey("old_title"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Content[0].Key(); got != "new_title" {
+		t.Errorf("got key %q, but want %q\n", got, "new_title")
+	}
+	if got := r.Moved["old_title"]; got != "new_title" {
+		t.Errorf("got moved %q, but want %q\n", got, "new_title")
+	}
+
+	// move back
+	write("old title | 2012-12-01 | \nhi\n", mtime.Add(2*time.Minute))
+	repo.Refresh(s)
+	r, err = s.Get(StringKey("new_title"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Aliases(r.Content[0]); !reflect.DeepEqual(got, []string{"new_title"}) {
+		t.Errorf("got aliases %v, but want %v\n", got, []string{"new_title"})
+	}
+}
+
+func TestGenerateFile(t *testing.T) {
+	p, err := GenerateFile("./testdata/localRepo", "./testdata/localRepo/level1/1.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Key() != "hello" {
+		t.Errorf("got key %q, but want %q\n", p.Key(), "hello")
+	}
+	// relative to the post, and the root for the absolute paths
+	for _, path := range []string{"3", "/level1/3"} {
+		r := p.Static(path)
+		_, err = ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Errorf("read static %s: %s\n", path, err)
+		}
+	}
+
+	if p, err = GenerateFile("./testdata/localRepo", "./testdata/localRepo/x.go"); p != nil || err != nil {
+		t.Errorf("got %v, %v, but want no post for an unknown file\n", p, err)
+	}
+	if _, err = GenerateFile("./testdata/localRepo", "./testdata/localRepo/noexist.md"); !os.IsNotExist(err) {
+		t.Errorf("got %v, but want a not exist error\n", err)
+	}
+}
+
+func TestLocalRepoPostLinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err = os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"a.md":     "first | 2012-12-01 | \n[second](sub/b.md#top) [pdf](doc.pdf)\n",
+		"sub/b.md": "second | 2012-12-02 | \n[first](../a.md) [code](/x.go) [[Second]]\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo, err := newLocalRepo(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr := repo.(*localRepo)
+	if err = lr.Configure(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	lr.Refresh(&nopStorage{})
+	for name, c := range map[string]struct {
+		content  string
+		statics  []string
+		links    []string
+		warnings []string
+	}{
+		"a.md": {
+			content:  "<p><a href=\"/posts/second#top\">second</a> <a href=\"/images/first/doc.pdf\">pdf</a></p>\n",
+			statics:  []string{"/images/first/doc.pdf"},
+			links:    []string{"second"},
+			warnings: []string{"static resource: lstat " + filepath.Join(root, "doc.pdf") + ": no such file or directory"},
+		},
+		filepath.Join("sub", "b.md"): {
+			content: "<p><a href=\"/posts/first\">first</a> <a href=\"/x.go\">code</a> <a href=\"/posts/second\">Second</a></p>\n",
+			links:   []string{"first", "second"},
+		},
+	} {
+		p := lr.posts[name]
+		if p == nil || p.Poster == nil {
+			t.Fatalf("%s isn't generated\n", name)
+		}
+		if got := p.Content(); got != c.content {
+			t.Errorf("%s: got content %q, but want %q\n", name, got, c.content)
+		}
+		if got := p.StaticList(); !reflect.DeepEqual(got, c.statics) {
+			t.Errorf("%s: got statics %q, but want %q\n", name, got, c.statics)
+		}
+		if got := p.Links(); !reflect.DeepEqual(got, c.links) {
+			t.Errorf("%s: got links %q, but want %q\n", name, got, c.links)
+		}
+		if got := p.Warnings(); !reflect.DeepEqual(got, c.warnings) {
+			t.Errorf("%s: got warnings %q, but want %q\n", name, got, c.warnings)
+		}
+	}
+}
@@ -0,0 +1,577 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	RegisterNamedGenerator("rst", 0, rstGenerator{})
+}
+
+// rstGenerator generates the posts written in reStructuredText. The
+// title is the one of the first section, followed by the docinfo field
+// list giving the date and tags, like ":date: 2006-01-02" and
+// ":tags: go, web", and the optional attributes, like ":draft: true".
+type rstGenerator struct{}
+
+func (rstGenerator) Match(filename string) bool {
+	return strings.HasSuffix(filename, ".rst")
+}
+
+var (
+	rstField     = regexp.MustCompile(`^:([^:\s][^:]*):(?:\s+(.*?))?\s*$`)
+	rstDirective = regexp.MustCompile(`^\.\.\s+([\w-]+)::(?:\s+(.*?))?\s*$`)
+	rstTarget    = regexp.MustCompile("^\\.\\.\\s+_(`[^`]+`|[^:]+):\\s*(.*?)\\s*$")
+	rstItem      = regexp.MustCompile(`^(?:([-*+•])|(\d+|#)[.)]|\((\d+|#)\))(?:\s+|$)`)
+	rstRole      = regexp.MustCompile("^:([\\w-]+):`")
+	rstURL       = regexp.MustCompile(`^(?:(?:https?|ftp)://|mailto:)[^\s<>]+`)
+	rstSimpleRef = regexp.MustCompile(`^([A-Za-z0-9]+(?:[-.+][A-Za-z0-9]+)*)_`)
+	rstEmbedded  = regexp.MustCompile(`(?s)^(.*?)\s*<([^<>]+)>$`)
+)
+
+// Sniff recognizes the document title followed by the docinfo
+func (rstGenerator) Sniff(head []byte) bool {
+	r := &rstParser{lines: strings.Split(string(head), "\n")}
+	return r.header(&meta{}) == nil
+}
+
+func (rstGenerator) Generate(input io.Reader, s Staticer) (Poster, error) {
+	c, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.Replace(string(c), "\r\n", "\n", -1), "\n")
+	r := &rstParser{lines: lines, targets: make(map[string]string)}
+	for _, line := range lines {
+		if sm := rstTarget.FindStringSubmatch(line); sm != nil {
+			r.targets[refName(strings.Trim(sm[1], "`"))] = sm[2]
+		}
+	}
+
+	var m meta
+	if err := r.header(&m); err != nil {
+		return nil, err
+	}
+	m.key = generateKey(m.title, m.slug, s)
+	r.key, r.s = m.key, s
+	r.parse()
+	r.fill(&m)
+	return newPost(m), nil
+}
+
+// rstParser parses the body of a reStructuredText document line by line
+type rstParser struct {
+	markup
+	lines   []string
+	i       int               // the current line
+	targets map[string]string // the urls of the hyperlink targets
+	styles  []string          // the section adornments by level
+}
+
+// header parses the document title and the docinfo field list
+func (r *rstParser) header(m *meta) error {
+	// the comments and targets may be before the title
+	for r.i < len(r.lines) {
+		if line := r.lines[r.i]; strings.TrimSpace(line) == "" {
+			r.i++
+		} else if strings.HasPrefix(line, "..") && !isAdornment(line) {
+			r.block()
+		} else {
+			break
+		}
+	}
+	title, style, next, ok := r.section()
+	if !ok {
+		return &LineError{1, errors.New("rst: can't find the document title\n")}
+	}
+	m.title = htmlText(r.inline(title))
+	r.styles = append(r.styles, style)
+	r.i = next
+	for r.i < len(r.lines) && strings.TrimSpace(r.lines[r.i]) == "" {
+		r.i++
+	}
+
+	hasDate := false
+	for r.i < len(r.lines) {
+		sm := rstField.FindStringSubmatch(r.lines[r.i])
+		if sm == nil {
+			break
+		}
+		lineNum := r.i + 1
+		// the value may be continued by the indented lines
+		value := []string{sm[2]}
+		for r.i++; r.i < len(r.lines) && r.indent(r.lines[r.i]) > 0; r.i++ {
+			value = append(value, strings.TrimSpace(r.lines[r.i]))
+		}
+		name, v := strings.ToLower(sm[1]), strings.TrimSpace(strings.Join(value, " "))
+		switch {
+		case name == "date":
+			d, err := parseDate(v)
+			if err != nil {
+				return &LineError{lineNum, err}
+			}
+			m.date, hasDate = d, true
+		case name == "tags":
+			for _, tag := range strings.Split(v, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					m.tags = append(m.tags, tag)
+				}
+			}
+		case knownAttrs[name]:
+			if err := m.applyAttr(name, v); err != nil {
+				return &LineError{lineNum, err}
+			}
+		}
+	}
+	if !hasDate {
+		return &LineError{1, errors.New("rst: can't find the :date: field\n")}
+	}
+	return nil
+}
+
+func (r *rstParser) parse() {
+	for r.i < len(r.lines) {
+		line := r.lines[r.i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			r.i++
+			continue
+		}
+		if title, style, next, ok := r.section(); ok {
+			r.heading(r.level(style), r.inline(title))
+			r.i = next
+			continue
+		}
+		switch {
+		case r.indent(line) > 0:
+			r.out.WriteString("<blockquote>\n")
+			r.out.WriteString(r.render(unindent(r.indented(r.i))))
+			r.out.WriteString("</blockquote>\n")
+		case strings.HasPrefix(line, ".."):
+			r.explicit()
+		case isAdornment(trimmed) && len(trimmed) >= 4:
+			r.out.WriteString("<hr />\n")
+			r.i++
+		case rstItem.MatchString(line):
+			r.list()
+		default:
+			r.paragraph()
+		}
+	}
+}
+
+// render gives the html of the nested lines, the images, links, toc and
+// styles are shared
+func (r *rstParser) render(lines []string) string {
+	sub := &rstParser{lines: lines, targets: r.targets, styles: r.styles}
+	sub.key, sub.s, sub.images, sub.links, sub.toc = r.key, r.s, r.images, r.links, r.toc
+	sub.parse()
+	r.images, r.links, r.toc, r.styles = sub.images, sub.links, sub.toc, sub.styles
+	return sub.out.String()
+}
+
+// isAdornment reports whether the line is made of a same punctuation
+// character, like "=====", but not "::"
+func isAdornment(line string) bool {
+	line = strings.TrimRight(line, " \t")
+	if len(line) < 2 || line == "::" || !strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", rune(line[0])) {
+		return false
+	}
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+// section checks whether a section title is at the current line, the
+// style is the adornment character, prefixed with 'o' if overlined
+func (r *rstParser) section() (title, style string, next int, ok bool) {
+	at := func(i int) string {
+		if i < len(r.lines) {
+			return strings.TrimRight(r.lines[i], " \t")
+		}
+		return ""
+	}
+	line := at(r.i)
+	if isAdornment(line) {
+		title, under := strings.TrimSpace(at(r.i+1)), at(r.i+2)
+		if title != "" && under == line && utf8.RuneCountInString(title) <= len(line) {
+			return title, "o" + line[:1], r.i + 3, true
+		}
+		return "", "", 0, false
+	}
+	under := at(r.i + 1)
+	if r.indent(line) == 0 && line != "" && isAdornment(under) &&
+		utf8.RuneCountInString(line) <= len(under) {
+		return line, under[:1], r.i + 2, true
+	}
+	return "", "", 0, false
+}
+
+// level gives the level of the section with the style, the levels are
+// given in the order the styles are seen
+func (r *rstParser) level(style string) int {
+	level := 0
+	for level < len(r.styles) && r.styles[level] != style {
+		level++
+	}
+	if level == len(r.styles) {
+		r.styles = append(r.styles, style)
+	}
+	if level >= 6 {
+		return 6
+	}
+	return level + 1
+}
+
+// indent gives the width of the leading spaces of the line
+func (r *rstParser) indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// indented gives the lines from the start which are indented or blank,
+// the trailing blank lines excluded, and moves after them
+func (r *rstParser) indented(start int) []string {
+	end := start
+	for r.i = start; r.i < len(r.lines); r.i++ {
+		line := r.lines[r.i]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if r.indent(line) == 0 {
+			break
+		}
+		end = r.i + 1
+	}
+	r.i = end
+	return r.lines[start:end]
+}
+
+// block gives the indented block of the explicit markup at the current
+// line, and moves after it
+func (r *rstParser) block() []string {
+	return unindent(r.indented(r.i + 1))
+}
+
+// explicit writes the directive at the current line, the comments and
+// hyperlink targets are skipped
+func (r *rstParser) explicit() {
+	sm := rstDirective.FindStringSubmatch(r.lines[r.i])
+	body := r.block()
+	if sm == nil {
+		return
+	}
+	name, arg := strings.ToLower(sm[1]), sm[2]
+
+	// the options are the leading fields of the body
+	options := make(map[string]string)
+	for len(body) != 0 {
+		om := rstField.FindStringSubmatch(body[0])
+		if om == nil {
+			break
+		}
+		options[strings.ToLower(om[1])] = om[2]
+		body = body[1:]
+	}
+	for len(body) != 0 && strings.TrimSpace(body[0]) == "" {
+		body = body[1:]
+	}
+
+	switch {
+	case name == "code-block" || name == "code" || name == "sourcecode":
+		r.code(arg, strings.Join(body, "\n"))
+	case name == "image" || name == "figure":
+		if arg == "" {
+			return
+		}
+		img := r.img(arg, options["alt"])
+		if target := options["target"]; target != "" {
+			img = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(r.href(target)), img)
+		}
+		fmt.Fprintf(&r.out, "<div class=\"image\">\n%s\n", img)
+		if name == "figure" && len(body) != 0 {
+			fmt.Fprintf(&r.out, "<div class=\"title\">%s</div>\n", strings.TrimSpace(r.render(body)))
+		}
+		r.out.WriteString("</div>\n")
+	case admonitionTitles[name] != "":
+		if arg != "" {
+			body = append([]string{arg, ""}, body...)
+		}
+		fmt.Fprintf(&r.out, "<div class=\"admonition %s\">\n<p class=\"title\">%s</p>\n", name, admonitionTitles[name])
+		r.out.WriteString(r.render(body))
+		r.out.WriteString("</div>\n")
+	case name == "raw":
+		if strings.ToLower(arg) == "html" {
+			r.out.WriteString(strings.Join(body, "\n") + "\n")
+		}
+	}
+}
+
+// list writes the consecutive items of a same kind, the nested blocks
+// of an item are indented
+func (r *rstParser) list() {
+	kind := func(line string) string {
+		sm := rstItem.FindStringSubmatch(line)
+		switch {
+		case sm == nil:
+			return ""
+		case sm[1] != "":
+			return "ul"
+		}
+		return "ol"
+	}
+	tag := kind(r.lines[r.i])
+	fmt.Fprintf(&r.out, "<%s>\n", tag)
+	for r.i < len(r.lines) && kind(r.lines[r.i]) == tag {
+		marker := rstItem.FindString(r.lines[r.i])
+		text := r.lines[r.i][len(marker):]
+		body := append([]string{text}, unindent(r.indented(r.i+1))...)
+		// the first paragraph of a compact item isn't wrapped
+		item := r.render(body)
+		if strings.HasPrefix(item, "<p>") {
+			end := strings.Index(item, "</p>\n")
+			first, rest := item[3:end], item[end+5:]
+			if rest != "" {
+				first += "\n"
+			}
+			item = first + rest
+		}
+		fmt.Fprintf(&r.out, "<li>%s</li>\n", item)
+		for r.i < len(r.lines) && strings.TrimSpace(r.lines[r.i]) == "" {
+			r.i++
+		}
+	}
+	fmt.Fprintf(&r.out, "</%s>\n", tag)
+}
+
+// paragraph writes the lines until a blank line, a paragraph ending
+// with "::" is followed by a literal block
+func (r *rstParser) paragraph() {
+	var text []string
+	for ; r.i < len(r.lines) && strings.TrimSpace(r.lines[r.i]) != ""; r.i++ {
+		text = append(text, strings.TrimSpace(r.lines[r.i]))
+	}
+	p := strings.Join(text, "\n")
+	literal := strings.HasSuffix(p, "::")
+	if literal {
+		switch {
+		case p == "::":
+			p = ""
+		case strings.HasSuffix(p, " ::") || strings.HasSuffix(p, "\n::"):
+			p = strings.TrimRight(p[:len(p)-2], " \n")
+		default:
+			p = p[:len(p)-1]
+		}
+	}
+	if p != "" {
+		fmt.Fprintf(&r.out, "<p>%s</p>\n", r.inline(p))
+	}
+	if !literal {
+		return
+	}
+	next := r.i
+	for next < len(r.lines) && strings.TrimSpace(r.lines[next]) == "" {
+		next++
+	}
+	if next < len(r.lines) && r.indent(r.lines[next]) > 0 {
+		r.code("", strings.Join(unindent(r.indented(next)), "\n"))
+	}
+}
+
+const (
+	rstBefore = " \t\n-:/'\"<([{"
+	rstAfter  = " \t\n-.,:;!?\\/'\")]}>"
+)
+
+// the tags of the interpreted text roles
+var rstRoles = map[string]string{
+	"emphasis":    "em",
+	"strong":      "strong",
+	"literal":     "code",
+	"code":        "code",
+	"subscript":   "sub",
+	"sup":         "sup",
+	"superscript": "sup",
+	"sub":         "sub",
+}
+
+// inline gives the html of the text with the inline markup and links
+func (r *rstParser) inline(s string) string {
+	var b strings.Builder
+	plain := 0 // the start of the plain text not written yet
+	flush := func(i int) {
+		b.WriteString(html.EscapeString(rstUnescape(s[plain:i])))
+	}
+	for i := 0; i < len(s); {
+		if s[i] == '\\' {
+			i += 2
+			continue
+		}
+		if i > 0 && strings.IndexByte(rstBefore, s[i-1]) < 0 {
+			i++
+			continue
+		}
+		rest := s[i:]
+		if sm := rstRole.FindStringSubmatch(rest); sm != nil {
+			start := i + len(sm[0])
+			if end := closeRst(s, start, "`"); end > 0 {
+				flush(i)
+				inner := s[start:end]
+				if tag := rstRoles[strings.ToLower(sm[1])]; tag == "code" {
+					fmt.Fprintf(&b, "<code>%s</code>", html.EscapeString(inner))
+				} else if tag != "" {
+					fmt.Fprintf(&b, "<%s>%s</%s>", tag, html.EscapeString(rstUnescape(inner)), tag)
+				} else {
+					b.WriteString(html.EscapeString(rstUnescape(inner)))
+				}
+				i = end + 1
+				plain = i
+				continue
+			}
+		}
+		if strings.HasPrefix(rest, "``") {
+			if end := closeRst(s, i+2, "``"); end > 0 {
+				flush(i)
+				fmt.Fprintf(&b, "<code>%s</code>", html.EscapeString(s[i+2:end]))
+				i = end + 2
+				plain = i
+				continue
+			}
+		}
+		if rest[0] == '*' {
+			mark, tag := "*", "em"
+			if strings.HasPrefix(rest, "**") {
+				mark, tag = "**", "strong"
+			}
+			if end := closeRst(s, i+len(mark), mark); end > 0 {
+				flush(i)
+				fmt.Fprintf(&b, "<%s>%s</%s>", tag, html.EscapeString(rstUnescape(s[i+len(mark):end])), tag)
+				i = end + len(mark)
+				plain = i
+				continue
+			}
+		}
+		if rest[0] == '`' {
+			if end, next := closeInterpreted(s, i+1); end > 0 {
+				flush(i)
+				inner := s[i+1 : end]
+				if next-end > 1 {
+					b.WriteString(r.reference(inner))
+				} else {
+					fmt.Fprintf(&b, "<cite>%s</cite>", html.EscapeString(rstUnescape(inner)))
+				}
+				i = next
+				plain = i
+				continue
+			}
+		}
+		if url := rstURL.FindString(rest); url != "" {
+			flush(i)
+			// the trailing punctuation isn't a part of the url
+			url = strings.TrimRight(url, ".,;:!?)")
+			fmt.Fprintf(&b, "<a href=\"%s\">%s</a>", html.EscapeString(url), html.EscapeString(url))
+			i += len(url)
+			plain = i
+			continue
+		}
+		if sm := rstSimpleRef.FindStringSubmatch(rest); sm != nil {
+			next := i + len(sm[0])
+			if target, ok := r.targets[refName(sm[1])]; ok && (next == len(s) || strings.IndexByte(rstAfter, s[next]) >= 0) {
+				flush(i)
+				fmt.Fprintf(&b, "<a href=\"%s\">%s</a>", html.EscapeString(r.href(target)), html.EscapeString(sm[1]))
+				i = next
+				plain = i
+				continue
+			}
+		}
+		i++
+	}
+	if plain < len(s) {
+		flush(len(s))
+	}
+	return b.String()
+}
+
+// closeRst gives the index of the end string closing the inline markup
+// started before start, or -1
+func closeRst(s string, start int, end string) int {
+	if start >= len(s) || isSpace(s[start]) {
+		return -1
+	}
+	for j := start + 1; j+len(end) <= len(s); j++ {
+		if s[j-1] == '\\' && end != "``" {
+			continue
+		}
+		if strings.HasPrefix(s[j:], end) && !isSpace(s[j-1]) &&
+			(j+len(end) == len(s) || strings.IndexByte(rstAfter, s[j+len(end)]) >= 0) {
+			return j
+		}
+	}
+	return -1
+}
+
+// closeInterpreted gives the index of the '`' closing the interpreted
+// text or reference started before start, and the index after the end
+// string, which is longer for a reference like "`text`_", or -1
+func closeInterpreted(s string, start int) (int, int) {
+	if start >= len(s) || isSpace(s[start]) {
+		return -1, -1
+	}
+	for j := start + 1; j < len(s); j++ {
+		if s[j] != '`' || s[j-1] == '\\' || isSpace(s[j-1]) {
+			continue
+		}
+		next := j + 1
+		if strings.HasPrefix(s[next:], "__") {
+			next += 2
+		} else if strings.HasPrefix(s[next:], "_") {
+			next++
+		}
+		if next == len(s) || strings.IndexByte(rstAfter, s[next]) >= 0 {
+			return j, next
+		}
+	}
+	return -1, -1
+}
+
+// reference gives the html of a reference like "`text <url>`_", or
+// "`name`_" to a hyperlink target or a section
+func (r *rstParser) reference(s string) string {
+	text, target := rstUnescape(s), ""
+	if sm := rstEmbedded.FindStringSubmatch(s); sm != nil {
+		text, target = rstUnescape(sm[1]), sm[2]
+		if text == "" {
+			text = target
+		}
+	} else if t, ok := r.targets[refName(text)]; ok {
+		target = t
+	} else {
+		target = "#" + slugify(text)
+	}
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(r.href(target)), html.EscapeString(text))
+}
+
+// refName normalizes a reference name, which is case insensitive and
+// whitespace neutral
+func refName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// rstUnescape removes the backslashes escaping the characters
+func rstUnescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
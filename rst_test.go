@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRSTMatch(t *testing.T) {
+	for name, c := range map[string]struct {
+		path   string
+		expect bool
+	}{
+		"match": {
+			path:   "a/b/c.rst",
+			expect: true,
+		},
+		"unmatch": {
+			path:   "a/b/c.rst.txt",
+			expect: false,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := (rstGenerator{}).Match(c.path); got != c.expect {
+				t.Errorf("got %v, but want %v\n", got, c.expect)
+			}
+		})
+	}
+}
+
+func TestRSTGenerate(t *testing.T) {
+	const head = "t\n==\n\n:date: 2012-12-01\n\n"
+	for name, c := range map[string]struct {
+		input        string
+		expectErr    error
+		expectResult Poster
+	}{
+		"normal": {
+			input: ".. a comment\n\n=============\n hello world\n=============\n\n:date: 2012-12-01\n:tags: tag1, tag2\n:author: me\n\n" +
+				"Title *hello*\n-------------\n\nSub\n~~~\n\nOther\n-----\n",
+			expectResult: newPost(meta{
+				key:     "hello_world",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				tags:    []string{"tag1", "tag2"},
+				content: "<h2 id=\"title-hello\">Title <em>hello</em></h2>\n<h3 id=\"sub\">Sub</h3>\n<h2 id=\"other\">Other</h2>\n",
+				toc: []*Heading{
+					{Level: 2, Title: "Title hello", Anchor: "title-hello", Children: []*Heading{
+						{Level: 3, Title: "Sub", Anchor: "sub"},
+					}},
+					{Level: 2, Title: "Other", Anchor: "other"},
+				},
+			}),
+		},
+		"attributes": {
+			input: "hello world\n###########\n:date: 2012-12-01\n:draft: true\n:slug: Hello Go\n:updated:\n  2013-01-02\n",
+			expectResult: newPost(meta{
+				key:     "Hello_Go",
+				title:   "hello world",
+				date:    parseTime("2012-12-01"),
+				updated: parseTime("2013-01-02"),
+				draft:   true,
+			}),
+		},
+		"inline": {
+			input: head + "*em*, **strong**, ``a<b``, `cite`, :code:`x`, a*b*c, \\*not\\*\n" +
+				"`Go <https://go.dev>`_, Python_, `Other`_ and https://x.org.\n\n.. _python: https://python.org\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<p><em>em</em>, <strong>strong</strong>, <code>a&lt;b</code>, <cite>cite</cite>, <code>x</code>, a*b*c, *not*\n" +
+					"<a href=\"https://go.dev\">Go</a>, <a href=\"https://python.org\">Python</a>, <a href=\"#other\">Other</a> and <a href=\"https://x.org\">https://x.org</a>.</p>\n",
+			}),
+		},
+		"lists": {
+			input: head + "- one\n- two\n\n  #. a\n  #. b\n\n- three\n  more\n\n1) first\n2) second\n\nafter\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<ul>\n<li>one</li>\n<li>two\n<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n</li>\n<li>three\nmore</li>\n</ul>\n" +
+					"<ol>\n<li>first</li>\n<li>second</li>\n</ol>\n<p>after</p>\n",
+			}),
+		},
+		"blocks": {
+			input: head + "Example::\n\n    x < 1\n\n.. code-block:: go\n   :linenos:\n\n   x := 1\n\n----\n\n  quoted\n\n.. note:: be *careful*\n\n.. unknown::\n\n   ignored\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<p>Example:</p>\n<div class=\"code\">\n<pre><code>x &lt; 1\n</code></pre>\n</div>\n" +
+					"<div class=\"code\">\n<pre class=\"numbers\"><code class=\"language-go\"><span num=\"1\">x := <span class=\"num\">1</span></span>\n</code></pre>\n</div>\n" +
+					"<hr />\n<blockquote>\n<p>quoted</p>\n</blockquote>\n" +
+					"<div class=\"admonition note\">\n<p class=\"title\">Note</p>\n<p>be <em>careful</em></p>\n</div>\n",
+			}),
+		},
+		"images": {
+			input: head + ".. image:: 1.png\n   :alt: One\n\n.. image:: http://x/2.png\n   :target: /a\n\n.. figure:: 3.png\n\n   The *caption*\n",
+			expectResult: newPost(meta{
+				key:   "t",
+				title: "t",
+				date:  parseTime("2012-12-01"),
+				content: "<div class=\"image\">\n<img src=\"/images/t/1.png\" alt=\"One\" />\n</div>\n" +
+					"<div class=\"image\">\n<a href=\"/a\"><img src=\"http://x/2.png\" alt=\"\" /></a>\n</div>\n" +
+					"<div class=\"image\">\n<img src=\"/images/t/3.png\" alt=\"\" />\n<div class=\"title\"><p>The <em>caption</em></p></div>\n</div>\n",
+				staticList: []string{"/images/t/1.png", "/images/t/3.png"},
+			}),
+		},
+		"noTitle": {
+			input:     ":date: 2012-12-01\n",
+			expectErr: errors.New("line 1: rst: can't find the document title"),
+		},
+		"noDate": {
+			input:     "t\n==\n:tags: a\n",
+			expectErr: errors.New("line 1: rst: can't find the :date: field"),
+		},
+		"invalidDate": {
+			input:     "t\n==\n\n:date: someday\n",
+			expectErr: errors.New("line 4: invalid date \"someday\""),
+		},
+		"invalidDraft": {
+			input:     "t\n==\n:date: 2012-12-01\n:draft: maybe\n",
+			expectErr: errors.New("line 4: invalid draft attribute"),
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, err := rstGenerator{}.Generate(strings.NewReader(c.input), nil)
+			if err = matchError(c.expectErr, err); err != nil {
+				t.Error(err)
+			}
+			if c.expectResult != nil && !isPosterEqual(got, c.expectResult) {
+				t.Errorf("\n\tgot result: %#v,\n\tbut want %#v\n", got, c.expectResult)
+			}
+		})
+	}
+}
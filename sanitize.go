@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// Trust levels of a repository, see Config.Trust
+const (
+	// TrustFull leaves the posts' html as it is
+	TrustFull = "full"
+	// TrustNone sanitizes the posts' html with DefaultPolicy
+	TrustNone = "none"
+)
+
+// Policy is an allowlist of the html a post may contain, anything else
+// is stripped by the sanitizer.
+type Policy struct {
+	// Elements maps the allowed elements to their allowed attributes.
+	// The contents of the disallowed elements are kept as text, except
+	// for script and style whose contents are dropped.
+	Elements map[string][]string
+	// Attributes are allowed on all the allowed elements
+	Attributes []string
+	// URLAttributes are the attributes containing an url
+	URLAttributes []string
+	// Schemes are the allowed schemes of the absolute urls, the relative
+	// ones are always allowed
+	Schemes []string
+}
+
+// DefaultPolicy allows the common formatting elements and the ones
+// given by the generators, without any script or inline style.
+var DefaultPolicy = &Policy{
+	Elements: map[string][]string{
+		"a":          {"href", "target", "rel", "name"},
+		"abbr":       nil,
+		"article":    nil,
+		"audio":      {"src", "controls", "loop", "muted", "preload"},
+		"b":          nil,
+		"blockquote": {"cite"},
+		"br":         nil,
+		"caption":    nil,
+		"cite":       nil,
+		"code":       nil,
+		"col":        {"span"},
+		"colgroup":   {"span"},
+		"dd":         nil,
+		"del":        {"cite", "datetime"},
+		"details":    {"open"},
+		"div":        nil,
+		"dl":         nil,
+		"dt":         nil,
+		"em":         nil,
+		"figcaption": nil,
+		"figure":     nil,
+		"h1":         nil,
+		"h2":         nil,
+		"h3":         nil,
+		"h4":         nil,
+		"h5":         nil,
+		"h6":         nil,
+		"hr":         nil,
+		"i":          nil,
+		"iframe": {"src", "width", "height", "frameborder", "allowfullscreen",
+			"mozallowfullscreen", "webkitallowfullscreen"},
+		"img":     {"src", "alt", "width", "height"},
+		"ins":     {"cite", "datetime"},
+		"kbd":     nil,
+		"li":      {"value"},
+		"mark":    nil,
+		"ol":      {"start", "type"},
+		"p":       nil,
+		"pre":     nil,
+		"q":       {"cite"},
+		"s":       nil,
+		"samp":    nil,
+		"section": nil,
+		"small":   nil,
+		"source":  {"src", "type"},
+		"span":    nil,
+		"strike":  nil,
+		"strong":  nil,
+		"sub":     nil,
+		"summary": nil,
+		"sup":     nil,
+		"table":   nil,
+		"tbody":   nil,
+		"td":      {"colspan", "rowspan", "align"},
+		"tfoot":   nil,
+		"th":      {"colspan", "rowspan", "align", "scope"},
+		"thead":   nil,
+		"time":    {"datetime"},
+		"tr":      nil,
+		"u":       nil,
+		"ul":      nil,
+		"var":     nil,
+		"video":   {"src", "controls", "loop", "muted", "poster", "preload", "width", "height"},
+	},
+	Attributes:    []string{"id", "class", "title", "lang", "dir", "num", "spellcheck"},
+	URLAttributes: []string{"href", "src", "cite", "poster"},
+	Schemes:       []string{"http", "https", "mailto"},
+}
+
+var policies = map[string]*Policy{
+	TrustNone: DefaultPolicy,
+}
+
+// RegisterPolicy registers a policy as a trust level, which can be used
+// in the config. If there is one, just update it.
+func RegisterPolicy(trust string, p *Policy) {
+	policies[trust] = p
+}
+
+// findPolicy gives the policy of a trust level, nil for TrustFull which
+// is also the default
+func findPolicy(trust string) (*Policy, bool) {
+	if trust == TrustFull || trust == "" {
+		return nil, true
+	}
+	p, found := policies[trust]
+	return p, found
+}
+
+func set(l []string) map[string]bool {
+	m := make(map[string]bool, len(l))
+	for _, s := range l {
+		m[s] = true
+	}
+	return m
+}
+
+// Sanitize strips anything not allowed by the policy from the html
+func (p *Policy) Sanitize(s string) string {
+	attrs, urlAttrs, schemes := set(p.Attributes), set(p.URLAttributes), set(p.Schemes)
+	var b strings.Builder
+	skip := "" // the disallowed script or style being skipped
+	for _, t := range tokenizeHTML(s) {
+		if skip != "" {
+			if t.kind == endTagToken && t.name == skip {
+				skip = ""
+			}
+			continue
+		}
+		switch t.kind {
+		case textToken:
+			b.WriteString(strings.Replace(t.raw, "<", "&lt;", -1))
+		case startTagToken, selfClosingTagToken:
+			allowed, ok := p.Elements[t.name]
+			if !ok {
+				if t.kind == startTagToken && (t.name == "script" || t.name == "style") {
+					skip = t.name
+				}
+				continue
+			}
+			elemAttrs := set(allowed)
+			var kept []htmlAttr
+			for _, a := range t.attrs() {
+				if !attrs[a.name] && !elemAttrs[a.name] {
+					continue
+				}
+				if urlAttrs[a.name] && !isSafeURL(a.value, schemes) {
+					continue
+				}
+				if a.name == "style" && !isSafeStyle(a.value) {
+					continue
+				}
+				kept = append(kept, a)
+			}
+			b.WriteString(buildTag(t.name, kept, strings.HasSuffix(t.raw, "/>")))
+		case endTagToken:
+			if _, ok := p.Elements[t.name]; ok {
+				b.WriteString("</" + t.name + ">")
+			}
+		}
+	}
+	return b.String()
+}
+
+// isSafeURL reports whether the url is relative or in one of the schemes
+func isSafeURL(u string, schemes map[string]bool) bool {
+	// browsers ignore the control characters and spaces in a scheme
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true
+	}
+	return schemes[strings.ToLower(u[:i])]
+}
+
+// isSafeStyle reports whether an inline style can't load anything or
+// run scripts, for the policies allowing the style attribute
+func isSafeStyle(s string) bool {
+	s = strings.ToLower(s)
+	for _, bad := range []string{"url(", "expression", "javascript", "\\", "/*", "@import", "behavior", "-moz-binding"} {
+		if strings.Contains(s, bad) {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizedPost is a post whose html has been sanitized
+type sanitizedPost struct {
+	Poster
+	content string
+	summary string
+}
+
+func (sp *sanitizedPost) Content() string            { return sp.content }
+func (sp *sanitizedPost) Summary() string            { return sp.summary }
+func (sp *sanitizedPost) WordCount() int             { return WordCount(sp.Poster) }
+func (sp *sanitizedPost) ReadingTime() time.Duration { return ReadingTime(sp.Poster) }
+func (sp *sanitizedPost) TOC() []*Heading            { return TOC(sp.Poster) }
+func (sp *sanitizedPost) Aliases() []string          { return Aliases(sp.Poster) }
+func (sp *sanitizedPost) Updated() time.Time         { return Updated(sp.Poster) }
+func (sp *sanitizedPost) IsDraft() bool              { return IsDraft(sp.Poster) }
+func (sp *sanitizedPost) Source() string             { return source(sp.Poster) }
+func (sp *sanitizedPost) Links() []string            { return links(sp.Poster) }
+func (sp *sanitizedPost) Warnings() []string         { return warnings(sp.Poster) }
+
+// sanitizer sanitizes the posts before adding them into the storage
+type sanitizer struct {
+	Storager
+	policy *Policy
+}
+
+func (s sanitizer) Add(args ...Poster) error {
+	posts := make([]Poster, len(args))
+	for i, p := range args {
+		posts[i] = &sanitizedPost{
+			Poster:  p,
+			content: s.policy.Sanitize(p.Content()),
+			summary: s.policy.Sanitize(Summary(p)),
+		}
+	}
+	return s.Storager.Add(posts...)
+}
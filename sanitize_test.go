@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	for name, c := range map[string]struct {
+		input  string
+		expect string
+	}{
+		"plain": {
+			input:  "<p>hello <em>world</em> &amp; all</p>",
+			expect: "<p>hello <em>world</em> &amp; all</p>",
+		},
+		"keepAttrs": {
+			input:  `<h1 id="a">t</h1><a href="/x?a=1&amp;b=2" target="_blank">l</a><img src="/images/k/1.png" alt="1" />`,
+			expect: `<h1 id="a">t</h1><a href="/x?a=1&amp;b=2" target="_blank">l</a><img src="/images/k/1.png" alt="1" />`,
+		},
+		"code": {
+			input:  `<pre><span num="1" class="hl"><span class="kw">func</span></span></pre>`,
+			expect: `<pre><span num="1" class="hl"><span class="kw">func</span></span></pre>`,
+		},
+		"script": {
+			input:  "<p>a</p><script>alert(1)</script><p>b</p>",
+			expect: "<p>a</p><p>b</p>",
+		},
+		"scriptUpper": {
+			input:  "<SCRIPT SRC=//x.js></SCRIPT>b",
+			expect: "b",
+		},
+		"nestedScript": {
+			input:  "<scr<script>ipt>alert(1)</script>",
+			expect: "ipt>alert(1)",
+		},
+		"style": {
+			input:  "<style>body{background:url(javascript:alert(1))}</style>x",
+			expect: "x",
+		},
+		"eventHandler": {
+			input:  `<img src=x onerror=alert(1)>`,
+			expect: `<img src="x">`,
+		},
+		"eventHandlerNoSpace": {
+			input:  `<img/src="x"/onerror="alert(1)">`,
+			expect: `<img src="x">`,
+		},
+		"svg": {
+			input:  `<svg onload=alert(1)><circle/></svg>`,
+			expect: ``,
+		},
+		"javascriptURL": {
+			input:  `<a href="javascript:alert(1)">x</a>`,
+			expect: `<a>x</a>`,
+		},
+		"javascriptURLCase": {
+			input:  `<a href="JaVaScRiPt:alert(1)">x</a>`,
+			expect: `<a>x</a>`,
+		},
+		"javascriptURLEntity": {
+			input:  `<a href="java&#x09;script&#58;alert(1)">x</a>`,
+			expect: `<a>x</a>`,
+		},
+		"javascriptURLSpace": {
+			input:  `<a href=" javascript:alert(1)">x</a>`,
+			expect: `<a>x</a>`,
+		},
+		"vbscriptURL": {
+			input:  `<a href='vbscript:msgbox(1)'>x</a>`,
+			expect: `<a>x</a>`,
+		},
+		"dataURL": {
+			input:  `<img src="data:image/svg+xml;base64,PHN2Zz4=">`,
+			expect: `<img>`,
+		},
+		"iframeJavascript": {
+			input:  `<iframe src="javascript:alert(1)" srcdoc="<script>alert(1)</script>"></iframe>`,
+			expect: `<iframe></iframe>`,
+		},
+		"iframe": {
+			input:  `<iframe src="https://example.com" frameborder="0"></iframe>`,
+			expect: `<iframe src="https://example.com" frameborder="0"></iframe>`,
+		},
+		"quoteBreak": {
+			input:  `<a title='x" onclick="alert(1)'>x</a>`,
+			expect: `<a title="x&#34; onclick=&#34;alert(1)">x</a>`,
+		},
+		"styleURL": {
+			input:  `<div style="background:url(javascript:alert(1))">x</div>`,
+			expect: `<div>x</div>`,
+		},
+		"styleExpression": {
+			input:  `<div style="width: expression(alert(1))">x</div>`,
+			expect: `<div>x</div>`,
+		},
+		"styleOverlay": {
+			input:  `<div style="position:fixed;inset:0">x</div>`,
+			expect: `<div>x</div>`,
+		},
+		"contenteditable": {
+			input:  `<div contenteditable="true">x</div>`,
+			expect: `<div>x</div>`,
+		},
+		"comment": {
+			input:  `<!--<script>alert(1)</script>-->x`,
+			expect: `x`,
+		},
+		"unclosedTag": {
+			input:  `<img src=x onerror=alert(1)//`,
+			expect: `<img src="x">`,
+		},
+		"form": {
+			input:  `<form action="/x"><input onfocus=alert(1) autofocus></form>`,
+			expect: ``,
+		},
+		"meta": {
+			input:  `<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+			expect: ``,
+		},
+		"base": {
+			input:  `<base href="http://evil/">x`,
+			expect: `x`,
+		},
+		"object": {
+			input:  `<object data="x.swf"><embed src="x.swf"></object>`,
+			expect: ``,
+		},
+		"bodyOnload": {
+			input:  `<html><body onload="alert(1)"><p>x</p></body></html>`,
+			expect: `<p>x</p>`,
+		},
+		"lessThan": {
+			input:  `a < b <3`,
+			expect: `a &lt; b &lt;3`,
+		},
+		"textarea": {
+			input:  `<textarea><img src=x onerror=alert(1)></textarea>`,
+			expect: `&lt;img src=x onerror=alert(1)>`,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got := DefaultPolicy.Sanitize(c.input)
+			if got != c.expect {
+				t.Errorf("got %q, but want %q\n", got, c.expect)
+			}
+			// whatever the expectation, nothing active is left
+			for _, tok := range tokenizeHTML(got) {
+				if tok.name == "script" {
+					t.Errorf("script is found in %q\n", got)
+				}
+				for _, a := range tok.attrs() {
+					if strings.HasPrefix(a.name, "on") ||
+						strings.Contains(strings.ToLower(a.value), "script:") {
+						t.Errorf("unsafe attribute %q is found in %q\n", a.name, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeStyle(t *testing.T) {
+	p := &Policy{Elements: map[string][]string{"pre": nil}, Attributes: []string{"style"}}
+	for input, expect := range map[string]string{
+		`<pre style="display: none">x</pre>`:               `<pre style="display: none">x</pre>`,
+		`<pre style="background:url(x.png)">x</pre>`:       `<pre>x</pre>`,
+		`<pre style="width: expression(alert(1))">x</pre>`: `<pre>x</pre>`,
+	} {
+		if got := p.Sanitize(input); got != expect {
+			t.Errorf("got %q, but want %q\n", got, expect)
+		}
+	}
+}
+
+func TestFindPolicy(t *testing.T) {
+	for name, c := range map[string]struct {
+		trust  string
+		found  bool
+		expect *Policy
+	}{
+		"default": {
+			found: true,
+		},
+		"none": {
+			trust:  TrustNone,
+			found:  true,
+			expect: DefaultPolicy,
+		},
+		"full": {
+			trust: TrustFull,
+			found: true,
+		},
+		"unknown": {
+			trust: "unknown",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, found := findPolicy(c.trust)
+			if found != c.found || got != c.expect {
+				t.Errorf("got (%v, %v), but want (%v, %v)\n", got, found, c.expect, c.found)
+			}
+		})
+	}
+}
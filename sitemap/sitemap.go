@@ -0,0 +1,262 @@
+// Package sitemap generates the sitemap.xml and robots.txt of the posts
+// in a storage, and keeps them up to date as the posts change.
+//
+// With more than MaxURLs posts, the sitemap is split into several ones,
+// "/sitemap-1.xml", "/sitemap-2.xml" and so on, and "/sitemap.xml" is the
+// sitemap index of them.
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tw4452852/storage"
+	"github.com/tw4452852/storage/handler"
+)
+
+// The url paths served by Sitemap
+const (
+	Path       = "/sitemap.xml"
+	RobotsPath = "/robots.txt"
+)
+
+// MaxURLs is the maximum number of urls in a sitemap, by the protocol
+const MaxURLs = 50000
+
+const (
+	sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	imageNS   = "http://www.google.com/schemas/sitemap-image/1.1"
+)
+
+// now gives the current time, which decides whether a scheduled post
+// is published
+var now = time.Now
+
+// Sitemap is the sitemap of some posts, which is updated by the changes
+// of the posts, e.g.
+//
+//	sm, _ := sitemap.New("https://example.com/")
+//	s.Watch(sm.Update)
+//	http.Handle("/", sm)
+type Sitemap struct {
+	// MaxURLs is the maximum number of urls in a sitemap, MaxURLs if
+	// not positive
+	MaxURLs int
+
+	base *url.URL
+	mu   sync.RWMutex
+	urls map[string]*entry // by the posts' keys
+}
+
+// entry is an url of a post
+type entry struct {
+	post storage.Poster
+	xml  []byte // the <url> element
+}
+
+// New creates an empty sitemap whose urls are relative to the baseURL
+func New(baseURL string) (*Sitemap, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !base.IsAbs() {
+		return nil, errors.New("sitemap: base url must be absolute\n")
+	}
+	return &Sitemap{
+		base: base,
+		urls: make(map[string]*entry),
+	}, nil
+}
+
+// Update updates the url of the changed post
+func (sm *Sitemap) Update(c storage.Change) {
+	var e *entry
+	if c.Post != nil {
+		e = &entry{post: c.Post, xml: sm.urlXML(c.Post)}
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if e == nil {
+		delete(sm.urls, c.Key)
+	} else {
+		sm.urls[c.Key] = e
+	}
+}
+
+// abs resolves the root relative url against the base url
+func (sm *Sitemap) abs(u string) string {
+	ref, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	if strings.HasPrefix(ref.Path, "/") && ref.Host == "" && ref.Scheme == "" {
+		ref.Path = strings.TrimSuffix(sm.base.Path, "/") + ref.Path
+		ref.RawPath = ""
+	}
+	return sm.base.ResolveReference(ref).String()
+}
+
+// urlXML gives the <url> element of a post
+func (sm *Sitemap) urlXML(p storage.Poster) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString("  <url>\n    <loc>")
+	xml.EscapeText(b, []byte(sm.abs(handler.PostURL(p.Key()))))
+	b.WriteString("</loc>\n    <lastmod>")
+	b.WriteString(storage.Updated(p).Format(time.RFC3339))
+	b.WriteString("</lastmod>\n")
+	for _, s := range p.StaticList() {
+		if !strings.HasPrefix(mime.TypeByExtension(path.Ext(s)), "image/") {
+			continue
+		}
+		b.WriteString("    <image:image>\n      <image:loc>")
+		xml.EscapeText(b, []byte(sm.abs(s)))
+		b.WriteString("</image:loc>\n    </image:image>\n")
+	}
+	b.WriteString("  </url>\n")
+	return b.Bytes()
+}
+
+// published gives the urls of the published posts, sorted by the keys
+func (sm *Sitemap) published() []*entry {
+	t := now()
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	keys := make([]string, 0, len(sm.urls))
+	for key, e := range sm.urls {
+		if !storage.IsDraft(e.post) && !e.post.Date().After(t) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	entries := make([]*entry, len(keys))
+	for i, key := range keys {
+		entries[i] = sm.urls[key]
+	}
+	return entries
+}
+
+func (sm *Sitemap) maxURLs() int {
+	if sm.MaxURLs > 0 {
+		return sm.MaxURLs
+	}
+	return MaxURLs
+}
+
+// split splits the urls into the sitemaps
+func (sm *Sitemap) split() [][]*entry {
+	entries := sm.published()
+	var parts [][]*entry
+	for n := sm.maxURLs(); len(entries) > n; entries = entries[n:] {
+		parts = append(parts, entries[:n])
+	}
+	return append(parts, entries)
+}
+
+// partPath gives the path of the i-th (from 1) sitemap
+func partPath(i int) string {
+	return "/sitemap-" + strconv.Itoa(i) + ".xml"
+}
+
+// IsIndex reports whether "/sitemap.xml" is a sitemap index, which is
+// the case with more than MaxURLs posts
+func (sm *Sitemap) IsIndex() bool {
+	return len(sm.split()) > 1
+}
+
+// WriteTo writes "/sitemap.xml"
+func (sm *Sitemap) WriteTo(w io.Writer) (int64, error) {
+	parts := sm.split()
+	if len(parts) == 1 {
+		return writeURLSet(w, parts[0])
+	}
+
+	b := new(bytes.Buffer)
+	b.WriteString(xml.Header)
+	b.WriteString(`<sitemapindex xmlns="` + sitemapNS + `">` + "\n")
+	for i, part := range parts {
+		var lastmod time.Time
+		for _, e := range part {
+			if u := storage.Updated(e.post); u.After(lastmod) {
+				lastmod = u
+			}
+		}
+		b.WriteString("  <sitemap>\n    <loc>")
+		xml.EscapeText(b, []byte(sm.abs(partPath(i+1))))
+		b.WriteString("</loc>\n    <lastmod>")
+		b.WriteString(lastmod.Format(time.RFC3339))
+		b.WriteString("</lastmod>\n  </sitemap>\n")
+	}
+	b.WriteString("</sitemapindex>\n")
+	return b.WriteTo(w)
+}
+
+// WritePart writes the i-th (from 1) sitemap of the index
+func (sm *Sitemap) WritePart(w io.Writer, i int) (int64, error) {
+	parts := sm.split()
+	if len(parts) == 1 || i < 1 || i > len(parts) {
+		return 0, fmt.Errorf("sitemap: no sitemap %d\n", i)
+	}
+	return writeURLSet(w, parts[i-1])
+}
+
+func writeURLSet(w io.Writer, entries []*entry) (int64, error) {
+	b := new(bytes.Buffer)
+	b.WriteString(xml.Header)
+	b.WriteString(`<urlset xmlns="` + sitemapNS + `" xmlns:image="` + imageNS + `">` + "\n")
+	for _, e := range entries {
+		b.Write(e.xml)
+	}
+	b.WriteString("</urlset>\n")
+	return b.WriteTo(w)
+}
+
+// WriteRobots writes a robots.txt allowing everything and pointing to
+// the sitemap
+func (sm *Sitemap) WriteRobots(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "User-agent: *\nAllow: /\n\nSitemap: %s\n", sm.abs(Path))
+	return err
+}
+
+// ServeHTTP serves "/sitemap.xml", the sitemaps in the index and
+// "/robots.txt"
+func (sm *Sitemap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := new(bytes.Buffer)
+	p := r.URL.Path
+	switch {
+	case p == Path:
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		sm.WriteTo(b)
+	case p == RobotsPath:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		sm.WriteRobots(b)
+	case strings.HasPrefix(p, "/sitemap-") && strings.HasSuffix(p, ".xml"):
+		i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(p, "/sitemap-"), ".xml"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err = sm.WritePart(b, i); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b.Bytes()))
+}
@@ -0,0 +1,243 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tw4452852/storage"
+)
+
+type post struct {
+	key     string
+	date    time.Time
+	updated time.Time
+	draft   bool
+	statics []string
+}
+
+func (p *post) Key() string                 { return p.key }
+func (p *post) Title() string               { return p.key }
+func (p *post) Date() time.Time             { return p.date }
+func (p *post) Tags() []string              { return nil }
+func (p *post) Content() string             { return "" }
+func (p *post) IsSlide() bool               { return false }
+func (p *post) IsDraft() bool               { return p.draft }
+func (p *post) Summary() string             { return "" }
+func (p *post) WordCount() int              { return 0 }
+func (p *post) ReadingTime() time.Duration  { return 0 }
+func (p *post) TOC() []*storage.Heading     { return nil }
+func (p *post) Aliases() []string           { return nil }
+func (p *post) StaticList() []string        { return p.statics }
+func (p *post) Static(string) io.ReadCloser { return nil }
+func (p *post) Updated() time.Time {
+	if p.updated.IsZero() {
+		return p.date
+	}
+	return p.updated
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+type urlSet struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc     string   `xml:"loc"`
+		LastMod string   `xml:"lastmod"`
+		Images  []string `xml:"http://www.google.com/schemas/sitemap-image/1.1 image>loc"`
+	} `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"sitemap"`
+}
+
+func newTestSitemap(t *testing.T) (*storage.Storage, *Sitemap) {
+	s, err := storage.New("../testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add(
+		&post{
+			key:     "a",
+			date:    parseTime("2020-01-02"),
+			updated: parseTime("2020-03-04"),
+			statics: []string{"/images/a/1.png", "/images/a/style.css"},
+		},
+		&post{key: "b", date: parseTime("2020-02-03")},
+		&post{key: "draft", date: parseTime("2020-02-03"), draft: true},
+		&post{key: "scheduled", date: parseTime("2020-05-06")},
+	); err != nil {
+		t.Fatal(err)
+	}
+	sm, err := New("https://example.com/blog/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Watch(sm.Update)
+	return s, sm
+}
+
+func TestSitemap(t *testing.T) {
+	defer func(old func() time.Time) { now = old }(now)
+	now = func() time.Time { return parseTime("2020-04-01") }
+
+	s, sm := newTestSitemap(t)
+	b := new(bytes.Buffer)
+	if _, err := sm.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	var doc urlSet
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.XMLName.Space != sitemapNS || doc.XMLName.Local != "urlset" {
+		t.Errorf("expect an urlset, got %v\n", doc.XMLName)
+	}
+	if len(doc.URLs) != 2 {
+		t.Fatalf("expect 2 urls, got %d\n", len(doc.URLs))
+	}
+	a, bu := doc.URLs[0], doc.URLs[1]
+	for _, c := range [][2]string{
+		{a.Loc, "https://example.com/blog/posts/a"},
+		{a.LastMod, "2020-03-04T00:00:00Z"},
+		{bu.Loc, "https://example.com/blog/posts/b"},
+		{bu.LastMod, "2020-02-03T00:00:00Z"},
+	} {
+		if c[0] != c[1] {
+			t.Errorf("expect %q, got %q\n", c[1], c[0])
+		}
+	}
+	if expect := []string{"https://example.com/blog/images/a/1.png"}; !reflect.DeepEqual(a.Images, expect) {
+		t.Errorf("expect images %v, got %v\n", expect, a.Images)
+	}
+
+	// follow the changes
+	if err := s.Remove(storage.StringKey("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(&post{key: "c", date: parseTime("2020-03-01")}); err != nil {
+		t.Fatal(err)
+	}
+	now = func() time.Time { return parseTime("2020-06-01") }
+	b.Reset()
+	if _, err := sm.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	doc = urlSet{}
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var locs []string
+	for _, u := range doc.URLs {
+		locs = append(locs, u.Loc)
+	}
+	expect := []string{
+		"https://example.com/blog/posts/a",
+		"https://example.com/blog/posts/c",
+		"https://example.com/blog/posts/scheduled",
+	}
+	if !reflect.DeepEqual(locs, expect) {
+		t.Errorf("expect %v, got %v\n", expect, locs)
+	}
+}
+
+func TestSitemapIndex(t *testing.T) {
+	defer func(old func() time.Time) { now = old }(now)
+	now = func() time.Time { return parseTime("2020-06-01") }
+
+	_, sm := newTestSitemap(t)
+	sm.MaxURLs = 2
+	if !sm.IsIndex() {
+		t.Fatal("expect a sitemap index\n")
+	}
+
+	b := new(bytes.Buffer)
+	if _, err := sm.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	var index sitemapIndex
+	if err := xml.Unmarshal(b.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.XMLName.Local != "sitemapindex" || len(index.Sitemaps) != 2 {
+		t.Fatalf("expect an index of 2 sitemaps, got %s\n", b)
+	}
+	for i, c := range [][2]string{
+		{"https://example.com/blog/sitemap-1.xml", "2020-03-04T00:00:00Z"},
+		{"https://example.com/blog/sitemap-2.xml", "2020-05-06T00:00:00Z"},
+	} {
+		if got := index.Sitemaps[i]; got.Loc != c[0] || got.LastMod != c[1] {
+			t.Errorf("expect %v, got %v\n", c, got)
+		}
+	}
+
+	for i, expect := range []int{2, 1} {
+		b.Reset()
+		if _, err := sm.WritePart(b, i+1); err != nil {
+			t.Fatal(err)
+		}
+		var doc urlSet
+		if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if len(doc.URLs) != expect {
+			t.Errorf("expect %d urls in sitemap %d, got %d\n", expect, i+1, len(doc.URLs))
+		}
+	}
+	if _, err := sm.WritePart(b, 3); err == nil {
+		t.Error("expect an error for a missing sitemap\n")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	_, sm := newTestSitemap(t)
+	sm.MaxURLs = 1
+	for name, c := range map[string]struct {
+		path   string
+		status int
+		ctype  string
+		body   string
+	}{
+		"index":   {Path, http.StatusOK, "application/xml; charset=utf-8", ""},
+		"part":    {"/sitemap-2.xml", http.StatusOK, "application/xml; charset=utf-8", ""},
+		"noPart":  {"/sitemap-9.xml", http.StatusNotFound, "", ""},
+		"badPart": {"/sitemap-x.xml", http.StatusNotFound, "", ""},
+		"unknown": {"/other", http.StatusNotFound, "", ""},
+		"robots": {RobotsPath, http.StatusOK, "text/plain; charset=utf-8",
+			"User-agent: *\nAllow: /\n\nSitemap: https://example.com/blog/sitemap.xml\n"},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sm.ServeHTTP(w, httptest.NewRequest("GET", c.path, nil))
+			if w.Code != c.status {
+				t.Fatalf("expect status %d, got %d\n", c.status, w.Code)
+			}
+			if c.status != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != c.ctype {
+				t.Errorf("expect content type %q, got %q\n", c.ctype, ct)
+			}
+			if c.body != "" && w.Body.String() != c.body {
+				t.Errorf("expect body %q, got %q\n", c.body, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,10 +1,18 @@
 package storage
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"io/ioutil"
 	"log"
+	"strings"
 )
 
+// StaticErr is a failed static resource, reading it gives the error.
+//
+// Deprecated: the repositories give the errors of the failed static
+// resources themselves, which keep their causes.
 type StaticErr string
 
 // implement io.Reader
@@ -16,3 +24,114 @@ func (sr StaticErr) Read(p []byte) (int, error) {
 func (sr StaticErr) Close() error {
 	return nil
 }
+
+var (
+	// ErrOutsideRepo is returned when reading a static resource outside
+	// of the post's repository
+	ErrOutsideRepo = errors.New("static resource is outside of the repository")
+	// ErrNotListed is returned in strict mode when reading a static
+	// resource not in the post's StaticList
+	ErrNotListed = errors.New("static resource isn't in the static list")
+)
+
+// staticError is a failed static resource, reading it gives the error
+type staticError struct {
+	err error
+}
+
+// implement io.Reader
+func (se staticError) Read(p []byte) (int, error) {
+	return 0, se.err
+}
+
+func (se staticError) Close() error {
+	return nil
+}
+
+// StaticFunc is an adapter to allow the use of ordinary functions as
+// Staticer
+type StaticFunc func(string) io.ReadCloser
+
+func (f StaticFunc) Static(path string) io.ReadCloser {
+	return f(path)
+}
+
+// isListed reports whether the static resource at path is in the
+// post's StaticList, whatever the prefix and the hash of the links are
+func isListed(p Poster, path string) bool {
+	link := generateImageLink(p.Key(), path)[len(ImagePrefix)-1:]
+	for _, s := range p.StaticList() {
+		if strings.HasSuffix(s, link) {
+			return true
+		}
+		if s, ok := unhashName(s); ok && strings.HasSuffix(s, link) {
+			return true
+		}
+	}
+	return false
+}
+
+// Namespacer is optionally implemented by the Staticer passed to
+// Generator.Generate, the keys of the generated posts are prefixed
+// with its namespace.
+type Namespacer interface {
+	Namespace() string
+}
+
+// repoStaticer is the Staticer given to the generators by repositories
+type repoStaticer struct {
+	StaticFunc
+	namespace string
+	url       StaticURL
+	// find the keys of the posts by their sources and titles
+	post  func(path string) (string, bool)
+	title func(title string) (string, bool)
+}
+
+func (rs repoStaticer) Namespace() string {
+	return rs.namespace
+}
+
+// StaticLink gives the link by the repository's StaticURL, whose Prefix
+// is replaced by the generator's one if any, the Base and Hash still
+// apply
+func (rs repoStaticer) StaticLink(prefix, key, path string) string {
+	u := rs.url
+	if prefix != "" {
+		u.Prefix = prefix
+	}
+	return u.Link(key, path, rs.StaticFunc)
+}
+
+func (rs repoStaticer) PostKey(path string) (string, bool) {
+	if rs.post == nil {
+		return "", false
+	}
+	return rs.post(path)
+}
+
+func (rs repoStaticer) TitleKey(title string) (string, bool) {
+	if rs.title == nil {
+		return "", false
+	}
+	return rs.title(title)
+}
+
+// embedder is implemented by the generated posts carrying some of their
+// static resources themselves, like the images in a notebook's outputs
+type embedder interface {
+	embedded(path string) ([]byte, bool)
+}
+
+// openEmbedded opens the static resource at path if it's embedded in p
+func openEmbedded(p Poster, path string) (io.ReadCloser, bool) {
+	e, ok := p.(embedder)
+	if !ok {
+		return nil, false
+	}
+	b, ok := e.embedded(path)
+	if !ok {
+		return nil, false
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), true
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// StaticLinker is optionally implemented by the Staticer passed to
+// Generator.Generate, it builds the links of the posts' local static
+// resources instead of generateImageLink
+type StaticLinker interface {
+	// StaticLink gives the link of the static resource at path of the
+	// post with the key. The prefix given by the generator's options
+	// replaces the one of the links if not empty.
+	StaticLink(prefix, key, path string) string
+}
+
+// StaticURL is the scheme of the links of a repository's static
+// resources, which are
+//
+//	Base + Prefix + key + "/" + path
+//
+// The zero value gives the links of generateImageLink.
+type StaticURL struct {
+	// Prefix is the path serving the static resources, ImagePrefix if
+	// empty, see handler.Handler.StaticPrefix
+	Prefix string `json:"prefix"`
+	// Base is the absolute url of a CDN, like "https://cdn.example.com",
+	// the links are relative to the site if empty
+	Base string `json:"base"`
+	// Hash puts a hash of the content into the name of a resource, like
+	// "a.1b2c3d4e.png", so that it can be cached forever. The hash is
+	// updated when the post is generated again.
+	Hash bool `json:"hash"`
+}
+
+// check checks the base url
+func (su StaticURL) check() error {
+	if su.Base == "" {
+		return nil
+	}
+	u, err := url.Parse(su.Base)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid static base url %q\n", su.Base)
+	}
+	return nil
+}
+
+// Link gives the link of the static resource at path of the post with
+// the key, s reads the resource for the hash
+func (su StaticURL) Link(key, p string, s Staticer) string {
+	if su.Hash && s != nil {
+		if h, ok := staticHash(s, p); ok {
+			ext := path.Ext(p)
+			p = p[:len(p)-len(ext)] + "." + h + ext
+		}
+	}
+	prefix := su.Prefix
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return strings.TrimSuffix(su.Base, "/") + prefixImageLink(prefix, key, p)
+}
+
+// staticHash gives the hash of a static resource's content
+func staticHash(s Staticer, p string) (string, bool) {
+	rc := s.Static(p)
+	if rc == nil {
+		return "", false
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:4]), true
+}
+
+// hashedName matches a name with the hash put by StaticURL
+var hashedName = regexp.MustCompile(`^(.*[^/])\.[0-9a-f]{8}(\.[^./]*)?$`)
+
+// unhashName removes the hash from the name of a static resource
+func unhashName(name string) (string, bool) {
+	m := hashedName.FindStringSubmatch(name)
+	if m == nil {
+		return name, false
+	}
+	return m[1] + m[2], true
+}
+
+// staticLink gives the link of the local static resource at path of the
+// post by s if it's a StaticLinker, the prefix given by the generator's
+// options replaces the one of the links if not empty
+func staticLink(s Staticer, prefix, key, path string) string {
+	if l, ok := s.(StaticLinker); ok {
+		return l.StaticLink(prefix, key, path)
+	}
+	return prefixImageLink(prefix, key, path)
+}
+
+// isRelativeLink reports whether the link is relative to the post
+func isRelativeLink(link string) bool {
+	return isLocalLink(link) && !strings.HasPrefix(link, "/")
+}
+
+// localLink gives the link of a relative link in a post, which is the
+// link of the post generated from the target if s is a PostFinder and
+// knows it, otherwise the link of a static resource. The keys of the
+// posts are collected into links, and the static resources into
+// statics. The other links are kept.
+func localLink(s Staticer, prefix, key, link string, statics, links *[]string) string {
+	if !isRelativeLink(link) {
+		return link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	target := u.Path
+	u.Path, u.RawPath = "", ""
+	// the query and the fragment are kept
+	rest := u.String()
+	if pf, ok := s.(PostFinder); ok {
+		if k, ok := pf.PostKey(target); ok {
+			addLink(links, k)
+			return PostLink(k) + rest
+		}
+	}
+	l := staticLink(s, prefix, key, target)
+	*statics = append(*statics, l)
+	return l + rest
+}
+
+// addLink collects the key of a linked post once
+func addLink(links *[]string, key string) {
+	for _, k := range *links {
+		if k == key {
+			return
+		}
+	}
+	*links = append(*links, key)
+}
+
+// ReadStatic reads the static resource of the post by the name in its
+// link, which may have the hash put by StaticURL. It gives ErrNotFound
+// if the post doesn't have the resource.
+func ReadStatic(p Poster, name string) ([]byte, error) {
+	b, err := readStatic(p, name)
+	if err == nil {
+		return b, nil
+	}
+	if unhashed, ok := unhashName(name); ok {
+		if b, e := readStatic(p, unhashed); e == nil {
+			return b, nil
+		}
+	}
+	return nil, err
+}
+
+func readStatic(p Poster, name string) ([]byte, error) {
+	rc := p.Static(name)
+	if rc == nil {
+		return nil, ErrNotFound
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// StaticPaths gives the names of the post's local static resources by
+// the links in its StaticList, whatever their StaticURL is. The names may
+// have the hashes put by StaticURL, ReadStatic reads them.
+func StaticPaths(p Poster) []string {
+	sep := "/" + p.Key() + "/"
+	paths := make([]string, 0)
+	for _, link := range p.StaticList() {
+		if u, err := url.Parse(link); err == nil {
+			link = u.Path
+		}
+		if i := strings.Index(link, sep); i >= 0 {
+			paths = append(paths, link[i+len(sep):])
+		}
+	}
+	return paths
+}
+
+// missingStatics gives the warnings of the post's local static resources
+// which can't be read by check, the embedded ones always can
+func missingStatics(p Poster, check func(path string) error) []string {
+	var warnings []string
+	for _, name := range StaticPaths(p) {
+		if rc, ok := openEmbedded(p, name); ok {
+			rc.Close()
+			continue
+		}
+		err := check(name)
+		if err == nil {
+			continue
+		}
+		if unhashed, ok := unhashName(name); ok && check(unhashed) == nil {
+			continue
+		}
+		warnings = append(warnings, "static resource: "+strings.TrimSpace(err.Error()))
+	}
+	return warnings
+}
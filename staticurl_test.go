@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStaticURLLink(t *testing.T) {
+	for name, c := range map[string]struct {
+		url    StaticURL
+		path   string
+		expect string
+	}{
+		"default": {
+			path:   "a.png",
+			expect: "/images/key/a.png",
+		},
+		"prefix": {
+			url:    StaticURL{Prefix: "static"},
+			path:   "img/a.png",
+			expect: "/static/key/img/a.png",
+		},
+		"base": {
+			url:    StaticURL{Base: "https://cdn.x.org/", Prefix: "/static/"},
+			path:   "a.png",
+			expect: "https://cdn.x.org/static/key/a.png",
+		},
+		"hash": {
+			url:    StaticURL{Hash: true},
+			path:   "x.go",
+			expect: "/images/key/x.3da951fa.go",
+		},
+		"hashNotExist": {
+			url:    StaticURL{Hash: true},
+			path:   "noexist.png",
+			expect: "/images/key/noexist.png",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := c.url.Link("key", c.path, ts); got != c.expect {
+				t.Errorf("got %q, but want %q\n", got, c.expect)
+			}
+		})
+	}
+
+	if err := (StaticURL{Base: "cdn.x.org"}).check(); err == nil {
+		t.Error("expect an error of the relative base url\n")
+	}
+}
+
+func TestStaticLink(t *testing.T) {
+	s := repoStaticer{StaticFunc: ts.Static, url: StaticURL{Prefix: "/static/", Hash: true}}
+	got, err := markdownGenerator{}.Generate(strings.NewReader("hello | 2012-12-01 |\n![x](x.go)\n"), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := newPost(meta{
+		key:        "hello",
+		title:      "hello",
+		date:       parseTime("2012-12-01"),
+		content:    "<p><img src=\"/static/hello/x.3da951fa.go\" alt=\"x\" /></p>\n",
+		staticList: []string{"/static/hello/x.3da951fa.go"},
+	})
+	if !isPosterEqual(got, expect) {
+		t.Errorf("\n\tgot result: %#v,\n\tbut want %#v\n", got, expect)
+	}
+	if !isListed(got, "x.go") || isListed(got, "y.go") {
+		t.Error("the hashed link isn't listed as expected\n")
+	}
+	// the generator's prefix replaces the one of the StaticURL only
+	s.url.Base = "https://cdn.x.org"
+	gen, err := NewMarkdownGenerator(MarkdownOptions{ImagePrefix: "/img/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = gen.Generate(strings.NewReader("hello | 2012-12-01 |\n![x](x.go)\n"), s); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"https://cdn.x.org/img/hello/x.3da951fa.go"}; !reflect.DeepEqual(got.StaticList(), expect) {
+		t.Errorf("got %q, but want %q\n", got.StaticList(), expect)
+	}
+}
+
+func TestReadStatic(t *testing.T) {
+	p := &localPost{Poster: newPost(meta{key: "key"}), path: "testdata/localRepo/1.md"}
+	for name, c := range map[string]struct {
+		name      string
+		expectErr error
+	}{
+		"normal": {
+			name: "x.go",
+		},
+		"hashed": {
+			name: "x.3da951fa.go",
+		},
+		"notExist": {
+			name:      "y.3da951fa.go",
+			expectErr: errors.New("no such file or directory"),
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			b, err := ReadStatic(p, c.name)
+			if err = matchError(c.expectErr, err); err != nil {
+				t.Fatal(err)
+			}
+			if c.expectErr == nil && !strings.HasPrefix(string(b), "package") {
+				t.Errorf("unexpected content %q\n", b)
+			}
+		})
+	}
+
+	_, err := ReadStatic(noStaticPoster{}, "a.png")
+	if err != ErrNotFound {
+		t.Errorf("got %v, but want %v\n", err, ErrNotFound)
+	}
+}
+
+// noStaticPoster has no static resources
+type noStaticPoster struct {
+	Poster
+}
+
+func (noStaticPoster) Static(string) io.ReadCloser {
+	return nil
+}
+
+// postStaticer knows the post "other" generated from "other.md"
+type postStaticer struct {
+	testStaticer
+}
+
+func (postStaticer) PostKey(path string) (string, bool) {
+	return "other", path == "other.md"
+}
+
+func (postStaticer) TitleKey(title string) (string, bool) {
+	return "other", strings.EqualFold(title, "Other Post")
+}
+
+func TestLocalLink(t *testing.T) {
+	for name, c := range map[string]struct {
+		link          string
+		expect        string
+		expectStatics []string
+		expectLinks   []string
+	}{
+		"static": {
+			link:          "doc.pdf?v=1#page=2",
+			expect:        "/images/key/doc.pdf?v=1#page=2",
+			expectStatics: []string{"/images/key/doc.pdf"},
+		},
+		"post": {
+			link:        "other.md#section",
+			expect:      "/posts/other#section",
+			expectLinks: []string{"other"},
+		},
+		"absolute": {
+			link:   "https://x.org/a.pdf",
+			expect: "https://x.org/a.pdf",
+		},
+		"site": {
+			link:   "/tags/go",
+			expect: "/tags/go",
+		},
+		"fragment": {
+			link:   "#section",
+			expect: "#section",
+		},
+		"mailto": {
+			link:   "mailto:a@x.org",
+			expect: "mailto:a@x.org",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			var statics, links []string
+			if got := localLink(postStaticer{}, "", "key", c.link, &statics, &links); got != c.expect {
+				t.Errorf("got %q, but want %q\n", got, c.expect)
+			}
+			if !reflect.DeepEqual(statics, c.expectStatics) {
+				t.Errorf("got statics %q, but want %q\n", statics, c.expectStatics)
+			}
+			if !reflect.DeepEqual(links, c.expectLinks) {
+				t.Errorf("got links %q, but want %q\n", links, c.expectLinks)
+			}
+		})
+	}
+}
+
+func TestGeneratorLinks(t *testing.T) {
+	for name, c := range map[string]struct {
+		gen           Generator
+		input         string
+		expectContent string
+		expectStatics []string
+	}{
+		"markdown": {
+			gen:           markdownGenerator{},
+			input:         "t | 2012-12-01 |\n[pdf](a.pdf) [other](other.md)\n\n<video src=\"v.mp4\" poster=\"p.png\"></video>\n",
+			expectContent: "<p><a href=\"/images/t/a.pdf\">pdf</a> <a href=\"/posts/other\">other</a></p>\n\n<video src=\"/images/t/v.mp4\" poster=\"/images/t/p.png\"></video>\n",
+			expectStatics: []string{"/images/t/a.pdf", "/images/t/v.mp4", "/images/t/p.png"},
+		},
+		"html": {
+			gen:           htmlGenerator{},
+			input:         "<title>t</title><meta name=\"date\" content=\"2012-12-01\"><body><a href=\"other.md\">o</a><audio><source src=\"a.ogg\"></audio></body>",
+			expectContent: "<a href=\"/posts/other\">o</a><audio><source src=\"/images/t/a.ogg\"></audio>\n",
+			expectStatics: []string{"/images/t/a.ogg"},
+		},
+		"org": {
+			gen:           orgGenerator{},
+			input:         "#+TITLE: t\n#+DATE: 2012-12-01\n[[file:other.md][other]] [[a.pdf][pdf]]\n",
+			expectContent: "<p><a href=\"/posts/other\">other</a> <a href=\"/images/t/a.pdf\">pdf</a></p>\n",
+			expectStatics: []string{"/images/t/a.pdf"},
+		},
+		"present": {
+			gen:           articleGenerator,
+			input:         "t\n0:00 2 Jan 2006\n\n* s\n\nsee [[other.md][other]] and [[a.pdf]]\n\n.link other.md Other\n",
+			expectContent: "<p>see <a href=\"/posts/other\" target=\"_self\">other</a> and <a href=\"/images/t/a.pdf\" target=\"_self\">a.pdf</a></p><p class=\"link\"><a href=\"/posts/other\" target=\"_blank\">Other</a></p>",
+			expectStatics: []string{"/images/t/a.pdf"},
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, err := c.gen.Generate(strings.NewReader(c.input), postStaticer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content := got.Content(); content != c.expectContent {
+				t.Errorf("got content %q, but want %q\n", content, c.expectContent)
+			}
+			if statics := got.StaticList(); !reflect.DeepEqual(statics, c.expectStatics) {
+				t.Errorf("got statics %q, but want %q\n", statics, c.expectStatics)
+			}
+		})
+	}
+}
+
+func TestWikiLinks(t *testing.T) {
+	for name, c := range map[string]struct {
+		input       string
+		expect      string
+		expectLinks []string
+	}{
+		"title": {
+			input:       "<p>see [[Other Post]] and [[ other post |it]]</p>",
+			expect:      "<p>see <a href=\"/posts/other\">Other Post</a> and <a href=\"/posts/other\">it</a></p>",
+			expectLinks: []string{"other"},
+		},
+		"unknown": {
+			input:       "<p>[[New Post]]</p>",
+			expect:      "<p><a href=\"/posts/New_Post\">New Post</a></p>",
+			expectLinks: []string{"New_Post"},
+		},
+		"kept": {
+			input:  "<p><code>[[Other Post]]</code><a href=\"x\">[[Other Post]]</a></p><pre>[[x]]</pre>",
+			expect: "<p><code>[[Other Post]]</code><a href=\"x\">[[Other Post]]</a></p><pre>[[x]]</pre>",
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			var links []string
+			if got := wikiLinks(postStaticer{}, c.input, &links); got != c.expect {
+				t.Errorf("got %q, but want %q\n", got, c.expect)
+			}
+			if !reflect.DeepEqual(links, c.expectLinks) {
+				t.Errorf("got links %q, but want %q\n", links, c.expectLinks)
+			}
+		})
+	}
+}
+
+func TestStaticPaths(t *testing.T) {
+	p := newPost(meta{key: "ns/key", staticList: []string{
+		"/images/ns/key/a.png",
+		"/static/ns/key/img/b.png",
+		"https://cdn.x.org/static/ns/key/x.3da951fa.go",
+		"/images/other/c.png",
+	}})
+	expect := []string{"a.png", "img/b.png", "x.3da951fa.go"}
+	if got := StaticPaths(p); !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %q, but want %q\n", got, expect)
+	}
+}
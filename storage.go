@@ -2,13 +2,19 @@ package storage
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 )
 
 type Storager interface {
 	// Add post into storage, replace if any.
 	Add(args ...Poster) error
-	// Get post according to the passed key.
+	// Get published post according to the passed key.
 	Get(args ...Keyer) (*Result, error)
+	// Query posts with more options than Get.
+	Query(q Query) (*Result, error)
 	// Remove post according to the passed key.
 	Remove(args ...Keyer) error
 	// Destroy this storage
@@ -18,25 +24,47 @@ type Storager interface {
 var _ Storager = &Storage{}
 
 type Storage struct {
-	requestCh chan *request     // for outcoming request
-	closeCh   chan struct{}     // for exit
-	data      map[string]Poster // internal data storage
+	requestCh chan *request              // for outcoming request
+	closeCh   chan struct{}              // for exit
+	data      map[string]Poster          // internal data storage
+	shadowed  map[string][]Poster        // posts lost in key collisions
+	aliases   map[string]string          // previous keys to the current ones
+	links     map[string][]string        // keys to the keys of the linked posts
+	backlinks map[string]map[string]bool // linked keys to the linking ones
+	watchers  []func(Change)             // called when a post changes
+	ready     <-chan struct{}            // closed after the first refreshes
 }
 
+// New creates a storage of the repositories in the config file
 func New(configPath string) (*Storage, error) {
+	cfg, err := getConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithConfigs(cfg), nil
+}
+
+// NewWithConfigs creates a storage of the repositories in the configs
+func NewWithConfigs(cfg Configs) *Storage {
 	s := &Storage{
 		requestCh: make(chan *request),
 		closeCh:   make(chan struct{}),
 		data:      make(map[string]Poster),
+		shadowed:  make(map[string][]Poster),
+		aliases:   make(map[string]string),
+		links:     make(map[string][]string),
+		backlinks: make(map[string]map[string]bool),
 	}
 	go s.serve()
 
-	_, err := newRepos(configPath, s)
-	if err != nil {
-		return nil, err
-	}
+	_, s.ready = newRepos(cfg, s)
+	return s
+}
 
-	return s, nil
+// Ready gives a channel which is closed once all the repositories have
+// been loaded into the storage for the first time
+func (s *Storage) Ready() <-chan struct{} {
+	return s.ready
 }
 
 func (d *Storage) serve() {
@@ -50,7 +78,12 @@ func (d *Storage) serve() {
 	}
 }
 
-var noFound = errors.New("can't find what you want")
+// ErrNotFound is returned by Get when a post isn't found
+var ErrNotFound = errors.New("can't find what you want")
+
+// now gives the current time, which decides whether a scheduled post
+// is published
+var now = time.Now
 
 func (d *Storage) handleRequest(req *request) {
 	loopArgs := func(action func(key string, arg interface{}) error) error {
@@ -70,36 +103,63 @@ func (d *Storage) handleRequest(req *request) {
 
 	switch req.cmd {
 	case add:
-		req.err <- loopArgs(func(key string, arg interface{}) error {
+		var collision error
+		err := loopArgs(func(key string, arg interface{}) error {
 			// add or update it, here only myself refer the map
 			if poster, ok := arg.(Poster); ok {
-				d.data[key] = arg.(Poster)
+				if e := d.replace(key, poster, poster); e != nil {
+					collision = e
+				}
 				dprintf("Add: key(%s), title(%s), date(%s)\n",
 					poster.Key(), poster.Title(), poster.Date())
 			}
 			return nil
 		})
+		if err == nil {
+			err = collision
+		}
+		req.err <- err
 		return
 	case remove:
 		req.err <- loopArgs(func(key string, arg interface{}) error {
 			if poster, ok := d.data[key]; ok {
-				delete(d.data, key)
+				d.replace(key, arg, nil)
 				dprintf("Remove: key(%s), title(%s), date(%s)\n",
 					key, poster.Title(), poster.Date())
 			}
 			return nil
 		})
 		return
+	case watch:
+		d.watchers = append(d.watchers, req.watcher)
+		for key, p := range d.data {
+			req.watcher(Change{Key: key, Post: p})
+		}
+		req.err <- nil
+		return
 	case get:
+		t := now()
+		visible := func(p Poster) bool {
+			return req.includeDrafts || isPublished(p, t)
+		}
 		content := make([]Poster, 0)
+		moved := make(map[string]string)
 		err := loopArgs(func(key string, arg interface{}) error {
-			if v, found := d.data[key]; found {
+			if v, found := d.data[key]; found && visible(v) {
 				content = append(content, v)
 				return nil
 			}
+			// maybe a previous key
+			if current, found := d.aliases[key]; found {
+				if v, found := d.data[current]; found && visible(v) {
+					content = append(content, v)
+					moved[key] = current
+					return nil
+				}
+			}
 
 			// not found
-			return noFound
+			return ErrNotFound
 		})
 
 		// some internal error
@@ -111,12 +171,147 @@ func (d *Storage) handleRequest(req *request) {
 		// get all
 		if len(content) == 0 {
 			for _, v := range d.data {
-				content = append(content, v)
+				if visible(v) {
+					content = append(content, v)
+				}
 			}
 		}
 
-		req.result <- content
+		req.result <- &Result{Content: content, Moved: moved}
 		req.err <- nil
+	case backlinks:
+		key, _ := req.args[0].(string)
+		current, found := d.resolve(key)
+		if !found {
+			req.err <- ErrNotFound
+			return
+		}
+		t := now()
+		content := make([]Poster, 0)
+		for _, k := range d.backlinksOf(current) {
+			if p, found := d.data[k]; found && isPublished(p, t) {
+				content = append(content, p)
+			}
+		}
+		req.result <- &Result{Content: content}
+		req.err <- nil
+	case warns:
+		req.warnings <- d.warningsOf()
+	}
+}
+
+// Sourcer is optionally implemented by a Poster to tell where it comes
+// from, posts from different sources never replace each other.
+type Sourcer interface {
+	Source() string
+}
+
+func source(v interface{}) string {
+	if s, ok := v.(Sourcer); ok {
+		return s.Source()
+	}
+	return ""
+}
+
+// sameSource reports whether a and b come from the same source, which
+// is assumed if any of them is unknown
+func sameSource(a, b interface{}) bool {
+	sa, sb := source(a), source(b)
+	return sa == "" || sb == "" || sa == sb
+}
+
+// KeyCollisionError reports the posts from different sources having
+// the same key. The earliest post wins, then the one whose source is
+// the smallest, the others are invisible until it's removed.
+type KeyCollisionError struct {
+	Key     string
+	Sources []string // the winner's source comes first
+}
+
+func (e *KeyCollisionError) Error() string {
+	return fmt.Sprintf("key(%s) collides among %s, the first one wins",
+		e.Key, strings.Join(e.Sources, ", "))
+}
+
+// replace replaces the posts of the key from the same source as src
+// with p, or just removes them if p is nil.
+func (d *Storage) replace(key string, src interface{}, p Poster) error {
+	defer d.changed(key)
+
+	var olds []Poster
+	if old, found := d.data[key]; found {
+		olds = append(olds, old)
+	}
+	olds = append(olds, d.shadowed[key]...)
+
+	var posts []Poster
+	for _, old := range olds {
+		if !sameSource(old, src) {
+			posts = append(posts, old)
+		}
+	}
+	if p != nil {
+		posts = append(posts, p)
+	}
+
+	delete(d.shadowed, key)
+	switch len(posts) {
+	case 0:
+		delete(d.data, key)
+		return nil
+	case 1:
+		d.data[key] = posts[0]
+		return nil
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		if !a.Date().Equal(b.Date()) {
+			return a.Date().Before(b.Date())
+		}
+		return source(a) < source(b)
+	})
+	d.data[key] = posts[0]
+	d.shadowed[key] = posts[1:]
+
+	e := &KeyCollisionError{Key: key}
+	for _, p := range posts {
+		e.Sources = append(e.Sources, source(p))
+	}
+	return e
+}
+
+// Change tells the post of a key is changed
+type Change struct {
+	Key string
+	// Post is the current post of the key, nil if it's removed
+	Post Poster
+}
+
+// changed updates the indexes and tells the watchers after the post
+// with the key is changed
+func (d *Storage) changed(key string) {
+	d.reindex(key)
+	c := Change{Key: key, Post: d.data[key]}
+	for _, f := range d.watchers {
+		f(c)
+	}
+}
+
+// reindex updates the aliases and links of the post with the key
+func (d *Storage) reindex(key string) {
+	defer d.relink(key)
+	for alias, current := range d.aliases {
+		if current == key {
+			delete(d.aliases, alias)
+		}
+	}
+	if p, found := d.data[key]; found {
+		for _, alias := range Aliases(p) {
+			if alias != key {
+				d.aliases[alias] = key
+			}
+		}
 	}
 }
 
@@ -126,13 +321,19 @@ const (
 	add cmd = iota
 	remove
 	get
+	watch
+	backlinks
+	warns
 )
 
 type request struct {
-	cmd    cmd
-	args   []interface{}
-	result chan []Poster
-	err    chan error
+	cmd           cmd
+	args          []interface{}
+	includeDrafts bool
+	watcher       func(Change)
+	result        chan *Result
+	warnings      chan []Warning
+	err           chan error
 }
 
 // Add add something into the dataCenter
@@ -170,6 +371,9 @@ func (s *Storage) Remove(args ...Keyer) error {
 // Response for the request
 type Result struct {
 	Content []Poster
+	// Moved maps the requested keys which are previous keys of some
+	// posts to the posts' current keys
+	Moved map[string]string
 }
 
 // Satisfy sort.Interface
@@ -188,22 +392,82 @@ func (r *Result) Swap(i, j int) {
 // Get may get something from the dataCenter
 // If you want get sth special, give the filter arg
 // Otherwise, get all
+// Drafts and posts scheduled for a later date are invisible
 // Some internal error will be returned
 func (s *Storage) Get(args ...Keyer) (*Result, error) {
+	return s.Query(Query{Keys: args})
+}
+
+// Query describes which posts Storager.Query gives
+type Query struct {
+	// Keys are the wanted posts, all if empty
+	Keys []Keyer
+	// IncludeDrafts makes the drafts and the posts scheduled for
+	// a later date visible, e.g. for previewing
+	IncludeDrafts bool
+	// Tag only gives the posts with the tag if not empty
+	Tag string
+	// Limit only gives the latest Limit posts if positive
+	Limit int
+}
+
+// hasTag reports whether the post has the tag
+func hasTag(p Poster, tag string) bool {
+	for _, t := range p.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Query is like Get, but with more options
+func (s *Storage) Query(q Query) (*Result, error) {
 	r := &request{
-		cmd:    get,
-		args:   make([]interface{}, len(args)),
-		result: make(chan []Poster, 1),
-		err:    make(chan error, 1),
+		cmd:           get,
+		args:          make([]interface{}, len(q.Keys)),
+		includeDrafts: q.IncludeDrafts,
+		result:        make(chan *Result, 1),
+		err:           make(chan error, 1),
 	}
-	for i, k := range args {
+	for i, k := range q.Keys {
 		r.args[i] = k
 	}
 	s.requestCh <- r
 	if err := <-r.err; err != nil {
 		return nil, err
 	}
-	return &Result{<-r.result}, nil
+	result := <-r.result
+
+	if q.Tag != "" {
+		content := result.Content[:0]
+		for _, p := range result.Content {
+			if hasTag(p, q.Tag) {
+				content = append(content, p)
+			}
+		}
+		result.Content = content
+	}
+	if q.Limit > 0 {
+		sort.Sort(result)
+		if len(result.Content) > q.Limit {
+			result.Content = result.Content[:q.Limit]
+		}
+	}
+	return result, nil
+}
+
+// Watch makes f called with every change of the posts, including the
+// drafts. It's called with all the current posts at first. As f is
+// called by the storage itself, it mustn't call back into the storage.
+func (s *Storage) Watch(f func(Change)) {
+	r := &request{
+		cmd:     watch,
+		watcher: f,
+		err:     make(chan error, 1),
+	}
+	s.requestCh <- r
+	<-r.err
 }
 
 // Destroys this storage
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"sort"
 	"sync"
 	"testing"
@@ -46,6 +47,28 @@ func (e *entry) IsSlide() bool {
 func (e *entry) StaticList() []string {
 	return nil
 }
+func (e *entry) IsDraft() bool {
+	return false
+}
+func (e *entry) Summary() string {
+	return e.Content()
+}
+func (e *entry) WordCount() int {
+	return 3
+}
+func (e *entry) ReadingTime() time.Duration {
+	return time.Minute
+}
+func (e *entry) TOC() []*Heading {
+	return nil
+}
+func (e *entry) Updated() time.Time {
+	return e.Date()
+}
+
+func (e *entry) Aliases() []string {
+	return nil
+}
 
 type testCase struct {
 	prepare func() error
@@ -214,7 +237,7 @@ func TestStorageGet(t *testing.T) {
 						len(r.Content), 1)
 				}
 				if r.Content[0] != ents[1] {
-					return noFound
+					return ErrNotFound
 				}
 				return nil
 			},
@@ -234,7 +257,7 @@ func TestStorageGet(t *testing.T) {
 						len(r.Content), 2)
 				}
 				if r.Content[0] != ents[1] || r.Content[1] != ents[1] {
-					return noFound
+					return ErrNotFound
 				}
 				return nil
 			},
@@ -248,7 +271,7 @@ func TestStorageGet(t *testing.T) {
 				return nil
 			},
 			input:     []Keyer{ents[0], ents[2]},
-			expectErr: noFound,
+			expectErr: ErrNotFound,
 			checker: func(r *Result) error {
 				if r != nil {
 					return errors.New("add some: result should be nil\n")
@@ -279,6 +302,388 @@ func TestStorageGet(t *testing.T) {
 	}
 }
 
+func TestStorageQueryDrafts(t *testing.T) {
+	defer func(old func() time.Time) { now = old }(now)
+	now = func() time.Time { return parseTime("2018-10-15") }
+
+	published := newPost(meta{key: "published", date: parseTime("2018-10-01")})
+	draft := newPost(meta{key: "draft", date: parseTime("2018-10-01"), draft: true})
+	scheduled := newPost(meta{key: "scheduled", date: parseTime("2018-10-20")})
+
+	s, err := New("./testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add(published, draft, scheduled); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]struct {
+		query     Query
+		expectErr error
+		expect    int
+	}{
+		"getAll": {
+			expect: 1,
+		},
+		"getDraft": {
+			query:     Query{Keys: []Keyer{draft}},
+			expectErr: ErrNotFound,
+		},
+		"getScheduled": {
+			query:     Query{Keys: []Keyer{scheduled}},
+			expectErr: ErrNotFound,
+		},
+		"previewAll": {
+			query:  Query{IncludeDrafts: true},
+			expect: 3,
+		},
+		"previewDraft": {
+			query:  Query{Keys: []Keyer{draft}, IncludeDrafts: true},
+			expect: 1,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			r, err := s.Query(c.query)
+			if err != c.expectErr {
+				t.Fatalf("expect error: %v, but got %v\n", c.expectErr, err)
+			}
+			if err == nil && len(r.Content) != c.expect {
+				t.Errorf("got %d posts, but want %d\n", len(r.Content), c.expect)
+			}
+		})
+	}
+
+	// the scheduled one shows up once its time comes
+	now = func() time.Time { return parseTime("2018-10-20") }
+	r, err := s.Get(scheduled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Content[0] != scheduled {
+		t.Errorf("got %#v, but want %#v\n", r.Content[0], scheduled)
+	}
+}
+
+func TestStorageQueryTagLimit(t *testing.T) {
+	s, err := New("./testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add(
+		newPost(meta{key: "a", date: parseTime("2018-10-01"), tags: []string{"go"}}),
+		newPost(meta{key: "b", date: parseTime("2018-10-03"), tags: []string{"go", "c"}}),
+		newPost(meta{key: "c", date: parseTime("2018-10-02"), tags: []string{"c"}}),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]struct {
+		query  Query
+		expect []string
+	}{
+		"tag": {
+			query:  Query{Tag: "go", Limit: 10},
+			expect: []string{"b", "a"},
+		},
+		"limit": {
+			query:  Query{Limit: 2},
+			expect: []string{"b", "c"},
+		},
+		"tagLimit": {
+			query:  Query{Tag: "c", Limit: 1},
+			expect: []string{"b"},
+		},
+		"noTag": {
+			query: Query{Tag: "none"},
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			r, err := s.Query(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, p := range r.Content {
+				keys = append(keys, p.Key())
+			}
+			if !reflect.DeepEqual(keys, c.expect) {
+				t.Errorf("got %v, but want %v\n", keys, c.expect)
+			}
+		})
+	}
+}
+
+func TestStorageWatch(t *testing.T) {
+	s, err := New("./testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newPost(meta{key: "a", date: parseTime("2018-10-01")})
+	b := newPost(meta{key: "b", date: parseTime("2018-10-02"), draft: true})
+	if err = s.Add(a); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []Change
+	s.Watch(func(c Change) { changes = append(changes, c) })
+	if err = s.Add(b); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	// removing a missing post changes nothing
+	if err = s.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+
+	// synchronize with the storage before checking
+	if _, err = s.Get(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []Change{{"a", a}, {"b", b}, {"a", nil}}
+	if !reflect.DeepEqual(changes, expect) {
+		t.Errorf("got %v, but want %v\n", changes, expect)
+	}
+}
+
+func TestStorageReady(t *testing.T) {
+	s := NewWithConfigs(Configs{{Type: "local", Root: "./testdata/localRepo"}})
+	select {
+	case <-s.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("storage isn't ready in time\n")
+	}
+	r, err := s.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Content) == 0 {
+		t.Error("got no posts after ready\n")
+	}
+}
+
+type sourcedPost struct {
+	*post
+	source string
+}
+
+func (sp *sourcedPost) Source() string {
+	return sp.source
+}
+
+func TestStorageKeyCollision(t *testing.T) {
+	first := &sourcedPost{newPost(meta{key: "k", date: parseTime("2018-10-01")}), "b"}
+	second := &sourcedPost{newPost(meta{key: "k", date: parseTime("2018-10-02")}), "a"}
+	tie := &sourcedPost{newPost(meta{key: "k", date: parseTime("2018-10-01")}), "c"}
+	updated := &sourcedPost{newPost(meta{key: "k", date: parseTime("2018-10-03")}), "b"}
+
+	getOne := func(s *Storage) Poster {
+		r, err := s.Get(StringKey("k"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Content[0]
+	}
+
+	s, err := New("./testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add(second); err != nil {
+		t.Fatal(err)
+	}
+	// whatever the order, the earliest one wins
+	err = s.Add(first)
+	if e, ok := err.(*KeyCollisionError); !ok || e.Key != "k" ||
+		!reflect.DeepEqual(e.Sources, []string{"b", "a"}) {
+		t.Fatalf("got error %#v, but want a key collision\n", err)
+	}
+	if got := getOne(s); got != first {
+		t.Errorf("got %#v, but want %#v\n", got, first)
+	}
+	// then the smallest source
+	if err = s.Add(tie); err == nil {
+		t.Fatal("want a key collision, but got nil")
+	}
+	if got := getOne(s); got != first {
+		t.Errorf("got %#v, but want %#v\n", got, first)
+	}
+	// an update of the same source doesn't collide with itself
+	if err = s.Remove(tie); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add(updated); err == nil {
+		t.Fatal("want a key collision, but got nil")
+	}
+	if got := getOne(s); got != second {
+		t.Errorf("got %#v, but want %#v\n", got, second)
+	}
+	// the shadowed one shows up once the winner is removed
+	if err = s.Remove(second); err != nil {
+		t.Fatal(err)
+	}
+	if got := getOne(s); got != updated {
+		t.Errorf("got %#v, but want %#v\n", got, updated)
+	}
+	if err = s.Remove(updated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(StringKey("k")); err != ErrNotFound {
+		t.Errorf("got error %v, but want %v\n", err, ErrNotFound)
+	}
+}
+
+func TestStorageGetMoved(t *testing.T) {
+	p := newPost(meta{
+		key:     "new",
+		date:    parseTime("2018-10-01"),
+		aliases: []string{"old", "older"},
+	})
+	other := newPost(meta{key: "older", date: parseTime("2018-10-01")})
+
+	s, err := New("./testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add(p, other); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]struct {
+		input     Keyer
+		expectErr error
+		expect    Poster
+		moved     map[string]string
+	}{
+		"current": {
+			input:  StringKey("new"),
+			expect: p,
+			moved:  map[string]string{},
+		},
+		"alias": {
+			input:  StringKey("old"),
+			expect: p,
+			moved:  map[string]string{"old": "new"},
+		},
+		"existingKeyFirst": {
+			input:  StringKey("older"),
+			expect: other,
+			moved:  map[string]string{},
+		},
+		"unknown": {
+			input:     StringKey("unknown"),
+			expectErr: ErrNotFound,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			r, err := s.Get(c.input)
+			if err != c.expectErr {
+				t.Fatalf("expect error: %v, but got %v\n", c.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if r.Content[0] != c.expect {
+				t.Errorf("got %#v, but want %#v\n", r.Content[0], c.expect)
+			}
+			if !reflect.DeepEqual(r.Moved, c.moved) {
+				t.Errorf("got moved %v, but want %v\n", r.Moved, c.moved)
+			}
+		})
+	}
+
+	// the aliases go away with the post
+	if err = s.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(StringKey("old")); err != ErrNotFound {
+		t.Errorf("got error %v, but want %v\n", err, ErrNotFound)
+	}
+}
+
+type warnedPost struct {
+	*post
+	warnings []string
+}
+
+func (wp *warnedPost) Warnings() []string {
+	return wp.warnings
+}
+
+func TestStorageBacklinks(t *testing.T) {
+	target := newPost(meta{key: "new", date: parseTime("2018-10-01"), aliases: []string{"old"}})
+	a := newPost(meta{key: "a", date: parseTime("2018-10-02"), links: []string{"old"}})
+	b := newPost(meta{key: "b", date: parseTime("2018-10-03"), links: []string{"new", "gone"}})
+	draft := newPost(meta{key: "d", date: parseTime("2018-10-04"), draft: true, links: []string{"new"}})
+	w := &warnedPost{newPost(meta{key: "w", date: parseTime("2018-10-05")}), []string{"missing static resource(x.png)"}}
+
+	s, err := New("./testdata/repos.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add(a, b, draft, target, w); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]struct {
+		key       string
+		expectErr error
+		expect    []Poster
+	}{
+		"current": {
+			key:    "new",
+			expect: []Poster{b, a},
+		},
+		"alias": {
+			key:    "old",
+			expect: []Poster{b, a},
+		},
+		"none": {
+			key:    "a",
+			expect: []Poster{},
+		},
+		"unknown": {
+			key:       "gone",
+			expectErr: ErrNotFound,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			got, err := s.Backlinks(c.key)
+			if err != c.expectErr {
+				t.Fatalf("expect error: %v, but got %v\n", c.expectErr, err)
+			}
+			if err == nil && !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("got %v, but want %v\n", got, c.expect)
+			}
+		})
+	}
+
+	expect := []Warning{
+		{Key: "b", Msg: "broken link to post(gone)"},
+		{Key: "w", Msg: "missing static resource(x.png)"},
+	}
+	if got := s.Warnings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("got warnings %v, but want %v\n", got, expect)
+	}
+
+	// the links go away with the post
+	if err = s.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Backlinks("new"); err != nil || !reflect.DeepEqual(got, []Poster{a}) {
+		t.Errorf("got %v, %v, but want %v\n", got, err, []Poster{a})
+	}
+	if got := s.Warnings(); !reflect.DeepEqual(got, expect[1:]) {
+		t.Errorf("got warnings %v, but want %v\n", got, expect[1:])
+	}
+}
+
 func compareTwo(expects []*entry, reals []Poster) error {
 check:
 	for _, expect := range expects {
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// moreMarker explicitly ends the summary of a post
+	moreMarker = "<!--more-->"
+	// summaryWords is the length of a summary without moreMarker
+	summaryWords = 50
+	// wordsPerMinute is the reading speed used for the reading time
+	wordsPerMinute = 200
+)
+
+// summarize gives the leading part of the html content, up to the
+// moreMarker or the first summaryWords words, with all the tags balanced.
+// It also counts the words of the whole content.
+func summarize(content string) (summary string, words int) {
+	tokens := tokenizeHTML(content)
+	cut := -1     // index of the token where the summary ends
+	cutText := "" // truncated text of the token at cut
+	inRaw := false
+	for i, t := range tokens {
+		switch t.kind {
+		case startTagToken:
+			inRaw = t.name == "script" || t.name == "style"
+		case endTagToken:
+			inRaw = false
+		case commentToken:
+			if t.raw == moreMarker && cut < 0 {
+				cut = i
+			}
+		case textToken:
+			if inRaw {
+				continue
+			}
+			n := countWords(t.raw)
+			if cut < 0 && words+n > summaryWords {
+				cut = i
+				cutText = truncateWords(t.raw, summaryWords-words) + "…"
+			}
+			words += n
+		}
+	}
+	if cut < 0 {
+		return content, words
+	}
+
+	var b strings.Builder
+	for _, t := range tokens[:cut] {
+		b.WriteString(t.raw)
+	}
+	b.WriteString(cutText)
+	b.WriteString(closeTags(tokens[:cut]))
+	return b.String(), words
+}
+
+func countWords(s string) int {
+	return len(strings.FieldsFunc(s, unicode.IsSpace))
+}
+
+// truncateWords keeps the first n words of s
+func truncateWords(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	inWord := false
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if inWord {
+				n--
+				if n == 0 {
+					return s[:i]
+				}
+			}
+			inWord = false
+		} else {
+			inWord = true
+		}
+	}
+	return s
+}
+
+// readingTime estimates the time to read the words, in minutes
+func readingTime(words int) time.Duration {
+	if words == 0 {
+		return 0
+	}
+	return time.Duration((words+wordsPerMinute-1)/wordsPerMinute) * time.Minute
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	long := strings.Repeat("word ", summaryWords+10)
+	for name, c := range map[string]struct {
+		input   string
+		summary string
+		words   int
+	}{
+		"empty": {},
+		"short": {
+			input:   "<p>hello <em>world</em></p>",
+			summary: "<p>hello <em>world</em></p>",
+			words:   2,
+		},
+		"more": {
+			input:   "<p>hello</p>\n<!--more-->\n<p>world</p>",
+			summary: "<p>hello</p>\n",
+			words:   2,
+		},
+		"moreInside": {
+			input:   "<div><p>hello</p><!--more--><p>world</p></div>",
+			summary: "<div><p>hello</p></div>",
+			words:   2,
+		},
+		"truncate": {
+			input:   "<div><p><em>" + long + "</em></p></div>",
+			summary: "<div><p><em>" + strings.TrimSpace(strings.Repeat("word ", summaryWords)) + "…</em></p></div>",
+			words:   summaryWords + 10,
+		},
+		"truncateAtTag": {
+			input:   "<p>" + strings.Repeat("word ", summaryWords) + "<img src=\"a.png\"/><b>more</b></p>",
+			summary: "<p>" + strings.Repeat("word ", summaryWords) + "<img src=\"a.png\"/><b>…</b></p>",
+			words:   summaryWords + 1,
+		},
+		"skipScript": {
+			input:   "<p>hello</p><script>var a = '<p>';</script>",
+			summary: "<p>hello</p><script>var a = '<p>';</script>",
+			words:   1,
+		},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			summary, words := summarize(c.input)
+			if summary != c.summary {
+				t.Errorf("got summary %q, but want %q\n", summary, c.summary)
+			}
+			if words != c.words {
+				t.Errorf("got %d words, but want %d\n", words, c.words)
+			}
+		})
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	for name, c := range map[string]struct {
+		words  int
+		expect time.Duration
+	}{
+		"none": {},
+		"one":  {words: 1, expect: time.Minute},
+		"full": {words: wordsPerMinute, expect: time.Minute},
+		"more": {words: wordsPerMinute + 1, expect: 2 * time.Minute},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if got := readingTime(c.words); got != c.expect {
+				t.Errorf("got %v, but want %v\n", got, c.expect)
+			}
+		})
+	}
+}
+
+// plainPost only has the methods of Poster
+type plainPost struct {
+	Poster
+}
+
+func TestSummaryFallback(t *testing.T) {
+	p := plainPost{newPost(meta{content: "<p>one two</p><!--more--><p>three</p>", summary: "ignored", words: 100})}
+	if got, expect := Summary(p), "<p>one two</p>"; got != expect {
+		t.Errorf("got summary %q, but want %q\n", got, expect)
+	}
+	if got := WordCount(p); got != 3 {
+		t.Errorf("got %d words, but want 3\n", got)
+	}
+	if got := ReadingTime(p); got != time.Minute {
+		t.Errorf("got %v, but want %v\n", got, time.Minute)
+	}
+}
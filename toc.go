@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Heading is an entry of a post's table of contents
+type Heading struct {
+	Level    int        `json:"level"`              // 1 for the outermost level
+	Title    string     `json:"title"`              // plain text of the heading
+	Anchor   string     `json:"anchor"`             // id of the heading element in the content
+	Children []*Heading `json:"children,omitempty"` // the nested sub headings
+}
+
+// tocBuilder builds the nested table of contents from a flat sequence
+// of headings.
+type tocBuilder struct {
+	toc   []*Heading
+	stack []*Heading // the path to the last added heading
+	ids   map[string]int
+}
+
+func (tb *tocBuilder) add(level int, title, anchor string) {
+	h := &Heading{
+		Level:  level,
+		Title:  title,
+		Anchor: anchor,
+	}
+	for len(tb.stack) != 0 && tb.stack[len(tb.stack)-1].Level >= level {
+		tb.stack = tb.stack[:len(tb.stack)-1]
+	}
+	if len(tb.stack) == 0 {
+		tb.toc = append(tb.toc, h)
+	} else {
+		parent := tb.stack[len(tb.stack)-1]
+		parent.Children = append(parent.Children, h)
+	}
+	tb.stack = append(tb.stack, h)
+}
+
+// reserve marks an id given by the author as used
+func (tb *tocBuilder) reserve(id string) {
+	if tb.ids == nil {
+		tb.ids = make(map[string]int)
+	}
+	tb.ids[id]++
+}
+
+// uniqueID gives an id based on the title which hasn't been used yet
+func (tb *tocBuilder) uniqueID(title string) string {
+	if tb.ids == nil {
+		tb.ids = make(map[string]int)
+	}
+	base := slugify(title)
+	if base == "" {
+		base = "section"
+	}
+	id := base
+	for tb.ids[id] != 0 {
+		id = base + "-" + strconv.Itoa(tb.ids[base])
+		tb.ids[base]++
+	}
+	tb.ids[id]++
+	return id
+}
+
+// slugify turns s into lower case words joined with '-'
+func slugify(s string) string {
+	return strings.ToLower(joinWords(s, '-'))
+}
+
+// htmlText gives the plain text of an html fragment
+func htmlText(s string) string {
+	var b strings.Builder
+	for _, t := range tokenizeHTML(s) {
+		if t.kind == textToken {
+			b.WriteString(t.raw)
+		}
+	}
+	return strings.TrimSpace(html.UnescapeString(b.String()))
+}
@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"reflect"
 	"unsafe"
 )
 
@@ -10,9 +9,5 @@ func bytes2String(bs []byte) string {
 		return ""
 	}
 
-	sh := &reflect.StringHeader{
-		Data: uintptr(unsafe.Pointer(&bs[0])),
-		Len:  len(bs),
-	}
-	return *(*string)(unsafe.Pointer(sh))
+	return *(*string)(unsafe.Pointer(&bs))
 }